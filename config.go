@@ -14,9 +14,22 @@ const (
 // Settings is a main struct for settings
 type Settings struct {
 	APIKey        string            `json:"api-key"`
+	APIURL        string            `json:"api-url"`
 	Addr          string            `json:"addr"`
+	TLSCertFile   string            `json:"tls-cert-file"`
+	TLSKeyFile    string            `json:"tls-key-file"`
+	Webhook       WebhookSettings   `json:"webhook"`
+	WebURL        string            `json:"web-url"`
+	Storage       string            `json:"storage"`
 	Couchbase     CouchbaseSettings `json:"couchbase"`
+	SQLite        SQLiteSettings    `json:"sqlite"`
+	Search        SearchSettings    `json:"search"`
+	JournalPath   string            `json:"journal-path"`
+	Downloads     DownloadSettings  `json:"downloads"`
+	Media         MediaSettings     `json:"media"`
 	StaticDirPath string            `json:"static-dir-path"`
+	TemplatesDir  string            `json:"templates-dir"`
+	PublicChats   []int64           `json:"public-chats"`
 }
 
 // CouchbaseSettings is a sub truct for couchbase settings
@@ -26,13 +39,75 @@ type CouchbaseSettings struct {
 	Secret  string `json:"secret"`
 }
 
+// SQLiteSettings is a sub struct for sqlite settings
+type SQLiteSettings struct {
+	Path string `json:"path"`
+}
+
+// WebhookSettings is a sub struct for webhook settings, long polling is used if URL is empty
+type WebhookSettings struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	SelfSigned bool   `json:"self-signed"`
+}
+
+// SearchSettings is a sub struct for full-text search settings
+type SearchSettings struct {
+	// IndexPath is a path to search index file, empty path disables search
+	IndexPath string `json:"index-path"`
+}
+
+// DownloadSettings is a sub struct for files downloader settings
+type DownloadSettings struct {
+	Workers int `json:"workers"`
+	Retries int `json:"retries"`
+	// Timeout is a timeout of one file download in seconds
+	Timeout int `json:"timeout"`
+	// RetryInterval is an interval of retry failed downloads in minutes
+	RetryInterval int `json:"retry-interval"`
+	// MaxAttempts is a number of attempts after which failed download is retried only manually
+	MaxAttempts int `json:"max-attempts"`
+}
+
+// MediaSettings is a sub struct for storage of downloaded files
+type MediaSettings struct {
+	// Backend is local (static dir) or s3
+	Backend string `json:"backend"`
+	// Serve is proxy (through web server) or redirect (to presigned url of s3)
+	Serve string `json:"serve"`
+	// URLTTL is a lifetime of presigned urls in minutes
+	URLTTL int        `json:"url-ttl"`
+	S3     S3Settings `json:"s3"`
+}
+
+// S3Settings is a sub struct for S3 compatible storage settings
+type S3Settings struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access-key"`
+	SecretKey string `json:"secret-key"`
+}
+
 // LoadConfig function load a config file
 func LoadConfig() {
 	settings.APIKey = ""
 	settings.Addr = ":8088"
+	settings.Storage = "couchbase"
 	settings.Couchbase.Cluster = "couchbase://couchbase"
 	settings.Couchbase.Bucket = "default"
 	settings.Couchbase.Secret = ""
+	settings.SQLite.Path = "gotelegrambot.db"
+	settings.Search.IndexPath = "search.db"
+	settings.JournalPath = "updates.journal"
+	settings.Downloads.Workers = 4
+	settings.Downloads.Retries = 5
+	settings.Downloads.Timeout = 120
+	settings.Downloads.RetryInterval = 60
+	settings.Downloads.MaxAttempts = 50
+	settings.Media.Backend = "local"
+	settings.Media.Serve = "proxy"
+	settings.Media.URLTTL = 60
 
 	f, err := os.Open(configFileName)
 	if err != nil {
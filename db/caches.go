@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
 )
 
 // Cache is struct for store date caches
@@ -20,6 +22,13 @@ type Cache struct {
 // Caches is a map cache to chat ID
 type Caches map[int64]*Cache
 
+// cachesMutex guards Caches maps, every store updates caches from goroutines
+var cachesMutex sync.Mutex
+
+// dateLister is a function returns messages dates for chat between beginDate and endDate
+// (unix time), or all messages dates if both are zero
+type dateLister func(chatID int64, beginDate, endDate int64) ([]time.Time, error)
+
 // CreateNewCache function create new Cache pointer
 func CreateNewCache() *Cache {
 	cache := new(Cache)
@@ -29,13 +38,9 @@ func CreateNewCache() *Cache {
 	return cache
 }
 
-// AddedDateToCaches added date to caches
-func AddedDateToCaches(chatID int64, d time.Time) {
-	if _, ok := caches[chatID]; !ok {
-		caches[chatID] = CreateNewCache()
-	}
-
-	cache := caches[chatID]
+// AddedDate added date to caches
+func (caches Caches) AddedDate(chatID int64, d time.Time) {
+	cache := caches.get(chatID)
 
 	cache.mutex.Lock()
 	strYear := strconv.Itoa(d.Year())
@@ -48,11 +53,8 @@ func AddedDateToCaches(chatID int64, d time.Time) {
 	cache.mutex.Unlock()
 }
 
-func updateDateCaches() {
-	chats, err := GetChats()
-	if err != nil {
-		return
-	}
+// update function fills caches with messages dates of given chats
+func (caches Caches) update(chats []*tgbotapi.Chat, getDates dateLister) {
 	for _, chat := range chats {
 		chatID := chat.ID
 		listDates, err := getDates(chatID, 0, 0)
@@ -60,15 +62,16 @@ func updateDateCaches() {
 			return
 		}
 		for _, t := range listDates {
-			AddedDateToCaches(chatID, t)
+			caches.AddedDate(chatID, t)
 		}
 	}
 	log.Printf("Time caches updated.")
-	//go updateDateCaches()
 }
 
-// GetCache function returns Cache pointer by Chat ID
-func getCache(chatID int64) *Cache {
+// get function returns Cache pointer by Chat ID
+func (caches Caches) get(chatID int64) *Cache {
+	cachesMutex.Lock()
+	defer cachesMutex.Unlock()
 	if cache, ok := caches[chatID]; ok {
 		return cache
 	}
@@ -90,12 +93,14 @@ func sortMonths(a []time.Month) (result []time.Month) {
 	return
 }
 
-func getDays(chatID int64, year int, month time.Month) []int {
+func (caches Caches) getDays(chatID int64, year int, month time.Month) []int {
 	id := getYearMonthID(year, month)
-	cache := getCache(chatID)
+	cache := caches.get(chatID)
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
 	if result, ok := cache.Days[id]; ok {
 		sort.Ints(result)
-		return result
+		return append([]int{}, result...)
 	}
 	return []int{}
 }
@@ -103,3 +108,74 @@ func getDays(chatID int64, year int, month time.Month) []int {
 func getYearMonthID(year int, month time.Month) string {
 	return fmt.Sprintf("%d/%d", year, month)
 }
+
+// years function returns years msg date from chat messages
+func (caches Caches) years(chatID int64, getDates dateLister) (result []string, err error) {
+	cache := caches.get(chatID)
+	cache.mutex.Lock()
+	years := append([]string{}, cache.Years...)
+	cache.mutex.Unlock()
+	if len(years) != 0 {
+		sort.Strings(years)
+		return years, nil
+	}
+	listDates, err := getDates(chatID, 0, 0)
+	if err != nil {
+		return
+	}
+	for _, t := range listDates {
+		go caches.AddedDate(chatID, t)
+		result = appendIfNotFound(result, strconv.Itoa(t.Year()))
+	}
+	return
+}
+
+// months function returns month list msg date from chat messages and year
+func (caches Caches) months(chatID int64, year int, getDates dateLister) (result []time.Month, err error) {
+	cache := caches.get(chatID)
+	cache.mutex.Lock()
+	list := cache.MonthsByYear[year]
+	if len(list) > 0 {
+		result = sortMonths(list)
+	}
+	cache.mutex.Unlock()
+	if len(result) > 0 {
+		return
+	}
+	beginDate := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+	endDate := time.Date(year, 12, 31, 23, 59, 59, 100, time.Local).Unix()
+	listDates, err := getDates(chatID, beginDate, endDate)
+	if err != nil {
+		return
+	}
+	for _, t := range listDates {
+		if t.Year() != year {
+			continue
+		}
+
+		result = appendIfNotFoundMonth(result, t.Month())
+	}
+	return
+
+}
+
+// days function returns day list msg date from chat messages and year
+func (caches Caches) days(chatID int64, year int, month int, getDates dateLister) (result []int, err error) {
+	result = caches.getDays(chatID, year, time.Month(month))
+	if len(result) > 0 {
+		return
+	}
+	beginTime := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.Local)
+	beginDate := beginTime.Unix()
+	endDate := time.Date(year, time.Month(month), 32, 23, 59, 59, 100, time.Local).Unix()
+	listDates, err := getDates(chatID, beginDate, endDate)
+	if err != nil {
+		return
+	}
+	for _, t := range listDates {
+		if t.Year() == year && t.Month() == time.Month(month) {
+			result = appendIfNotFoundInt(result, t.Day())
+		}
+	}
+	return
+}
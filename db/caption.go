@@ -0,0 +1,83 @@
+package db
+
+import (
+	"encoding/json"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// Caption is a list of caption entities of message, records caption:chat_id:message_id.
+// telegram-bot-api.v4 has no field for caption entities, so they are stored beside of message.
+type Caption struct {
+	ChatID    int64                    `json:"chat_id"`
+	MessageID int                      `json:"message_id"`
+	Entities  []tgbotapi.MessageEntity `json:"entities"`
+}
+
+// Update is an update from Telegram with caption entities of its messages
+type Update struct {
+	tgbotapi.Update
+	Captions []*Caption `json:"captions,omitempty"`
+}
+
+// rawMessage is a part of message which telegram-bot-api.v4 does not decode
+type rawMessage struct {
+	CaptionEntities []tgbotapi.MessageEntity `json:"caption_entities"`
+	ReplyToMessage  *rawMessage              `json:"reply_to_message"`
+}
+
+// rawUpdate is a part of update with messages which telegram-bot-api.v4 does not decode
+type rawUpdate struct {
+	Message           *rawMessage `json:"message"`
+	EditedMessage     *rawMessage `json:"edited_message"`
+	ChannelPost       *rawMessage `json:"channel_post"`
+	EditedChannelPost *rawMessage `json:"edited_channel_post"`
+}
+
+// DecodeUpdate function decodes update from Telegram with caption entities of messages.
+// Edited message with caption always has a caption, so entities of previous version are replaced.
+func DecodeUpdate(data []byte) (update Update, err error) {
+	if err = json.Unmarshal(data, &update.Update); err != nil {
+		return
+	}
+	var raw rawUpdate
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	update.addCaptions(update.Message, raw.Message, false)
+	update.addCaptions(update.EditedMessage, raw.EditedMessage, true)
+	update.addCaptions(update.ChannelPost, raw.ChannelPost, false)
+	update.addCaptions(update.EditedChannelPost, raw.EditedChannelPost, true)
+	return
+}
+
+// DecodeUpdates function decodes result of getUpdates with DecodeUpdate
+func DecodeUpdates(data []byte) (updates []Update, err error) {
+	var list []json.RawMessage
+	if err = json.Unmarshal(data, &list); err != nil {
+		return
+	}
+	for _, item := range list {
+		update, err := DecodeUpdate(item)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return
+}
+
+// addCaptions method adds caption entities of message and its replied message
+func (update *Update) addCaptions(msg *tgbotapi.Message, raw *rawMessage, edited bool) {
+	if msg == nil || raw == nil || msg.Chat == nil {
+		return
+	}
+	if msg.Caption != "" && (len(raw.CaptionEntities) > 0 || edited) {
+		update.Captions = append(update.Captions, &Caption{
+			ChatID:    msg.Chat.ID,
+			MessageID: msg.MessageID,
+			Entities:  raw.CaptionEntities,
+		})
+	}
+	update.addCaptions(msg.ReplyToMessage, raw.ReplyToMessage, false)
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeUpdate(t *testing.T) {
+	data := `{"update_id":1,"message":{"message_id":2,"date":1,"chat":{"id":-5,"type":"group"},` +
+		`"caption":"photo of @bob","caption_entities":[{"type":"mention","offset":9,"length":4}],` +
+		`"reply_to_message":{"message_id":1,"date":1,"chat":{"id":-5,"type":"group"},` +
+		`"caption":"bold","caption_entities":[{"type":"bold","offset":0,"length":4}]}}}`
+	update, err := DecodeUpdate([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Message == nil || update.Message.Entities != nil {
+		t.Fatalf("Caption entities are decoded as text entities: %+v", update.Message)
+	}
+	if len(update.Captions) != 2 {
+		t.Fatalf("Captions of message and reply are not decoded: %+v", update.Captions)
+	}
+	caption := update.Captions[0]
+	if caption.ChatID != -5 || caption.MessageID != 2 || len(caption.Entities) != 1 || caption.Entities[0].Type != "mention" {
+		t.Errorf("Bad caption of message: %+v", caption)
+	}
+	reply := update.Captions[1]
+	if reply.ChatID != -5 || reply.MessageID != 1 || len(reply.Entities) != 1 || reply.Entities[0].Type != "bold" {
+		t.Errorf("Bad caption of reply: %+v", reply)
+	}
+}
+
+func TestDecodeUpdateText(t *testing.T) {
+	// caption entities of message without caption are ignored, text entities are kept
+	data := `{"update_id":1,"message":{"message_id":2,"date":1,"chat":{"id":-5,"type":"group"},` +
+		`"text":"/help","entities":[{"type":"bot_command","offset":0,"length":5}],` +
+		`"caption_entities":[{"type":"bold","offset":0,"length":1}]}}`
+	update, err := DecodeUpdate([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := update.Message
+	if msg == nil || msg.Entities == nil || (*msg.Entities)[0].Type != "bot_command" || !msg.IsCommand() {
+		t.Fatalf("Text entities are replaced: %+v", msg)
+	}
+	if len(update.Captions) != 0 {
+		t.Errorf("Message without caption has caption entities: %+v", update.Captions)
+	}
+}
+
+func TestDecodeUpdateEdited(t *testing.T) {
+	// edited caption without entities replaces entities of previous version
+	data := `{"update_id":1,"edited_message":{"message_id":2,"date":1,"edit_date":2,"chat":{"id":-5,"type":"group"},` +
+		`"caption":"plain"}}`
+	update, err := DecodeUpdate([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Captions) != 1 || len(update.Captions[0].Entities) != 0 || update.Captions[0].MessageID != 2 {
+		t.Errorf("Edited caption without entities is not decoded: %+v", update.Captions)
+	}
+
+	// new message with caption without entities has no caption record
+	data = `{"update_id":2,"message":{"message_id":3,"date":1,"chat":{"id":-5,"type":"group"},"caption":"plain"}}`
+	if update, err = DecodeUpdate([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Captions) != 0 {
+		t.Errorf("Caption without entities is decoded: %+v", update.Captions)
+	}
+}
+
+func TestDecodeUpdates(t *testing.T) {
+	data := `[{"update_id":1,"channel_post":{"message_id":1,"date":1,"chat":{"id":-100,"type":"channel"},` +
+		`"caption":"x","caption_entities":[{"type":"italic","offset":0,"length":1}]}},{"update_id":2}]`
+	updates, err := DecodeUpdates([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[1].UpdateID != 2 {
+		t.Fatalf("Bad updates %+v", updates)
+	}
+	if captions := updates[0].Captions; len(captions) != 1 || captions[0].ChatID != -100 || captions[0].Entities[0].Type != "italic" {
+		t.Errorf("Caption entities of channel post are not decoded: %+v", captions)
+	}
+	if _, err = DecodeUpdates([]byte(`[{"update_id":"x"}]`)); err == nil {
+		t.Errorf("Bad update is decoded")
+	}
+}
+
+func TestUpdateJSON(t *testing.T) {
+	// captions are kept in encoded update, e.g. in journal
+	data := `{"update_id":1,"message":{"message_id":2,"date":1,"chat":{"id":-5,"type":"group"},` +
+		`"caption":"x","caption_entities":[{"type":"bold","offset":0,"length":1}]}}`
+	update, err := DecodeUpdate([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Update
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.UpdateID != 1 || decoded.Message == nil || len(decoded.Captions) != 1 || decoded.Captions[0].Entities[0].Type != "bold" {
+		t.Errorf("Update is not restored from %s", encoded)
+	}
+}
@@ -0,0 +1,1008 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	couchbase "github.com/couchbase/gocb"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// CouchbaseStore is a Store implementation on top of couchbase bucket
+type CouchbaseStore struct {
+	cluster    *couchbase.Cluster
+	bucket     *couchbase.Bucket
+	bucketName string
+	caches     Caches
+}
+
+// NewCouchbaseStore function connects to couchbase cluster and opens bucket with parameters
+func NewCouchbaseStore(couchbaseCluster, couchbaseBucket, couchbaseSecret string) (s *CouchbaseStore, err error) {
+	s = new(CouchbaseStore)
+	s.cluster, err = couchbase.Connect(couchbaseCluster)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to cluster: %s", err)
+	}
+	s.bucket, err = s.cluster.OpenBucket(couchbaseBucket, couchbaseSecret)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open bucket: %s", err)
+	}
+	s.bucketName = couchbaseBucket
+
+	s.caches = make(Caches)
+	if chats, err := s.GetChats(); err == nil {
+		s.caches.update(chats, s.getDates)
+	}
+	return
+}
+
+// SaveMessage method save message to database
+func (s *CouchbaseStore) SaveMessage(msg *tgbotapi.Message) (err error) {
+	go s.caches.AddedDate(msg.Chat.ID, msg.Time())
+	key := fmt.Sprintf("message:%d:%d", msg.Chat.ID, msg.MessageID)
+
+	type couchmessage struct {
+		tgbotapi.Message
+		Type string `json:"type"`
+	}
+	cMsg := couchmessage{}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cMsg)
+	cMsg.Type = "message"
+
+	if _, err = s.bucket.Upsert(key, &cMsg, 0); err != nil {
+		return
+	}
+
+	err = saveMessageRelations(s, msg)
+	return
+}
+
+// SaveEditedMessage method save new revision of message and replaces message with it.
+// Original message saved as first revision on first edit.
+func (s *CouchbaseStore) SaveEditedMessage(msg *tgbotapi.Message) (err error) {
+	key := fmt.Sprintf("message:%d:%d", msg.Chat.ID, msg.MessageID)
+	original := new(tgbotapi.Message)
+	if _, err = s.bucket.Get(key, original); err == nil && original.EditDate == 0 {
+		if err = s.saveRevision(NewMessageRevision(original)); err != nil {
+			return
+		}
+	}
+	if err = s.saveRevision(NewMessageRevision(msg)); err != nil {
+		return
+	}
+	return s.SaveMessage(msg)
+}
+
+func (s *CouchbaseStore) saveRevision(revision *MessageRevision) (err error) {
+	key := fmt.Sprintf("revision:%d:%d:%d", revision.ChatID, revision.MessageID, revision.Date)
+
+	type couchrevision struct {
+		MessageRevision
+		Type string `json:"type"`
+	}
+	cRevision := couchrevision{MessageRevision: *revision, Type: "revision"}
+
+	_, err = s.bucket.Upsert(key, &cRevision, 0)
+	return
+}
+
+// GetMessageRevisions returns all saved revisions of message ordered by date
+func (s *CouchbaseStore) GetMessageRevisions(chatID int64, messageID int) (revisions []*MessageRevision, err error) {
+	type couchrevision struct {
+		Revision MessageRevision `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='revision' AND chat_id=$1 AND message_id=$2 ORDER BY date", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{chatID, messageID})
+	if err != nil {
+		return
+	}
+
+	revision := couchrevision{}
+	for res.Next(&revision) {
+		r := revision.Revision
+		revisions = append(revisions, &r)
+		revision = couchrevision{}
+	}
+	err = res.Close()
+	return
+}
+
+// SaveUser method save user to database
+func (s *CouchbaseStore) SaveUser(user *tgbotapi.User) (err error) {
+	key := fmt.Sprintf("user:%d", user.ID)
+
+	type couchuser struct {
+		tgbotapi.User
+		Type string `json:"type"`
+	}
+	cUser := couchuser{}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cUser)
+	cUser.Type = "user"
+
+	_, err = s.bucket.Upsert(key, &cUser, 0)
+	return
+}
+
+// SaveFile method save user to database
+func (s *CouchbaseStore) SaveFile(file *tgbotapi.File, chatID int64) (err error) {
+	key := fmt.Sprintf("file:%d:%s", chatID, file.FileID)
+
+	type couchfile struct {
+		tgbotapi.File
+		Type string `json:"type"`
+	}
+	cFile := couchfile{}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cFile)
+	cFile.Type = "file"
+
+	_, err = s.bucket.Upsert(key, &cFile, 0)
+	return
+}
+
+// GetCensLevel function returns censore level for user
+func (s *CouchbaseStore) GetCensLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	currentLevel = 0
+	currentYear := time.Now().Year()
+	key := fmt.Sprintf("censlevel:%d:%d", currentYear, user.ID)
+
+	level := CensLevel{}
+
+	_, err = s.bucket.Get(key, &level)
+	if err != nil {
+		err = convertError(err)
+		return
+	}
+	currentLevel = level.Level
+	return
+}
+
+// GetWarnLevel function returns warning level for user
+func (s *CouchbaseStore) GetWarnLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	currentLevel = 0
+	key := fmt.Sprintf("warnlevel:%d", user.ID)
+
+	level := WarnLevel{}
+
+	_, err = s.bucket.Get(key, &level)
+	if err != nil {
+		err = convertError(err)
+		return
+	}
+	currentLevel = level.Level
+	return
+}
+
+// SetCensLevel function sets level for user
+func (s *CouchbaseStore) SetCensLevel(user *tgbotapi.User, setlevel int) (err error) {
+	currentYear := time.Now().Year()
+	key := fmt.Sprintf("censlevel:%d:%d", currentYear, user.ID)
+
+	level := CensLevel{}
+
+	_, err = s.bucket.Get(key, &level)
+	if err != nil {
+		level.ID = user.ID
+		level.Level = setlevel
+		level.Year = currentYear
+	} else {
+		level.Level = setlevel
+	}
+
+	_, err = s.bucket.Upsert(key, &level, 0)
+	return
+}
+
+// SetWarnLevel function sets level for user
+func (s *CouchbaseStore) SetWarnLevel(user *tgbotapi.User, setlevel int) (err error) {
+	key := fmt.Sprintf("warnlevel:%d", user.ID)
+
+	level := WarnLevel{}
+
+	_, err = s.bucket.Get(key, &level)
+	if err != nil {
+		level.ID = user.ID
+		level.Level = setlevel
+	} else {
+		level.Level = setlevel
+	}
+
+	_, err = s.bucket.Upsert(key, &level, 0)
+	return
+}
+
+// ClearCensLevel remove document from bucket
+func (s *CouchbaseStore) ClearCensLevel(user *tgbotapi.User) (err error) {
+	currentYear := time.Now().Year()
+	key := fmt.Sprintf("censlevel:%d:%d", currentYear, user.ID)
+
+	level := CensLevel{}
+
+	cas, err := s.bucket.Get(key, &level)
+	if err != nil {
+		err = convertError(err)
+		return
+	}
+
+	_, err = s.bucket.Remove(key, cas)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// ClearWarnLevel remove document from bucket
+func (s *CouchbaseStore) ClearWarnLevel(user *tgbotapi.User) (err error) {
+	key := fmt.Sprintf("warnlevel:%d", user.ID)
+	level := WarnLevel{}
+
+	var cas couchbase.Cas
+	if cas, err = s.bucket.Get(key, &level); err != nil {
+		err = convertError(err)
+		return
+	} else {
+		if _, err = s.bucket.Remove(key, cas); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// AddCensLevel added +1 to cens level in year
+func (s *CouchbaseStore) AddCensLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	currentLevel, err = s.GetCensLevel(user)
+	if err != nil {
+		currentLevel = 1
+		err = s.SetCensLevel(user, currentLevel)
+		return
+	}
+	currentLevel++
+	err = s.SetCensLevel(user, currentLevel)
+
+	return
+}
+
+// AddWarnLevel added +1 to warning level for user
+func (s *CouchbaseStore) AddWarnLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	if currentLevel, err = s.GetWarnLevel(user); err != nil {
+		if err == ErrNotFound {
+			currentLevel = 1
+			err = s.SetWarnLevel(user, currentLevel)
+		}
+		return
+	}
+	currentLevel++
+	err = s.SetWarnLevel(user, currentLevel)
+	return
+}
+
+// GetFile returns file json from couchbase
+func (s *CouchbaseStore) GetFile(fileID string, chatID int64) (f *tgbotapi.File, err error) {
+	key := fmt.Sprintf("file:%d:%s", chatID, fileID)
+	f = new(tgbotapi.File)
+	_, err = s.bucket.Get(key, f)
+	err = convertError(err)
+	return
+}
+
+// SaveWebLink method saves or updates web link
+func (s *CouchbaseStore) SaveWebLink(link *WebLink) (err error) {
+	key := fmt.Sprintf("weblink:%s", link.Hash)
+
+	type couchlink struct {
+		WebLink
+		Type string `json:"type"`
+	}
+	_, err = s.bucket.Upsert(key, &couchlink{WebLink: *link, Type: "weblink"}, 0)
+	return
+}
+
+// GetWebLink returns web link by token hash
+func (s *CouchbaseStore) GetWebLink(hash string) (link *WebLink, err error) {
+	key := fmt.Sprintf("weblink:%s", hash)
+	link = new(WebLink)
+	if _, err = s.bucket.Get(key, link); err != nil {
+		return nil, convertError(err)
+	}
+	return
+}
+
+// GetWebLinks returns all web links of chat
+func (s *CouchbaseStore) GetWebLinks(chatID int64) (links []*WebLink, err error) {
+	type couchlink struct {
+		Link WebLink `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='weblink' AND chat_id=$1", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{chatID})
+	if err != nil {
+		return
+	}
+
+	link := couchlink{}
+	for res.Next(&link) {
+		l := link.Link
+		links = append(links, &l)
+		link = couchlink{}
+	}
+	err = res.Close()
+	sortWebLinks(links)
+	return
+}
+
+// SaveUpdateOffset method saves ID of last processed update
+func (s *CouchbaseStore) SaveUpdateOffset(updateID int) (err error) {
+	_, err = s.bucket.Upsert("offset:updates", &UpdateOffset{UpdateID: updateID}, 0)
+	return
+}
+
+// GetUpdateOffset returns ID of last processed update or 0 if nothing was processed
+func (s *CouchbaseStore) GetUpdateOffset() (updateID int, err error) {
+	offset := new(UpdateOffset)
+	if _, err = s.bucket.Get("offset:updates", offset); err != nil {
+		if err = convertError(err); err == ErrNotFound {
+			return 0, nil
+		}
+		return
+	}
+	return offset.UpdateID, nil
+}
+
+// SaveFailedDownload method saves or updates failed download
+func (s *CouchbaseStore) SaveFailedDownload(download *FailedDownload) (err error) {
+	key := fmt.Sprintf("download:%d:%s", download.ChatID, download.FileID)
+
+	type couchdownload struct {
+		FailedDownload
+		Type string `json:"type"`
+	}
+	_, err = s.bucket.Upsert(key, &couchdownload{FailedDownload: *download, Type: "download"}, 0)
+	return
+}
+
+// GetFailedDownloads returns all failed downloads
+func (s *CouchbaseStore) GetFailedDownloads() (downloads []*FailedDownload, err error) {
+	type couchdownload struct {
+		Download FailedDownload `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='download'", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, nil)
+	if err != nil {
+		return
+	}
+
+	download := couchdownload{}
+	for res.Next(&download) {
+		d := download.Download
+		downloads = append(downloads, &d)
+		download = couchdownload{}
+	}
+	err = res.Close()
+	sortFailedDownloads(downloads)
+	return
+}
+
+// DeleteFailedDownload removes failed download
+func (s *CouchbaseStore) DeleteFailedDownload(chatID int64, fileID string) (err error) {
+	key := fmt.Sprintf("download:%d:%s", chatID, fileID)
+	_, err = s.bucket.Remove(key, 0)
+	return convertError(err)
+}
+
+// SaveChatRole method saves or updates role of user in chat
+func (s *CouchbaseStore) SaveChatRole(role *ChatRole) (err error) {
+	key := fmt.Sprintf("role:%d:%d", role.ChatID, role.UserID)
+
+	type couchrole struct {
+		ChatRole
+		Type string `json:"type"`
+	}
+	_, err = s.bucket.Upsert(key, &couchrole{ChatRole: *role, Type: "role"}, 0)
+	return
+}
+
+// GetChatRoles returns roles of users in chat
+func (s *CouchbaseStore) GetChatRoles(chatID int64) (roles []*ChatRole, err error) {
+	type couchrole struct {
+		Role ChatRole `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='role' AND chat_id=$1", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{chatID})
+	if err != nil {
+		return
+	}
+
+	role := couchrole{}
+	for res.Next(&role) {
+		r := role.Role
+		roles = append(roles, &r)
+		role = couchrole{}
+	}
+	err = res.Close()
+	sortChatRoles(roles)
+	return
+}
+
+// DeleteChatRole removes role of user in chat
+func (s *CouchbaseStore) DeleteChatRole(chatID int64, userID int) (err error) {
+	key := fmt.Sprintf("role:%d:%d", chatID, userID)
+	_, err = s.bucket.Remove(key, 0)
+	return convertError(err)
+}
+
+// SaveSanction method saves or updates sanction
+func (s *CouchbaseStore) SaveSanction(sanction *Sanction) (err error) {
+	key := fmt.Sprintf("sanction:%d:%d:%s", sanction.ChatID, sanction.UserID, sanction.Kind)
+
+	type couchsanction struct {
+		Sanction
+		Type string `json:"type"`
+	}
+	_, err = s.bucket.Upsert(key, &couchsanction{Sanction: *sanction, Type: "sanction"}, 0)
+	return
+}
+
+// GetSanctions returns all active sanctions
+func (s *CouchbaseStore) GetSanctions() (sanctions []*Sanction, err error) {
+	type couchsanction struct {
+		Sanction Sanction `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='sanction'", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, nil)
+	if err != nil {
+		return
+	}
+
+	sanction := couchsanction{}
+	for res.Next(&sanction) {
+		v := sanction.Sanction
+		sanctions = append(sanctions, &v)
+		sanction = couchsanction{}
+	}
+	err = res.Close()
+	sortSanctions(sanctions)
+	return
+}
+
+// DeleteSanction removes sanction
+func (s *CouchbaseStore) DeleteSanction(chatID int64, userID int, kind string) (err error) {
+	key := fmt.Sprintf("sanction:%d:%d:%s", chatID, userID, kind)
+	_, err = s.bucket.Remove(key, 0)
+	return convertError(err)
+}
+
+// SaveCaption method saves or updates caption entities of message
+func (s *CouchbaseStore) SaveCaption(caption *Caption) (err error) {
+	key := fmt.Sprintf("caption:%d:%d", caption.ChatID, caption.MessageID)
+
+	type couchcaption struct {
+		Caption
+		Type string `json:"type"`
+	}
+	_, err = s.bucket.Upsert(key, &couchcaption{Caption: *caption, Type: "caption"}, 0)
+	return
+}
+
+// GetCaption returns caption entities of message
+func (s *CouchbaseStore) GetCaption(chatID int64, messageID int) (caption *Caption, err error) {
+	key := fmt.Sprintf("caption:%d:%d", chatID, messageID)
+	caption = new(Caption)
+	if _, err = s.bucket.Get(key, caption); err != nil {
+		return nil, convertError(err)
+	}
+	return
+}
+
+// SaveMediaRef method saves or updates media ref
+func (s *CouchbaseStore) SaveMediaRef(ref *MediaRef) (err error) {
+	key := fmt.Sprintf("media:%d:%s", ref.ChatID, ref.FileID)
+
+	type couchref struct {
+		MediaRef
+		Type string `json:"type"`
+	}
+	_, err = s.bucket.Upsert(key, &couchref{MediaRef: *ref, Type: "media"}, 0)
+	return
+}
+
+// GetMediaRef returns media ref of file in chat
+func (s *CouchbaseStore) GetMediaRef(chatID int64, fileID string) (ref *MediaRef, err error) {
+	key := fmt.Sprintf("media:%d:%s", chatID, fileID)
+	ref = new(MediaRef)
+	if _, err = s.bucket.Get(key, ref); err != nil {
+		return nil, convertError(err)
+	}
+	return
+}
+
+// GetMediaRefs returns all media refs
+func (s *CouchbaseStore) GetMediaRefs() (refs []*MediaRef, err error) {
+	type couchref struct {
+		Ref MediaRef `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='media'", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, nil)
+	if err != nil {
+		return
+	}
+
+	ref := couchref{}
+	for res.Next(&ref) {
+		r := ref.Ref
+		refs = append(refs, &r)
+		ref = couchref{}
+	}
+	err = res.Close()
+	sortMediaRefs(refs)
+	return
+}
+
+// SaveChat method for save chat to database
+func (s *CouchbaseStore) SaveChat(chat *tgbotapi.Chat, forward bool) (err error) {
+	key := fmt.Sprintf("chat:%d", chat.ID)
+
+	type couchchat struct {
+		tgbotapi.Chat
+		Type string `json:"type"`
+	}
+	cChat := couchchat{}
+
+	data, err := json.Marshal(chat)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cChat)
+	if forward {
+		// forwards from channel must not hide it if the bot is a member of channel
+		existing := couchchat{}
+		if _, err := s.bucket.Get(key, &existing); err == nil && existing.Type == "chat" {
+			forward = false
+		}
+	}
+	if forward {
+		cChat.Type = "forward-chat"
+	} else {
+		cChat.Type = "chat"
+	}
+
+	_, err = s.bucket.Upsert(key, cChat, 0)
+	return
+}
+
+// GetChats returns chat list
+func (s *CouchbaseStore) GetChats() (chats []*tgbotapi.Chat, err error) {
+	type couchchat struct {
+		Msg tgbotapi.Chat `json:"bot"`
+	}
+
+	query := couchbase.NewN1qlQuery(fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='chat'", s.bucketIdentifier()))
+	res, err := s.bucket.ExecuteN1qlQuery(query, nil)
+	if err != nil {
+		return
+	}
+
+	//var data interface{}
+
+	chat := couchchat{}
+	for res.Next(&chat) {
+
+		data, err := json.Marshal(chat.Msg)
+		if err != nil {
+			log.Printf("Error in marshal GetChats: %s", err)
+			continue
+		}
+		oChat := new(tgbotapi.Chat)
+		err = json.Unmarshal(data, oChat)
+		if err != nil {
+			log.Printf("Error in unmarshal GetChats: %s", err)
+			continue
+		}
+		chats = append(chats, oChat)
+	}
+
+	return
+}
+
+// GetMessages returns chat list
+func (s *CouchbaseStore) GetMessages(chatID int64) (messages []*tgbotapi.Message, err error) {
+	type couchmsg struct {
+		Msg tgbotapi.Message `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='message' AND chat.id=$1 ORDER BY date", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{chatID})
+	if err != nil {
+		return
+	}
+
+	//var data interface{}
+
+	chat := couchmsg{}
+	for res.Next(&chat) {
+		data, err := json.Marshal(chat.Msg)
+		if err != nil {
+			log.Printf("Error in marshal GetMessages: %s", err)
+			continue
+		}
+		oMsg := new(tgbotapi.Message)
+		err = json.Unmarshal(data, oMsg)
+		if err != nil {
+			log.Printf("Error in unmarshal GetMessages: %s", err)
+			continue
+		}
+		messages = append(messages, oMsg)
+	}
+
+	return
+}
+
+// GetMessagesByDate returns chat list on date
+func (s *CouchbaseStore) GetMessagesByDate(chatID int64, beginTime, endTime time.Time) (messages []*tgbotapi.Message, err error) {
+	type couchmsg struct {
+		Msg tgbotapi.Message `json:"bot"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='message' AND chat.id=$1 AND date >= $2 AND date <= $3 ORDER BY date", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{chatID, beginTime.Unix(), endTime.Unix()})
+	if err != nil {
+		return
+	}
+
+	//var data interface{}
+
+	chat := couchmsg{}
+	for res.Next(&chat) {
+		data, err := json.Marshal(chat.Msg)
+		if err != nil {
+			log.Printf("Error in marshal GetMessages: %s", err)
+			continue
+		}
+		oMsg := new(tgbotapi.Message)
+		err = json.Unmarshal(data, oMsg)
+		if err != nil {
+			log.Printf("Error in unmarshal GetMessages: %s", err)
+			continue
+		}
+		messages = append(messages, oMsg)
+	}
+
+	return
+}
+
+// GetMessagesPage returns up to limit chat messages between dates after cursor ordered by date and message ID
+func (s *CouchbaseStore) GetMessagesPage(chatID int64, beginTime, endTime time.Time, after MessageCursor, limit int) (messages []*tgbotapi.Message, err error) {
+	type couchmsg struct {
+		Msg tgbotapi.Message `json:"bot"`
+	}
+
+	statement, params := messagesPageN1qlQuery(s.bucketIdentifier(), chatID, beginTime, endTime, after, limit)
+	res, err := s.bucket.ExecuteN1qlQuery(couchbase.NewN1qlQuery(statement), params)
+	if err != nil {
+		return
+	}
+
+	row := couchmsg{}
+	for res.Next(&row) {
+		msg := row.Msg
+		messages = append(messages, &msg)
+		row = couchmsg{}
+	}
+	err = res.Close()
+	return
+}
+
+// GetChatAuthors returns IDs of senders and forwarded authors of chat messages
+func (s *CouchbaseStore) GetChatAuthors(chatID int64) (authors []int, err error) {
+	type couchauthors struct {
+		FromID        int `json:"from_id"`
+		ForwardFromID int `json:"forward_from_id"`
+	}
+
+	statement, params := chatAuthorsN1qlQuery(s.bucketIdentifier(), chatID)
+	res, err := s.bucket.ExecuteN1qlQuery(couchbase.NewN1qlQuery(statement), params)
+	if err != nil {
+		return
+	}
+
+	found := make(map[int]bool)
+	row := couchauthors{}
+	for res.Next(&row) {
+		found[row.FromID] = true
+		found[row.ForwardFromID] = true
+		row = couchauthors{}
+	}
+	if err = res.Close(); err != nil {
+		return
+	}
+
+	delete(found, 0)
+	for userID := range found {
+		authors = append(authors, userID)
+	}
+	sort.Ints(authors)
+	return
+}
+
+// GetUserChats returns chats with messages of user
+func (s *CouchbaseStore) GetUserChats(userID int) (chats []*UserChat, err error) {
+	statement, params := userChatsN1qlQuery(s.bucketIdentifier(), userID)
+	res, err := s.bucket.ExecuteN1qlQuery(couchbase.NewN1qlQuery(statement), params)
+	if err != nil {
+		return
+	}
+
+	chat := new(UserChat)
+	for res.Next(chat) {
+		chats = append(chats, chat)
+		chat = new(UserChat)
+	}
+	err = res.Close()
+	sortUserChats(chats)
+	return
+}
+
+// GetUsers returns chat list
+func (s *CouchbaseStore) GetUsers() (users []*tgbotapi.User, err error) {
+	type couchuser struct {
+		User tgbotapi.User `json:"bot"`
+	}
+
+	query := couchbase.NewN1qlQuery(fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='user'", s.bucketIdentifier()))
+	res, err := s.bucket.ExecuteN1qlQuery(query, nil)
+	if err != nil {
+		return
+	}
+
+	//var data interface{}
+
+	user := couchuser{}
+	for res.Next(&user) {
+
+		data, err := json.Marshal(user.User)
+		if err != nil {
+			log.Printf("Error in marshal GetUsers: %s", err)
+			continue
+		}
+		oUser := new(tgbotapi.User)
+		err = json.Unmarshal(data, oUser)
+		if err != nil {
+			log.Printf("Error in unmarshal GetUsers: %s", err)
+			continue
+		}
+		users = append(users, oUser)
+	}
+
+	return
+}
+
+func (s *CouchbaseStore) getDates(chatID int64, beginDate, endDate int64) (result []time.Time, err error) {
+	type couchdate struct {
+		Date int64 `json:"date"`
+	}
+
+	var dateWhere string
+	params := []interface{}{chatID}
+	if beginDate != 0 || endDate != 0 {
+		dateWhere = " AND date >= $2 AND date <= $3"
+		params = append(params, beginDate, endDate)
+	}
+
+	queryStr := fmt.Sprintf("SELECT date FROM %s WHERE type='message' AND chat.id=$1%s ORDER BY date", s.bucketIdentifier(), dateWhere)
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, params)
+	if err != nil {
+		return
+	}
+
+	date := couchdate{}
+	for res.Next(&date) {
+		tDate := time.Unix(date.Date, 0)
+		result = append(result, tDate)
+	}
+	return
+}
+
+// GetYears function returns years msg date from chat messages
+func (s *CouchbaseStore) GetYears(chatID int64) (result []string, err error) {
+	return s.caches.years(chatID, s.getDates)
+}
+
+// GetMonthList function returns month list msg date from chat messages and year
+func (s *CouchbaseStore) GetMonthList(chatID int64, year int) (result []time.Month, err error) {
+	return s.caches.months(chatID, year, s.getDates)
+}
+
+// GetDates function returns month list msg date from chat messages and year
+func (s *CouchbaseStore) GetDates(chatID int64, year int, month int) (result []int, err error) {
+	return s.caches.days(chatID, year, month, s.getDates)
+}
+
+// GetUserByID returns user by ID
+func (s *CouchbaseStore) GetUserByID(userID int) (user *tgbotapi.User, err error) {
+	user = new(tgbotapi.User)
+	if _, err = s.bucket.Get(fmt.Sprintf("user:%d", userID), user); err != nil {
+		return nil, convertError(err)
+	}
+	return
+}
+
+// GetUser get user by username or first and last name
+func (s *CouchbaseStore) GetUser(username string) (user *tgbotapi.User, err error) {
+	if len(username) == 0 {
+		return
+	}
+	type couchuser struct {
+		User tgbotapi.User `json:"bot"`
+	}
+
+	q, err := parseUserQuery(username)
+	if err != nil {
+		return nil, err
+	}
+	queryStr, params := userN1qlQuery(s.bucketIdentifier(), q)
+
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*tgbotapi.User
+	tempuser := couchuser{}
+	for res.Next(&tempuser) {
+		data, err := json.Marshal(tempuser.User)
+		if err != nil {
+			log.Printf("Error in marshal GetUser: %s", err)
+			continue
+		}
+		oUser := new(tgbotapi.User)
+		err = json.Unmarshal(data, oUser)
+		if err != nil {
+			log.Printf("Error in unmarshal GetUser: %s", err)
+			continue
+		}
+		user = oUser
+		users = append(users, user)
+	}
+
+	if len(users) > 1 {
+		return nil, errManyUsers(users)
+	} else if len(users) == 0 {
+		return nil, errUserNotFound(username)
+	}
+
+	return
+}
+
+// ExportDocuments returns up to limit documents with key prefix ordered by key and with key greater than afterKey
+func (s *CouchbaseStore) ExportDocuments(prefix, afterKey string, limit int) (docs []Document, err error) {
+	type couchdoc struct {
+		ID  string          `json:"id"`
+		Doc json.RawMessage `json:"doc"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT META(bot).id AS id, bot AS doc FROM %s AS bot WHERE META(bot).id LIKE $1 AND META(bot).id > $2 ORDER BY META(bot).id LIMIT $3", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{prefix + "%", afterKey, limit})
+	if err != nil {
+		return
+	}
+
+	doc := couchdoc{}
+	for res.Next(&doc) {
+		docs = append(docs, Document{Key: doc.ID, Data: doc.Doc})
+		doc = couchdoc{}
+	}
+	err = res.Close()
+	return
+}
+
+// CountDocuments returns count of documents with key prefix
+func (s *CouchbaseStore) CountDocuments(prefix string) (count int, err error) {
+	type couchcount struct {
+		Count int `json:"count"`
+	}
+
+	queryStr := fmt.Sprintf("SELECT COUNT(*) AS count FROM %s AS bot WHERE META(bot).id LIKE $1", s.bucketIdentifier())
+	query := couchbase.NewN1qlQuery(queryStr)
+	res, err := s.bucket.ExecuteN1qlQuery(query, []interface{}{prefix + "%"})
+	if err != nil {
+		return
+	}
+
+	c := couchcount{}
+	err = res.One(&c)
+	count = c.Count
+	return
+}
+
+// bucketIdentifier returns escaped bucket name for use in N1QL statements
+func (s *CouchbaseStore) bucketIdentifier() string {
+	return quoteN1qlIdentifier(s.bucketName)
+}
+
+// quoteN1qlIdentifier escapes name as N1QL identifier
+func quoteN1qlIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// userN1qlQuery returns N1QL statement and positional parameters for user lookup.
+// User input goes to parameters only and never to statement text.
+func userN1qlQuery(bucket string, q userQuery) (statement string, params []interface{}) {
+	statement = fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='user'", bucket)
+	switch {
+	case q.UserName != "":
+		statement += " AND username=$1"
+		params = []interface{}{q.UserName}
+	case q.LastName != "":
+		statement += " AND first_name=$1 AND last_name=$2"
+		params = []interface{}{q.FirstName, q.LastName}
+	default:
+		statement += " AND first_name=$1"
+		params = []interface{}{q.FirstName}
+	}
+	return
+}
+
+// messagesPageN1qlQuery function returns N1QL statement and params for GetMessagesPage
+func messagesPageN1qlQuery(bucket string, chatID int64, beginTime, endTime time.Time, after MessageCursor, limit int) (statement string, params []interface{}) {
+	statement = fmt.Sprintf("SELECT * FROM %s AS bot WHERE type='message' AND chat.id=$1 AND date >= $2 AND date <= $3"+
+		" AND (date > $4 OR (date = $4 AND message_id > $5)) ORDER BY date, message_id LIMIT $6", bucket)
+	params = []interface{}{chatID, beginTime.Unix(), endTime.Unix(), after.Date, after.MessageID, limit}
+	return
+}
+
+// chatAuthorsN1qlQuery function returns N1QL statement and params for GetChatAuthors
+func chatAuthorsN1qlQuery(bucket string, chatID int64) (statement string, params []interface{}) {
+	statement = fmt.Sprintf("SELECT DISTINCT bot.`from`.id AS from_id, bot.forward_from.id AS forward_from_id"+
+		" FROM %s AS bot WHERE type='message' AND chat.id=$1", bucket)
+	params = []interface{}{chatID}
+	return
+}
+
+// userChatsN1qlQuery function returns N1QL statement and params for GetUserChats
+func userChatsN1qlQuery(bucket string, userID int) (statement string, params []interface{}) {
+	statement = fmt.Sprintf("SELECT bot.chat.id AS chat_id, COUNT(*) AS messages, MAX(bot.date) AS last_date"+
+		" FROM %s AS bot WHERE type='message' AND (bot.`from`.id=$1 OR bot.forward_from.id=$1) GROUP BY bot.chat.id", bucket)
+	params = []interface{}{userID}
+	return
+}
+
+// convertError converts couchbase specific errors to db package errors
+func convertError(err error) error {
+	if err == couchbase.ErrKeyNotFound {
+		return ErrNotFound
+	}
+	return err
+}
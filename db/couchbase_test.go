@@ -0,0 +1,120 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// hostileInputs are GetUser arguments with quotes and N1QL keywords
+var hostileInputs = []string{
+	"@x' OR '1'='1",
+	"x'OR'1'='1",
+	"@`default`",
+	"`default`",
+	"@x UNION SELECT * FROM system:keyspaces",
+	"UNION SELECT",
+	"Robert');DELETE",
+	"@a\" OR \"1\"=\"1",
+	"$1 $2",
+}
+
+func TestUserN1qlQuery(t *testing.T) {
+	const (
+		byUserName = "SELECT * FROM `default` AS bot WHERE type='user' AND username=$1"
+		byFullName = "SELECT * FROM `default` AS bot WHERE type='user' AND first_name=$1 AND last_name=$2"
+		byName     = "SELECT * FROM `default` AS bot WHERE type='user' AND first_name=$1"
+	)
+	// statement text does not depend on user input, input goes to params only
+	tests := []struct {
+		input     string
+		statement string
+		params    []interface{}
+	}{
+		{"@x' OR '1'='1", byUserName, []interface{}{"x' OR '1'='1"}},
+		{"x'OR'1'='1", byName, []interface{}{"x'OR'1'='1"}},
+		{"@`default`", byUserName, []interface{}{"`default`"}},
+		{"`default`", byName, []interface{}{"`default`"}},
+		{"@x UNION SELECT * FROM system:keyspaces", byUserName, []interface{}{"x UNION SELECT * FROM system:keyspaces"}},
+		{"UNION SELECT", byFullName, []interface{}{"UNION", "SELECT"}},
+		{"Robert');DELETE", byName, []interface{}{"Robert');DELETE"}},
+		{"@a\" OR \"1\"=\"1", byUserName, []interface{}{"a\" OR \"1\"=\"1"}},
+		{"$1 $2", byFullName, []interface{}{"$1", "$2"}},
+	}
+	if len(tests) != len(hostileInputs) {
+		t.Fatalf("%d cases for %d hostile inputs", len(tests), len(hostileInputs))
+	}
+	for _, test := range tests {
+		q, err := parseUserQuery(test.input)
+		if err != nil {
+			t.Fatalf("parseUserQuery(%q) returns error: %s", test.input, err)
+		}
+		statement, params := userN1qlQuery(quoteN1qlIdentifier("default"), q)
+		checkN1qlQuery(t, test.input, statement, params, test.statement, test.params)
+	}
+}
+
+func TestQuoteN1qlIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"default", "`default`"},
+		{"bot-logs", "`bot-logs`"},
+		{"my`bucket", "`my``bucket`"},
+		{"` UNION SELECT * FROM system:keyspaces --", "``` UNION SELECT * FROM system:keyspaces --`"},
+		{"``", "``````"},
+	}
+	for _, test := range tests {
+		if quoted := quoteN1qlIdentifier(test.name); quoted != test.expected {
+			t.Errorf("quoteN1qlIdentifier(%q) = %q, expected %q", test.name, quoted, test.expected)
+		}
+	}
+}
+
+func TestUserN1qlQueryBucketName(t *testing.T) {
+	q, err := parseUserQuery("@user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, _ := userN1qlQuery(quoteN1qlIdentifier("logs` WHERE 1=1 --"), q)
+	expected := "SELECT * FROM `logs`` WHERE 1=1 --` AS bot WHERE type='user' AND username=$1"
+	if statement != expected {
+		t.Errorf("statement %q, expected %q", statement, expected)
+	}
+}
+
+func TestMessagesN1qlQueries(t *testing.T) {
+	bucket := quoteN1qlIdentifier("default")
+	begin, end := time.Unix(100, 0), time.Unix(200, 0)
+
+	statement, params := messagesPageN1qlQuery(bucket, -5, begin, end, MessageCursor{Date: 150, MessageID: 7}, 51)
+	expected := "SELECT * FROM `default` AS bot WHERE type='message' AND chat.id=$1 AND date >= $2 AND date <= $3" +
+		" AND (date > $4 OR (date = $4 AND message_id > $5)) ORDER BY date, message_id LIMIT $6"
+	checkN1qlQuery(t, "messagesPageN1qlQuery", statement, params, expected, []interface{}{int64(-5), int64(100), int64(200), 150, 7, 51})
+
+	statement, params = chatAuthorsN1qlQuery(bucket, -5)
+	expected = "SELECT DISTINCT bot.`from`.id AS from_id, bot.forward_from.id AS forward_from_id" +
+		" FROM `default` AS bot WHERE type='message' AND chat.id=$1"
+	checkN1qlQuery(t, "chatAuthorsN1qlQuery", statement, params, expected, []interface{}{int64(-5)})
+
+	statement, params = userChatsN1qlQuery(bucket, 3)
+	expected = "SELECT bot.chat.id AS chat_id, COUNT(*) AS messages, MAX(bot.date) AS last_date" +
+		" FROM `default` AS bot WHERE type='message' AND (bot.`from`.id=$1 OR bot.forward_from.id=$1) GROUP BY bot.chat.id"
+	checkN1qlQuery(t, "userChatsN1qlQuery", statement, params, expected, []interface{}{3})
+}
+
+// checkN1qlQuery compares statement and params with expected ones
+func checkN1qlQuery(t *testing.T, name, statement string, params []interface{}, expected string, values []interface{}) {
+	if statement != expected {
+		t.Errorf("%s: statement %q, expected %q", name, statement, expected)
+	}
+	if len(params) != len(values) {
+		t.Errorf("%s: params %v, expected %v", name, params, values)
+		return
+	}
+	for i := range values {
+		if params[i] != values[i] {
+			t.Errorf("%s: param $%d is %#v, expected %#v", name, i+1, params[i], values[i])
+		}
+	}
+}
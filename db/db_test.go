@@ -0,0 +1,765 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// newTestStores returns memory and sqlite stores, cleanup closes and removes sqlite database
+func newTestStores(t *testing.T) (stores map[string]Store, cleanup func()) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := NewSQLiteStore(filepath.Join(dir, "bot.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	stores = map[string]Store{
+		"memory": NewMemoryStore(),
+		"sqlite": sqlite,
+	}
+	return stores, func() {
+		sqlite.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetUserHostileInput(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, s := range stores {
+		other := &tgbotapi.User{ID: 1, FirstName: "Ivan", LastName: "Petrov", UserName: "ivan"}
+		if err := s.SaveUser(other); err != nil {
+			t.Fatalf("%s: SaveUser: %s", name, err)
+		}
+
+		// nobody matches hostile input
+		for _, input := range hostileInputs {
+			user, err := s.GetUser(input)
+			if _, notFound := err.(*UserNotFoundError); !notFound || user != nil {
+				t.Errorf("%s: GetUser(%q) = %v, %v, expected not found", name, input, user, err)
+			}
+		}
+
+		// users with hostile names are found by exact match only
+		for i, input := range hostileInputs {
+			q, err := parseUserQuery(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := &tgbotapi.User{ID: 100 + i, UserName: q.UserName, FirstName: q.FirstName, LastName: q.LastName}
+			if saved.FirstName == "" {
+				saved.FirstName = "User"
+			}
+			if err = s.SaveUser(saved); err != nil {
+				t.Fatalf("%s: SaveUser: %s", name, err)
+			}
+			user, err := s.GetUser(input)
+			if err != nil {
+				t.Errorf("%s: GetUser(%q) returns error: %s", name, input, strings.Replace(err.Error(), "\n", " ", -1))
+				continue
+			}
+			if user.ID != saved.ID {
+				t.Errorf("%s: GetUser(%q) returns user %d, expected %d", name, input, user.ID, saved.ID)
+			}
+		}
+
+		users, err := s.GetUsers()
+		if err != nil {
+			t.Fatalf("%s: GetUsers: %s", name, err)
+		}
+		if len(users) != len(hostileInputs)+1 {
+			t.Errorf("%s: %d users, expected %d", name, len(users), len(hostileInputs)+1)
+		}
+	}
+}
+
+func TestCaptions(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, s := range stores {
+		if _, err := s.GetCaption(-5, 1); err != ErrNotFound {
+			t.Errorf("%s: GetCaption of unknown message returns %v", name, err)
+		}
+		caption := &Caption{ChatID: -5, MessageID: 1, Entities: []tgbotapi.MessageEntity{{Type: "bold", Offset: 0, Length: 1}}}
+		if err := s.SaveCaption(caption); err != nil {
+			t.Fatalf("%s: SaveCaption: %s", name, err)
+		}
+		// edited caption replaces entities
+		if err := s.SaveCaption(&Caption{ChatID: -5, MessageID: 1}); err != nil {
+			t.Fatalf("%s: SaveCaption: %s", name, err)
+		}
+		saved, err := s.GetCaption(-5, 1)
+		if err != nil || saved.ChatID != -5 || saved.MessageID != 1 || len(saved.Entities) != 0 {
+			t.Errorf("%s: GetCaption returns %+v, %v", name, saved, err)
+		}
+
+		importer := s.(Importer)
+		doc := Document{Key: "caption:-5:2", Data: []byte(`{"chat_id":-5,"message_id":2,"entities":[{"type":"italic","offset":0,"length":2}]}`)}
+		if err = importer.ImportDocument(doc); err != nil {
+			t.Fatalf("%s: ImportDocument: %s", name, err)
+		}
+		if saved, err = s.GetCaption(-5, 2); err != nil || len(saved.Entities) != 1 || saved.Entities[0].Type != "italic" {
+			t.Errorf("%s: imported caption is %+v, %v", name, saved, err)
+		}
+		if count, err := importer.CountDocuments("caption:"); err != nil || count != 2 {
+			t.Errorf("%s: CountDocuments returns %d, %v", name, count, err)
+		}
+	}
+}
+
+func TestGetMessagesPage(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	other := &tgbotapi.Chat{ID: -6, Type: "group"}
+	base := int(time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC).Unix())
+	dates := map[int]int{5: base, 2: base, 7: base + 1, 1: base + 1, 3: base + 1, 6: base + 2, 4: base + 3, 8: base + 86400}
+	begin, end := time.Unix(int64(base), 0), time.Unix(int64(base+3), 0)
+
+	tests := []struct {
+		name     string
+		after    MessageCursor
+		limit    int
+		expected string
+	}{
+		{"first page", MessageCursor{}, 3, "[2 5 1]"},
+		{"cursor inside of date", MessageCursor{Date: base + 1, MessageID: 1}, 3, "[3 7 6]"},
+		{"cursor at last message of date", MessageCursor{Date: base + 1, MessageID: 7}, 3, "[6 4]"},
+		{"cursor between IDs", MessageCursor{Date: base, MessageID: 3}, 2, "[5 1]"},
+		{"all messages", MessageCursor{}, 100, "[2 5 1 3 7 6 4]"},
+		{"after last message", MessageCursor{Date: base + 3, MessageID: 4}, 3, "[]"},
+	}
+	for name, s := range stores {
+		for id, date := range dates {
+			if err := s.SaveMessage(&tgbotapi.Message{MessageID: id, Date: date, Chat: chat}); err != nil {
+				t.Fatalf("%s: SaveMessage: %s", name, err)
+			}
+		}
+		s.SaveMessage(&tgbotapi.Message{MessageID: 9, Date: base, Chat: other})
+
+		for _, test := range tests {
+			msgs, err := s.GetMessagesPage(chat.ID, begin, end, test.after, test.limit)
+			if err != nil {
+				t.Fatalf("%s: %s: GetMessagesPage: %s", name, test.name, err)
+			}
+			ids := []int{}
+			for _, msg := range msgs {
+				ids = append(ids, msg.MessageID)
+			}
+			if fmt.Sprint(ids) != test.expected {
+				t.Errorf("%s: %s: messages %v, expected %s", name, test.name, ids, test.expected)
+			}
+		}
+	}
+}
+
+func TestMessageAuthors(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	other := &tgbotapi.Chat{ID: -6, Type: "group"}
+	channel := &tgbotapi.Chat{ID: -100, Type: "channel"}
+	msgs := []*tgbotapi.Message{
+		{MessageID: 1, Date: 10, Chat: chat, From: &tgbotapi.User{ID: 3}},
+		{MessageID: 2, Date: 30, Chat: chat, From: &tgbotapi.User{ID: 3}},
+		{MessageID: 3, Date: 20, Chat: chat, From: &tgbotapi.User{ID: 4}, ForwardFrom: &tgbotapi.User{ID: 3}},
+		{MessageID: 1, Date: 5, Chat: other, From: &tgbotapi.User{ID: 4}, ForwardFrom: &tgbotapi.User{ID: 5}},
+		{MessageID: 1, Date: 5, Chat: channel},
+	}
+
+	for name, s := range stores {
+		for _, msg := range msgs {
+			if err := s.SaveMessage(msg); err != nil {
+				t.Fatalf("%s: SaveMessage: %s", name, err)
+			}
+		}
+
+		for chatID, expected := range map[int64]string{-5: "[3 4]", -6: "[4 5]", -100: "[]", -7: "[]"} {
+			authors, err := s.GetChatAuthors(chatID)
+			if err != nil {
+				t.Fatalf("%s: GetChatAuthors: %s", name, err)
+			}
+			if authors == nil {
+				authors = []int{}
+			}
+			if fmt.Sprint(authors) != expected {
+				t.Errorf("%s: authors of chat %d are %v, expected %s", name, chatID, authors, expected)
+			}
+		}
+
+		for userID, expected := range map[int]string{
+			3: "[{-5 3 30}]",
+			4: "[{-6 1 5} {-5 1 20}]",
+			5: "[{-6 1 5}]",
+			6: "[]",
+		} {
+			chats, err := s.GetUserChats(userID)
+			if err != nil {
+				t.Fatalf("%s: GetUserChats: %s", name, err)
+			}
+			var list []UserChat
+			for _, chat := range chats {
+				list = append(list, *chat)
+			}
+			if list == nil {
+				list = []UserChat{}
+			}
+			if fmt.Sprint(list) != expected {
+				t.Errorf("%s: chats of user %d are %v, expected %s", name, userID, list, expected)
+			}
+		}
+	}
+}
+
+func TestFillMessageAuthors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bot.db")
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	for id := 1; id <= 3; id++ {
+		s.SaveMessage(&tgbotapi.Message{MessageID: id, Date: id, Chat: chat, From: &tgbotapi.User{ID: 10 + id}})
+	}
+	// messages saved before author columns
+	if _, err = s.db.Exec(`UPDATE messages SET from_id = NULL, forward_from_id = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.db.Exec(`INSERT INTO messages (chat_id, message_id, date, data) VALUES (-5, 4, 4, 'broken')`); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if s, err = NewSQLiteStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	authors, err := s.GetChatAuthors(chat.ID)
+	if err != nil || fmt.Sprint(authors) != "[11 12 13]" {
+		t.Errorf("Authors of old messages are %v, %v", authors, err)
+	}
+	var unfilled int
+	s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE from_id IS NULL`).Scan(&unfilled)
+	if unfilled != 0 {
+		t.Errorf("%d messages without authors", unfilled)
+	}
+}
+
+// backends are interchangeable stores, couchbase is a migration source, others are targets
+var (
+	_ Store    = (*MemoryStore)(nil)
+	_ Store    = (*SQLiteStore)(nil)
+	_ Store    = (*CouchbaseStore)(nil)
+	_ Exporter = (*CouchbaseStore)(nil)
+	_ Importer = (*MemoryStore)(nil)
+	_ Importer = (*SQLiteStore)(nil)
+)
+
+func TestStoreContract(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, s := range stores {
+		user := &tgbotapi.User{ID: 1, FirstName: "Ivan", UserName: "ivan"}
+		if _, err := s.GetUserByID(1); err != ErrNotFound {
+			t.Errorf("%s: GetUserByID of unknown user returns %v", name, err)
+		}
+		if err := s.SaveUser(user); err != nil {
+			t.Fatalf("%s: SaveUser: %s", name, err)
+		}
+		user.FirstName = "Ivan Jr"
+		s.SaveUser(user)
+		if saved, err := s.GetUserByID(1); err != nil || saved.FirstName != "Ivan Jr" {
+			t.Errorf("%s: GetUserByID returns %+v, %v", name, saved, err)
+		}
+		if users, err := s.GetUsers(); err != nil || len(users) != 1 {
+			t.Errorf("%s: GetUsers returns %v, %v", name, users, err)
+		}
+
+		// forwarded chat is hidden until bot gets messages of it
+		group := &tgbotapi.Chat{ID: -5, Type: "group", Title: "Group"}
+		channel := &tgbotapi.Chat{ID: -100, Type: "channel", Title: "Channel"}
+		s.SaveChat(group, false)
+		s.SaveChat(channel, true)
+		if chats, err := s.GetChats(); err != nil || len(chats) != 1 || chats[0].ID != -5 {
+			t.Errorf("%s: GetChats with forwarded chat returns %v, %v", name, chats, err)
+		}
+		s.SaveChat(channel, false)
+		s.SaveChat(channel, true)
+		if chats, err := s.GetChats(); err != nil || len(chats) != 2 {
+			t.Errorf("%s: GetChats returns %v, %v", name, chats, err)
+		}
+
+		if _, err := s.GetFile("f", -5); err != ErrNotFound {
+			t.Errorf("%s: GetFile of unknown file returns %v", name, err)
+		}
+		s.SaveFile(&tgbotapi.File{FileID: "f", FilePath: "photos/f.jpg"}, -5)
+		if f, err := s.GetFile("f", -5); err != nil || f.FilePath != "photos/f.jpg" {
+			t.Errorf("%s: GetFile returns %+v, %v", name, f, err)
+		}
+		if _, err := s.GetFile("f", -6); err != ErrNotFound {
+			t.Errorf("%s: file is found in other chat: %v", name, err)
+		}
+
+		if _, err := s.GetWarnLevel(user); err != ErrNotFound {
+			t.Errorf("%s: GetWarnLevel without warns returns %v", name, err)
+		}
+		for i := 1; i <= 3; i++ {
+			if level, err := s.AddWarnLevel(user); err != nil || level != i {
+				t.Errorf("%s: AddWarnLevel returns %d, %v, expected %d", name, level, err, i)
+			}
+		}
+		if err := s.ClearWarnLevel(user); err != nil {
+			t.Errorf("%s: ClearWarnLevel: %s", name, err)
+		}
+		if err := s.ClearWarnLevel(user); err != ErrNotFound {
+			t.Errorf("%s: ClearWarnLevel without warns returns %v", name, err)
+		}
+		if level, err := s.AddCensLevel(user); err != nil || level != 1 {
+			t.Errorf("%s: AddCensLevel returns %d, %v", name, level, err)
+		}
+		s.SetCensLevel(user, 5)
+		if level, err := s.GetCensLevel(user); err != nil || level != 5 {
+			t.Errorf("%s: GetCensLevel returns %d, %v", name, level, err)
+		}
+
+		if offset, err := s.GetUpdateOffset(); err != nil || offset != 0 {
+			t.Errorf("%s: GetUpdateOffset of new store returns %d, %v", name, offset, err)
+		}
+		s.SaveUpdateOffset(10)
+		s.SaveUpdateOffset(12)
+		if offset, err := s.GetUpdateOffset(); err != nil || offset != 12 {
+			t.Errorf("%s: GetUpdateOffset returns %d, %v", name, offset, err)
+		}
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bot.db")
+
+	// database of first version with message
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(sqliteMigrations[0] + `;
+		PRAGMA user_version = 1;
+		INSERT INTO messages (chat_id, message_id, date, data) VALUES
+			(-5, 1, 1500000000, '{"message_id":1,"date":1500000000,"chat":{"id":-5,"type":"group"},"from":{"id":3},"text":"old"}');
+		INSERT INTO chats (id, type, data) VALUES (-5, 'chat', '{"id":-5,"type":"group","title":"Old"}');`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Old database is not migrated: %s", err)
+	}
+	var version int
+	s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if version != len(sqliteMigrations) {
+		t.Errorf("Schema version is %d, expected %d", version, len(sqliteMigrations))
+	}
+
+	msgs, err := s.GetMessages(-5)
+	if err != nil || len(msgs) != 1 || msgs[0].Text != "old" {
+		t.Errorf("Old messages are %v, %v", msgs, err)
+	}
+	if chats, err := s.GetChats(); err != nil || len(chats) != 1 || chats[0].Title != "Old" {
+		t.Errorf("Old chats are %v, %v", chats, err)
+	}
+	if authors, err := s.GetChatAuthors(-5); err != nil || fmt.Sprint(authors) != "[3]" {
+		t.Errorf("Authors of old messages are %v, %v", authors, err)
+	}
+	// tables of new versions are available
+	if err = s.SaveChatRole(&ChatRole{ChatID: -5, UserID: 3, Role: "trusted"}); err != nil {
+		t.Errorf("SaveChatRole after migration: %s", err)
+	}
+	if err = s.SaveSanction(&Sanction{ChatID: -5, UserID: 3, Kind: "mute"}); err != nil {
+		t.Errorf("SaveSanction after migration: %s", err)
+	}
+	s.Close()
+
+	// migrated database is opened without migrations
+	if s, err = NewSQLiteStore(path); err != nil {
+		t.Fatalf("Migrated database is not opened: %s", err)
+	}
+	defer s.Close()
+	if roles, err := s.GetChatRoles(-5); err != nil || len(roles) != 1 {
+		t.Errorf("Roles after reopen are %v, %v", roles, err)
+	}
+}
+
+// resetCaches drops date caches of store, so dates are read from messages
+func resetCaches(s Store) {
+	switch store := s.(type) {
+	case *MemoryStore:
+		store.caches = make(Caches)
+	case *SQLiteStore:
+		store.caches = make(Caches)
+	}
+}
+
+func TestDateQueries(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	other := &tgbotapi.Chat{ID: -6, Type: "group"}
+	dates := []time.Time{
+		time.Date(2016, 12, 31, 23, 0, 0, 0, time.Local),
+		time.Date(2017, 1, 1, 10, 0, 0, 0, time.Local),
+		time.Date(2017, 1, 15, 12, 0, 0, 0, time.Local),
+		time.Date(2017, 3, 2, 8, 0, 0, 0, time.Local),
+		time.Date(2017, 3, 2, 9, 0, 0, 0, time.Local),
+	}
+	queries := map[string]func(s Store) (interface{}, error){
+		"years":           func(s Store) (interface{}, error) { return s.GetYears(-5) },
+		"months of 2017":  func(s Store) (interface{}, error) { return s.GetMonthList(-5, 2017) },
+		"months of 2016":  func(s Store) (interface{}, error) { return s.GetMonthList(-5, 2016) },
+		"days of 2017-01": func(s Store) (interface{}, error) { return s.GetDates(-5, 2017, 1) },
+		"days of 2017-03": func(s Store) (interface{}, error) { return s.GetDates(-5, 2017, 3) },
+		"days of 2017-02": func(s Store) (interface{}, error) { return s.GetDates(-5, 2017, 2) },
+		"days of 2016-12": func(s Store) (interface{}, error) { return s.GetDates(-5, 2016, 12) },
+		"messages of 2017-01": func(s Store) (interface{}, error) {
+			msgs, err := s.GetMessagesByDate(-5, dates[1].Add(-10*time.Hour), time.Date(2017, 1, 31, 23, 59, 59, 0, time.Local))
+			var ids []int
+			for _, msg := range msgs {
+				ids = append(ids, msg.MessageID)
+			}
+			return ids, err
+		},
+	}
+	expected := map[string]string{
+		"years":               "[2016 2017]",
+		"months of 2017":      "[January March]",
+		"months of 2016":      "[December]",
+		"days of 2017-01":     "[1 15]",
+		"days of 2017-03":     "[2]",
+		"days of 2017-02":     "[]",
+		"days of 2016-12":     "[31]",
+		"messages of 2017-01": "[2 3]",
+	}
+
+	for name, s := range stores {
+		for i, date := range dates {
+			if err := s.SaveMessage(&tgbotapi.Message{MessageID: i + 1, Date: int(date.Unix()), Chat: chat}); err != nil {
+				t.Fatalf("%s: SaveMessage: %s", name, err)
+			}
+		}
+		s.SaveMessage(&tgbotapi.Message{MessageID: 1, Date: int(time.Date(2018, 6, 1, 0, 0, 0, 0, time.Local).Unix()), Chat: other})
+
+		// dates are read from messages without cache
+		for query, fn := range queries {
+			resetCaches(s)
+			result, err := fn(s)
+			if err != nil {
+				t.Fatalf("%s: %s: %s", name, query, err)
+			}
+			if actual := fmt.Sprint(result); actual != expected[query] {
+				t.Errorf("%s: %s without cache are %s, expected %s", name, query, actual, expected[query])
+			}
+		}
+
+		// cache is filled in background, so it is checked until timeout
+		deadline := time.Now().Add(time.Second * 5)
+		for query, fn := range queries {
+			for {
+				result, err := fn(s)
+				actual := fmt.Sprint(result)
+				if err == nil && actual == expected[query] {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Errorf("%s: %s with cache are %s, %v, expected %s", name, query, actual, err, expected[query])
+					break
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+		}
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	const writers, messages = 4, 25
+	base := int(time.Date(2017, 5, 1, 12, 0, 0, 0, time.Local).Unix())
+	for name, s := range stores {
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*messages*2)
+		for w := 0; w < writers; w++ {
+			wg.Add(2)
+			go func(w int) {
+				defer wg.Done()
+				user := &tgbotapi.User{ID: w + 1, FirstName: fmt.Sprintf("user%d", w)}
+				for i := 0; i < messages; i++ {
+					msg := &tgbotapi.Message{MessageID: w*messages + i + 1, Date: base + i, From: user,
+						Chat: &tgbotapi.Chat{ID: -5, Type: "group"}}
+					if err := s.SaveMessage(msg); err != nil {
+						errs <- err
+					}
+					if _, err := s.AddWarnLevel(user); err != nil {
+						errs <- err
+					}
+				}
+			}(w)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < messages; i++ {
+					if _, err := s.GetMessagesByDate(-5, time.Unix(int64(base), 0), time.Unix(int64(base+messages), 0)); err != nil {
+						errs <- err
+					}
+					if _, err := s.GetYears(-5); err != nil {
+						errs <- err
+					}
+					if _, err := s.GetUsers(); err != nil {
+						errs <- err
+					}
+					if _, err := s.GetChatAuthors(-5); err != nil {
+						errs <- err
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		msgs, err := s.GetMessages(-5)
+		if err != nil || len(msgs) != writers*messages {
+			t.Errorf("%s: %d messages are saved, %v", name, len(msgs), err)
+		}
+		for w := 0; w < writers; w++ {
+			if level, err := s.GetWarnLevel(&tgbotapi.User{ID: w + 1}); err != nil || level != messages {
+				t.Errorf("%s: warn level of user %d is %d, %v", name, w+1, level, err)
+			}
+		}
+	}
+}
+
+func TestMessageRevisions(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	for name, s := range stores {
+		if err := s.SaveMessage(&tgbotapi.Message{MessageID: 1, Date: 1000, Chat: chat, Text: "original"}); err != nil {
+			t.Fatalf("%s: SaveMessage: %s", name, err)
+		}
+		if revisions, err := s.GetMessageRevisions(-5, 1); err != nil || len(revisions) != 0 {
+			t.Errorf("%s: not edited message has revisions %v, %v", name, revisions, err)
+		}
+
+		// original is saved as first revision on first edit only
+		edits := []*tgbotapi.Message{
+			{MessageID: 1, Date: 1000, EditDate: 1010, Chat: chat, Text: "first edit"},
+			{MessageID: 1, Date: 1000, EditDate: 1020, Chat: chat, Text: "second edit"},
+			// Telegram may send the same edit again
+			{MessageID: 1, Date: 1000, EditDate: 1020, Chat: chat, Text: "second edit"},
+		}
+		for _, msg := range edits {
+			if err := s.SaveEditedMessage(msg); err != nil {
+				t.Fatalf("%s: SaveEditedMessage: %s", name, err)
+			}
+		}
+
+		revisions, err := s.GetMessageRevisions(-5, 1)
+		if err != nil {
+			t.Fatalf("%s: GetMessageRevisions: %s", name, err)
+		}
+		var texts []string
+		for _, r := range revisions {
+			texts = append(texts, fmt.Sprintf("%d %s", r.Date, r.Message.Text))
+		}
+		if strings.Join(texts, ", ") != "1000 original, 1010 first edit, 1020 second edit" {
+			t.Errorf("%s: revisions are %q", name, texts)
+		}
+
+		msgs, err := s.GetMessages(-5)
+		if err != nil || len(msgs) != 1 || msgs[0].Text != "second edit" || msgs[0].EditDate != 1020 {
+			t.Errorf("%s: edited message is not replaced: %v, %v", name, msgs, err)
+		}
+
+		// edit of unknown message has no original revision
+		if err = s.SaveEditedMessage(&tgbotapi.Message{MessageID: 2, Date: 1000, EditDate: 1030, Chat: chat, Text: "edit"}); err != nil {
+			t.Fatalf("%s: SaveEditedMessage: %s", name, err)
+		}
+		if revisions, err = s.GetMessageRevisions(-5, 2); err != nil || len(revisions) != 1 || revisions[0].Date != 1030 {
+			t.Errorf("%s: revisions of unknown message are %v, %v", name, revisions, err)
+		}
+	}
+}
+
+func TestWebLinks(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, s := range stores {
+		first, token, err := NewWebLink(-5, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first.CreatedAt -= 10
+		second, _, _ := NewWebLink(-5, 2, time.Hour)
+		other, _, _ := NewWebLink(-6, 1, 0)
+		for _, link := range []*WebLink{second, first, other} {
+			if err = s.SaveWebLink(link); err != nil {
+				t.Fatalf("%s: SaveWebLink: %s", name, err)
+			}
+		}
+
+		// only hash of token is stored
+		if first.Hash == token || first.Hash != WebLinkHash(token) {
+			t.Errorf("%s: bad hash of token", name)
+		}
+		link, err := s.GetWebLink(WebLinkHash(token))
+		if err != nil || *link != *first {
+			t.Errorf("%s: GetWebLink returns %+v, %v", name, link, err)
+		}
+		if _, err = s.GetWebLink(WebLinkHash("unknown")); err != ErrNotFound {
+			t.Errorf("%s: GetWebLink of unknown token returns %v", name, err)
+		}
+
+		first.Revoked = true
+		if err = s.SaveWebLink(first); err != nil {
+			t.Fatalf("%s: SaveWebLink: %s", name, err)
+		}
+		links, err := s.GetWebLinks(-5)
+		if err != nil || len(links) != 2 || *links[0] != *first || *links[1] != *second {
+			t.Errorf("%s: GetWebLinks returns %v, %v", name, links, err)
+		}
+	}
+}
+
+func TestWebLinkActive(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		link   WebLink
+		active bool
+	}{
+		{WebLink{}, true},
+		{WebLink{ExpiresAt: now.Unix() + 1}, true},
+		{WebLink{ExpiresAt: now.Unix()}, false},
+		{WebLink{ExpiresAt: now.Unix() - 1}, false},
+		{WebLink{Revoked: true}, false},
+		{WebLink{ExpiresAt: now.Unix() + 1, Revoked: true}, false},
+	}
+	for _, test := range tests {
+		if active := test.link.Active(now); active != test.active {
+			t.Errorf("Active of %+v is %t", test.link, active)
+		}
+	}
+}
+
+func TestMediaRefs(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	refs := []*MediaRef{
+		{ChatID: -6, FileID: "a", Hash: "00ff", Path: "media/00/00ff.jpg", Size: 4},
+		{ChatID: -5, FileID: "b", Hash: "00ff", Path: "media/00/00ff.jpg", Size: 4},
+		{ChatID: -5, FileID: "a", Hash: "11ee", Path: "media/11/11ee.ogg", Size: 6},
+	}
+	for name, s := range stores {
+		for _, ref := range refs {
+			if err := s.SaveMediaRef(ref); err != nil {
+				t.Fatalf("%s: SaveMediaRef: %s", name, err)
+			}
+		}
+		// thumbnail is added to saved ref
+		thumb := *refs[2]
+		thumb.Thumb = "media/22/22dd.jpg"
+		if err := s.SaveMediaRef(&thumb); err != nil {
+			t.Fatalf("%s: SaveMediaRef: %s", name, err)
+		}
+
+		ref, err := s.GetMediaRef(-5, "a")
+		if err != nil || *ref != thumb {
+			t.Errorf("%s: GetMediaRef returns %+v, %v", name, ref, err)
+		}
+		if _, err = s.GetMediaRef(-7, "a"); err != ErrNotFound {
+			t.Errorf("%s: GetMediaRef of unknown file returns %v", name, err)
+		}
+		saved, err := s.GetMediaRefs()
+		if err != nil || len(saved) != 3 || *saved[0] != *refs[0] || *saved[1] != thumb || *saved[2] != *refs[1] {
+			t.Errorf("%s: GetMediaRefs returns %v, %v", name, saved, err)
+		}
+	}
+}
+
+func TestSanctions(t *testing.T) {
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, s := range stores {
+		sanctions := []*Sanction{
+			{ChatID: -5, UserID: 1, Kind: SanctionMute},
+			{ChatID: -5, UserID: 2, Kind: SanctionBan, Until: 300},
+			{ChatID: -5, UserID: 1, Kind: SanctionRestrict, Restriction: "media", Until: 200},
+			{ChatID: -6, UserID: 1, Kind: SanctionMute, Until: 100, CreatedBy: 3, CreatedAt: 50},
+		}
+		for _, sanction := range sanctions {
+			if err := s.SaveSanction(sanction); err != nil {
+				t.Fatalf("%s: SaveSanction: %s", name, err)
+			}
+		}
+		// sanction of the same kind replaces previous one
+		sanctions[2].Restriction = "stickers"
+		if err := s.SaveSanction(sanctions[2]); err != nil {
+			t.Fatalf("%s: SaveSanction: %s", name, err)
+		}
+
+		// sanctions are sorted by lift time, permanent ones go last
+		list, err := s.GetSanctions()
+		if err != nil || len(list) != 4 {
+			t.Fatalf("%s: GetSanctions returns %v, %v", name, list, err)
+		}
+		for i, j := range []int{3, 2, 1, 0} {
+			if *list[i] != *sanctions[j] {
+				t.Errorf("%s: sanction %d is %+v, expected %+v", name, i, list[i], sanctions[j])
+			}
+		}
+
+		if err = s.DeleteSanction(-5, 1, SanctionRestrict); err != nil {
+			t.Errorf("%s: DeleteSanction: %s", name, err)
+		}
+		if err = s.DeleteSanction(-5, 1, SanctionRestrict); err != ErrNotFound {
+			t.Errorf("%s: DeleteSanction of deleted sanction returns %v", name, err)
+		}
+		if list, _ = s.GetSanctions(); len(list) != 3 || list[1].UserID != 2 {
+			t.Errorf("%s: GetSanctions after delete returns %v", name, list)
+		}
+	}
+}
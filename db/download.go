@@ -0,0 +1,23 @@
+package db
+
+import "sort"
+
+// FailedDownload is a file which was not downloaded after all retries, records download:chat_id:file_id.
+// Failed downloads are retried later.
+type FailedDownload struct {
+	ChatID   int64  `json:"chat_id"`
+	FileID   string `json:"file_id"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+	FailedAt int64  `json:"failed_at"`
+}
+
+// sortFailedDownloads sorts failed downloads from old to new ones
+func sortFailedDownloads(downloads []*FailedDownload) {
+	sort.Slice(downloads, func(i, j int) bool {
+		if downloads[i].FailedAt != downloads[j].FailedAt {
+			return downloads[i].FailedAt < downloads[j].FailedAt
+		}
+		return downloads[i].FileID < downloads[j].FileID
+	})
+}
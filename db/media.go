@@ -0,0 +1,24 @@
+package db
+
+import "sort"
+
+// MediaRef links file of chat with stored content, records media:chat_id:file_id.
+// Content is stored once by SHA-256 hash, so many refs may have the same hash.
+type MediaRef struct {
+	ChatID int64  `json:"chat_id"`
+	FileID string `json:"file_id"`
+	Hash   string `json:"hash"`
+	Path   string `json:"path"` // path of content relative to static dir
+	Size   int64  `json:"size"`
+	Thumb  string `json:"thumb,omitempty"` // path of thumbnail for images
+}
+
+// sortMediaRefs sorts refs by chat and file ID
+func sortMediaRefs(refs []*MediaRef) {
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].ChatID != refs[j].ChatID {
+			return refs[i].ChatID < refs[j].ChatID
+		}
+		return refs[i].FileID < refs[j].FileID
+	})
+}
@@ -0,0 +1,760 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// MemoryStore is a thread-safe Store implementation which keeps all data in memory.
+// It is useful for tests and demo mode, all data lost on exit.
+type MemoryStore struct {
+	mutex      sync.RWMutex
+	messages   map[int64]map[int]*tgbotapi.Message
+	revisions  map[memoryMessageKey][]*MessageRevision
+	captions   map[memoryMessageKey]*Caption
+	users      map[int]*tgbotapi.User
+	chats      map[int64]memoryChat
+	files      map[memoryFileKey]*tgbotapi.File
+	censLevels map[memoryCensKey]int
+	warnLevels map[int]int
+	webLinks   map[string]*WebLink
+	offset     *UpdateOffset
+	downloads  map[memoryFileKey]*FailedDownload
+	mediaRefs  map[memoryFileKey]*MediaRef
+	roles      map[memoryRoleKey]*ChatRole
+	sanctions  map[memorySanctionKey]*Sanction
+	caches     Caches
+}
+
+type memoryChat struct {
+	chat    *tgbotapi.Chat
+	forward bool
+}
+
+type memoryMessageKey struct {
+	chatID    int64
+	messageID int
+}
+
+type memoryFileKey struct {
+	chatID int64
+	fileID string
+}
+
+type memoryRoleKey struct {
+	chatID int64
+	userID int
+}
+
+type memorySanctionKey struct {
+	chatID int64
+	userID int
+	kind   string
+}
+
+type memoryCensKey struct {
+	year   int
+	userID int
+}
+
+// NewMemoryStore function creates empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	s := new(MemoryStore)
+	s.messages = make(map[int64]map[int]*tgbotapi.Message)
+	s.revisions = make(map[memoryMessageKey][]*MessageRevision)
+	s.captions = make(map[memoryMessageKey]*Caption)
+	s.users = make(map[int]*tgbotapi.User)
+	s.chats = make(map[int64]memoryChat)
+	s.files = make(map[memoryFileKey]*tgbotapi.File)
+	s.censLevels = make(map[memoryCensKey]int)
+	s.warnLevels = make(map[int]int)
+	s.webLinks = make(map[string]*WebLink)
+	s.downloads = make(map[memoryFileKey]*FailedDownload)
+	s.mediaRefs = make(map[memoryFileKey]*MediaRef)
+	s.roles = make(map[memoryRoleKey]*ChatRole)
+	s.sanctions = make(map[memorySanctionKey]*Sanction)
+	s.caches = make(Caches)
+	return s
+}
+
+// SaveMessage method save message to store
+func (s *MemoryStore) SaveMessage(msg *tgbotapi.Message) (err error) {
+	go s.caches.AddedDate(msg.Chat.ID, msg.Time())
+
+	s.putMessage(msg)
+
+	err = saveMessageRelations(s, msg)
+	return
+}
+
+// SaveEditedMessage method save new revision of message and replaces message with it.
+// Original message saved as first revision on first edit.
+func (s *MemoryStore) SaveEditedMessage(msg *tgbotapi.Message) (err error) {
+	s.mutex.RLock()
+	original, ok := s.messages[msg.Chat.ID][msg.MessageID]
+	s.mutex.RUnlock()
+
+	if ok && original.EditDate == 0 {
+		s.putRevision(NewMessageRevision(original))
+	}
+	m := *msg
+	s.putRevision(NewMessageRevision(&m))
+	return s.SaveMessage(msg)
+}
+
+// putRevision adds revision or replaces revision with the same date
+func (s *MemoryStore) putRevision(revision *MessageRevision) {
+	key := memoryMessageKey{revision.ChatID, revision.MessageID}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, r := range s.revisions[key] {
+		if r.Date == revision.Date {
+			s.revisions[key][i] = revision
+			return
+		}
+	}
+	s.revisions[key] = append(s.revisions[key], revision)
+}
+
+// GetMessageRevisions returns all saved revisions of message ordered by date
+func (s *MemoryStore) GetMessageRevisions(chatID int64, messageID int) (revisions []*MessageRevision, err error) {
+	s.mutex.RLock()
+	for _, r := range s.revisions[memoryMessageKey{chatID, messageID}] {
+		revision := *r
+		revisions = append(revisions, &revision)
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Date < revisions[j].Date })
+	return
+}
+
+func (s *MemoryStore) putMessage(msg *tgbotapi.Message) {
+	m := *msg
+	s.mutex.Lock()
+	if _, ok := s.messages[msg.Chat.ID]; !ok {
+		s.messages[msg.Chat.ID] = make(map[int]*tgbotapi.Message)
+	}
+	s.messages[msg.Chat.ID][msg.MessageID] = &m
+	s.mutex.Unlock()
+}
+
+// SaveUser method save user to store
+func (s *MemoryStore) SaveUser(user *tgbotapi.User) (err error) {
+	u := *user
+	s.mutex.Lock()
+	s.users[user.ID] = &u
+	s.mutex.Unlock()
+	return
+}
+
+// SaveFile method save file to store
+func (s *MemoryStore) SaveFile(file *tgbotapi.File, chatID int64) (err error) {
+	f := *file
+	s.mutex.Lock()
+	s.files[memoryFileKey{chatID, file.FileID}] = &f
+	s.mutex.Unlock()
+	return
+}
+
+// GetFile returns file from store
+func (s *MemoryStore) GetFile(fileID string, chatID int64) (f *tgbotapi.File, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	file, ok := s.files[memoryFileKey{chatID, fileID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *file
+	return &result, nil
+}
+
+// SaveChat method for save chat to store
+func (s *MemoryStore) SaveChat(chat *tgbotapi.Chat, forward bool) (err error) {
+	c := *chat
+	s.mutex.Lock()
+	// forwards from channel must not hide it if the bot is a member of channel
+	if existing, ok := s.chats[chat.ID]; ok && !existing.forward {
+		forward = false
+	}
+	s.chats[chat.ID] = memoryChat{chat: &c, forward: forward}
+	s.mutex.Unlock()
+	return
+}
+
+// GetChats returns chat list
+func (s *MemoryStore) GetChats() (chats []*tgbotapi.Chat, err error) {
+	s.mutex.RLock()
+	for _, c := range s.chats {
+		if c.forward {
+			continue
+		}
+		chat := *c.chat
+		chats = append(chats, &chat)
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ID < chats[j].ID })
+	return
+}
+
+// GetMessages returns all chat messages
+func (s *MemoryStore) GetMessages(chatID int64) (messages []*tgbotapi.Message, err error) {
+	return s.filterMessages(chatID, func(*tgbotapi.Message) bool { return true }), nil
+}
+
+// GetMessagesByDate returns chat messages between dates
+func (s *MemoryStore) GetMessagesByDate(chatID int64, beginTime, endTime time.Time) (messages []*tgbotapi.Message, err error) {
+	begin, end := beginTime.Unix(), endTime.Unix()
+	return s.filterMessages(chatID, func(msg *tgbotapi.Message) bool {
+		date := int64(msg.Date)
+		return date >= begin && date <= end
+	}), nil
+}
+
+// GetMessagesPage returns up to limit chat messages between dates after cursor ordered by date and message ID
+func (s *MemoryStore) GetMessagesPage(chatID int64, beginTime, endTime time.Time, after MessageCursor, limit int) (messages []*tgbotapi.Message, err error) {
+	begin, end := beginTime.Unix(), endTime.Unix()
+	messages = s.filterMessages(chatID, func(msg *tgbotapi.Message) bool {
+		date := int64(msg.Date)
+		return date >= begin && date <= end && !after.before(msg)
+	})
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return
+}
+
+// GetChatAuthors returns IDs of senders and forwarded authors of chat messages
+func (s *MemoryStore) GetChatAuthors(chatID int64) (authors []int, err error) {
+	found := make(map[int]bool)
+	s.mutex.RLock()
+	for _, msg := range s.messages[chatID] {
+		fromID, forwardFromID := messageAuthors(msg)
+		found[fromID] = true
+		found[forwardFromID] = true
+	}
+	s.mutex.RUnlock()
+
+	delete(found, 0)
+	for userID := range found {
+		authors = append(authors, userID)
+	}
+	sort.Ints(authors)
+	return
+}
+
+// GetUserChats returns chats with messages of user
+func (s *MemoryStore) GetUserChats(userID int) (chats []*UserChat, err error) {
+	s.mutex.RLock()
+	for chatID, msgs := range s.messages {
+		var chat *UserChat
+		for _, msg := range msgs {
+			if fromID, forwardFromID := messageAuthors(msg); fromID != userID && forwardFromID != userID {
+				continue
+			}
+			if chat == nil {
+				chat = &UserChat{ChatID: chatID}
+				chats = append(chats, chat)
+			}
+			chat.Messages++
+			if msg.Date > chat.LastDate {
+				chat.LastDate = msg.Date
+			}
+		}
+	}
+	s.mutex.RUnlock()
+	sortUserChats(chats)
+	return
+}
+
+// filterMessages returns chat messages accepted by filter ordered by date
+func (s *MemoryStore) filterMessages(chatID int64, filter func(*tgbotapi.Message) bool) (messages []*tgbotapi.Message) {
+	s.mutex.RLock()
+	for _, msg := range s.messages[chatID] {
+		if filter(msg) {
+			m := *msg
+			messages = append(messages, &m)
+		}
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Date != messages[j].Date {
+			return messages[i].Date < messages[j].Date
+		}
+		return messages[i].MessageID < messages[j].MessageID
+	})
+	return
+}
+
+// GetUsers returns user list
+func (s *MemoryStore) GetUsers() (users []*tgbotapi.User, err error) {
+	return s.filterUsers(func(*tgbotapi.User) bool { return true }), nil
+}
+
+// GetUserByID returns user by ID
+func (s *MemoryStore) GetUserByID(userID int) (user *tgbotapi.User, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user = new(tgbotapi.User)
+	*user = *u
+	return
+}
+
+// GetUser get user by username or first and last name
+func (s *MemoryStore) GetUser(username string) (user *tgbotapi.User, err error) {
+	if len(username) == 0 {
+		return
+	}
+	q, err := parseUserQuery(username)
+	if err != nil {
+		return
+	}
+
+	users := s.filterUsers(func(u *tgbotapi.User) bool {
+		if q.UserName != "" {
+			return u.UserName == q.UserName
+		}
+		if q.LastName != "" {
+			return u.FirstName == q.FirstName && u.LastName == q.LastName
+		}
+		return u.FirstName == q.FirstName
+	})
+
+	switch len(users) {
+	case 0:
+		return nil, errUserNotFound(username)
+	case 1:
+		return users[0], nil
+	}
+
+	return nil, errManyUsers(users)
+}
+
+// filterUsers returns users accepted by filter ordered by ID
+func (s *MemoryStore) filterUsers(filter func(*tgbotapi.User) bool) (users []*tgbotapi.User) {
+	s.mutex.RLock()
+	for _, user := range s.users {
+		if filter(user) {
+			u := *user
+			users = append(users, &u)
+		}
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return
+}
+
+func (s *MemoryStore) getDates(chatID int64, beginDate, endDate int64) (result []time.Time, err error) {
+	all := beginDate == 0 && endDate == 0
+	msgs := s.filterMessages(chatID, func(msg *tgbotapi.Message) bool {
+		date := int64(msg.Date)
+		return all || (date >= beginDate && date <= endDate)
+	})
+	for _, msg := range msgs {
+		result = append(result, msg.Time())
+	}
+	return
+}
+
+// GetYears function returns years msg date from chat messages
+func (s *MemoryStore) GetYears(chatID int64) (result []string, err error) {
+	return s.caches.years(chatID, s.getDates)
+}
+
+// GetMonthList function returns month list msg date from chat messages and year
+func (s *MemoryStore) GetMonthList(chatID int64, year int) (result []time.Month, err error) {
+	return s.caches.months(chatID, year, s.getDates)
+}
+
+// GetDates function returns month list msg date from chat messages and year
+func (s *MemoryStore) GetDates(chatID int64, year int, month int) (result []int, err error) {
+	return s.caches.days(chatID, year, month, s.getDates)
+}
+
+// GetCensLevel function returns censore level for user
+func (s *MemoryStore) GetCensLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	currentLevel, ok := s.censLevels[memoryCensKey{time.Now().Year(), user.ID}]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return
+}
+
+// SetCensLevel function sets level for user
+func (s *MemoryStore) SetCensLevel(user *tgbotapi.User, setlevel int) (err error) {
+	s.mutex.Lock()
+	s.censLevels[memoryCensKey{time.Now().Year(), user.ID}] = setlevel
+	s.mutex.Unlock()
+	return
+}
+
+// AddCensLevel added +1 to cens level in year
+func (s *MemoryStore) AddCensLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	key := memoryCensKey{time.Now().Year(), user.ID}
+	s.mutex.Lock()
+	s.censLevels[key]++
+	currentLevel = s.censLevels[key]
+	s.mutex.Unlock()
+	return
+}
+
+// ClearCensLevel removes cens level for user
+func (s *MemoryStore) ClearCensLevel(user *tgbotapi.User) (err error) {
+	key := memoryCensKey{time.Now().Year(), user.ID}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.censLevels[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.censLevels, key)
+	return
+}
+
+// GetWarnLevel function returns warning level for user
+func (s *MemoryStore) GetWarnLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	currentLevel, ok := s.warnLevels[user.ID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return
+}
+
+// SetWarnLevel function sets level for user
+func (s *MemoryStore) SetWarnLevel(user *tgbotapi.User, setlevel int) (err error) {
+	s.mutex.Lock()
+	s.warnLevels[user.ID] = setlevel
+	s.mutex.Unlock()
+	return
+}
+
+// AddWarnLevel added +1 to warning level for user
+func (s *MemoryStore) AddWarnLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	s.mutex.Lock()
+	s.warnLevels[user.ID]++
+	currentLevel = s.warnLevels[user.ID]
+	s.mutex.Unlock()
+	return
+}
+
+// ClearWarnLevel removes warning level for user
+func (s *MemoryStore) ClearWarnLevel(user *tgbotapi.User) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.warnLevels[user.ID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.warnLevels, user.ID)
+	return
+}
+
+// SaveWebLink method saves or updates web link
+func (s *MemoryStore) SaveWebLink(link *WebLink) (err error) {
+	l := *link
+	s.mutex.Lock()
+	s.webLinks[l.Hash] = &l
+	s.mutex.Unlock()
+	return
+}
+
+// GetWebLink returns web link by token hash
+func (s *MemoryStore) GetWebLink(hash string) (link *WebLink, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	l, ok := s.webLinks[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *l
+	return &result, nil
+}
+
+// GetWebLinks returns all web links of chat
+func (s *MemoryStore) GetWebLinks(chatID int64) (links []*WebLink, err error) {
+	s.mutex.RLock()
+	for _, l := range s.webLinks {
+		if l.ChatID == chatID {
+			link := *l
+			links = append(links, &link)
+		}
+	}
+	s.mutex.RUnlock()
+	sortWebLinks(links)
+	return
+}
+
+// SaveUpdateOffset method saves ID of last processed update
+func (s *MemoryStore) SaveUpdateOffset(updateID int) (err error) {
+	s.mutex.Lock()
+	s.offset = &UpdateOffset{UpdateID: updateID}
+	s.mutex.Unlock()
+	return
+}
+
+// GetUpdateOffset returns ID of last processed update or 0 if nothing was processed
+func (s *MemoryStore) GetUpdateOffset() (updateID int, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.offset != nil {
+		updateID = s.offset.UpdateID
+	}
+	return
+}
+
+// SaveFailedDownload method saves or updates failed download
+func (s *MemoryStore) SaveFailedDownload(download *FailedDownload) (err error) {
+	d := *download
+	s.mutex.Lock()
+	s.downloads[memoryFileKey{d.ChatID, d.FileID}] = &d
+	s.mutex.Unlock()
+	return
+}
+
+// GetFailedDownloads returns all failed downloads
+func (s *MemoryStore) GetFailedDownloads() (downloads []*FailedDownload, err error) {
+	s.mutex.RLock()
+	for _, d := range s.downloads {
+		download := *d
+		downloads = append(downloads, &download)
+	}
+	s.mutex.RUnlock()
+	sortFailedDownloads(downloads)
+	return
+}
+
+// DeleteFailedDownload removes failed download
+func (s *MemoryStore) DeleteFailedDownload(chatID int64, fileID string) (err error) {
+	key := memoryFileKey{chatID, fileID}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.downloads[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.downloads, key)
+	return
+}
+
+// SaveCaption method saves or updates caption entities of message
+func (s *MemoryStore) SaveCaption(caption *Caption) (err error) {
+	c := *caption
+	s.mutex.Lock()
+	s.captions[memoryMessageKey{c.ChatID, c.MessageID}] = &c
+	s.mutex.Unlock()
+	return
+}
+
+// GetCaption returns caption entities of message
+func (s *MemoryStore) GetCaption(chatID int64, messageID int) (caption *Caption, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	c, ok := s.captions[memoryMessageKey{chatID, messageID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *c
+	return &result, nil
+}
+
+// SaveMediaRef method saves or updates media ref
+func (s *MemoryStore) SaveMediaRef(ref *MediaRef) (err error) {
+	r := *ref
+	s.mutex.Lock()
+	s.mediaRefs[memoryFileKey{r.ChatID, r.FileID}] = &r
+	s.mutex.Unlock()
+	return
+}
+
+// GetMediaRef returns media ref of file in chat
+func (s *MemoryStore) GetMediaRef(chatID int64, fileID string) (ref *MediaRef, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	r, ok := s.mediaRefs[memoryFileKey{chatID, fileID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *r
+	return &result, nil
+}
+
+// GetMediaRefs returns all media refs
+func (s *MemoryStore) GetMediaRefs() (refs []*MediaRef, err error) {
+	s.mutex.RLock()
+	for _, r := range s.mediaRefs {
+		ref := *r
+		refs = append(refs, &ref)
+	}
+	s.mutex.RUnlock()
+	sortMediaRefs(refs)
+	return
+}
+
+// SaveChatRole method saves or updates role of user in chat
+func (s *MemoryStore) SaveChatRole(role *ChatRole) (err error) {
+	r := *role
+	s.mutex.Lock()
+	s.roles[memoryRoleKey{r.ChatID, r.UserID}] = &r
+	s.mutex.Unlock()
+	return
+}
+
+// GetChatRoles returns roles of users in chat
+func (s *MemoryStore) GetChatRoles(chatID int64) (roles []*ChatRole, err error) {
+	s.mutex.RLock()
+	for key, r := range s.roles {
+		if key.chatID != chatID {
+			continue
+		}
+		role := *r
+		roles = append(roles, &role)
+	}
+	s.mutex.RUnlock()
+	sortChatRoles(roles)
+	return
+}
+
+// DeleteChatRole removes role of user in chat
+func (s *MemoryStore) DeleteChatRole(chatID int64, userID int) (err error) {
+	key := memoryRoleKey{chatID, userID}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.roles[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.roles, key)
+	return
+}
+
+// SaveSanction method saves or updates sanction
+func (s *MemoryStore) SaveSanction(sanction *Sanction) (err error) {
+	v := *sanction
+	s.mutex.Lock()
+	s.sanctions[memorySanctionKey{v.ChatID, v.UserID, v.Kind}] = &v
+	s.mutex.Unlock()
+	return
+}
+
+// GetSanctions returns all active sanctions
+func (s *MemoryStore) GetSanctions() (sanctions []*Sanction, err error) {
+	s.mutex.RLock()
+	for _, v := range s.sanctions {
+		sanction := *v
+		sanctions = append(sanctions, &sanction)
+	}
+	s.mutex.RUnlock()
+	sortSanctions(sanctions)
+	return
+}
+
+// DeleteSanction removes sanction
+func (s *MemoryStore) DeleteSanction(chatID int64, userID int, kind string) (err error) {
+	key := memorySanctionKey{chatID, userID, kind}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.sanctions[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.sanctions, key)
+	return
+}
+
+// ImportDocument saves migrated document
+func (s *MemoryStore) ImportDocument(doc Document) (err error) {
+	value, err := decodeDocument(doc)
+	if err != nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case *tgbotapi.Message:
+		go s.caches.AddedDate(v.Chat.ID, v.Time())
+		s.putMessage(v)
+	case *tgbotapi.User:
+		err = s.SaveUser(v)
+	case *chatDocument:
+		err = s.SaveChat(&v.Chat, v.Type == "forward-chat")
+	case *fileDocument:
+		err = s.SaveFile(v.File, v.ChatID)
+	case *CensLevel:
+		s.mutex.Lock()
+		s.censLevels[memoryCensKey{v.Year, v.ID}] = v.Level
+		s.mutex.Unlock()
+	case *WarnLevel:
+		err = s.SetWarnLevel(&tgbotapi.User{ID: v.ID}, v.Level)
+	case *Caption:
+		err = s.SaveCaption(v)
+	case *MessageRevision:
+		s.putRevision(v)
+	case *WebLink:
+		err = s.SaveWebLink(v)
+	case *UpdateOffset:
+		err = s.SaveUpdateOffset(v.UpdateID)
+	case *FailedDownload:
+		err = s.SaveFailedDownload(v)
+	case *MediaRef:
+		err = s.SaveMediaRef(v)
+	case *ChatRole:
+		err = s.SaveChatRole(v)
+	case *Sanction:
+		err = s.SaveSanction(v)
+	}
+	return
+}
+
+// CountDocuments returns count of documents with key prefix
+func (s *MemoryStore) CountDocuments(prefix string) (count int, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	switch prefix {
+	case "message:":
+		for _, msgs := range s.messages {
+			count += len(msgs)
+		}
+	case "caption:":
+		count = len(s.captions)
+	case "user:":
+		count = len(s.users)
+	case "chat:":
+		count = len(s.chats)
+	case "file:":
+		count = len(s.files)
+	case "censlevel:":
+		count = len(s.censLevels)
+	case "warnlevel:":
+		count = len(s.warnLevels)
+	case "revision:":
+		for _, revisions := range s.revisions {
+			count += len(revisions)
+		}
+	case "weblink:":
+		count = len(s.webLinks)
+	case "offset:":
+		if s.offset != nil {
+			count = 1
+		}
+	case "download:":
+		count = len(s.downloads)
+	case "media:":
+		count = len(s.mediaRefs)
+	case "role:":
+		count = len(s.roles)
+	case "sanction:":
+		count = len(s.sanctions)
+	default:
+		err = fmt.Errorf("unknown document prefix %s", prefix)
+	}
+	return
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// DocumentPrefixes is a list of document key prefixes in migration order
+var DocumentPrefixes = []string{"user:", "chat:", "message:", "caption:", "revision:", "file:", "censlevel:", "warnlevel:", "weblink:", "offset:", "download:", "media:", "role:", "sanction:"}
+
+// Document is a raw store document with couchbase style key, e.g. message:<chat_id>:<message_id>
+type Document struct {
+	Key  string
+	Data json.RawMessage
+}
+
+// DocumentCounter is implemented by stores which can count documents by key prefix
+type DocumentCounter interface {
+	CountDocuments(prefix string) (int, error)
+}
+
+// Exporter is implemented by stores which can be a source of migration
+type Exporter interface {
+	DocumentCounter
+	// ExportDocuments returns up to limit documents with key prefix ordered by key and with key greater than afterKey
+	ExportDocuments(prefix, afterKey string, limit int) ([]Document, error)
+}
+
+// Importer is implemented by stores which can be a target of migration
+type Importer interface {
+	DocumentCounter
+	// ImportDocument saves document as is, without side effects of Save* methods
+	ImportDocument(doc Document) error
+}
+
+// MigrationState stores last migrated key by prefix for resume interrupted migration
+type MigrationState map[string]string
+
+// MigrationCount is a count verification result for one document prefix
+type MigrationCount struct {
+	Prefix   string
+	Migrated int
+	Failed   int
+	Source   int
+	Target   int
+}
+
+// Ok returns true if source and target counts are equal
+func (c MigrationCount) Ok() bool {
+	return c.Source == c.Target
+}
+
+// chatDocument is a chat:<id> document
+type chatDocument struct {
+	tgbotapi.Chat
+	Type string `json:"type"`
+}
+
+// fileDocument is a file:<chat_id>:<file_id> document
+type fileDocument struct {
+	ChatID int64
+	File   *tgbotapi.File
+}
+
+// LoadMigrationState function loads migration state from file, returns empty state if file does not exist
+func LoadMigrationState(path string) (state MigrationState, err error) {
+	state = make(MigrationState)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &state)
+	return
+}
+
+// Save method writes migration state to file atomically
+func (state MigrationState) Save(path string) (err error) {
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// Migrate function streams all documents from one store to another by batches.
+// Progress is saved to statePath after every batch, so interrupted migration continues from last batch.
+func Migrate(from Exporter, to Importer, statePath string, batchSize int) (report []MigrationCount, err error) {
+	state, err := LoadMigrationState(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load migration state: %s", err)
+	}
+
+	for _, prefix := range DocumentPrefixes {
+		count := MigrationCount{Prefix: prefix}
+		if state[prefix] != "" {
+			log.Printf("Resume %s documents after %s", prefix, state[prefix])
+		}
+
+		for {
+			var docs []Document
+			if docs, err = from.ExportDocuments(prefix, state[prefix], batchSize); err != nil {
+				return
+			}
+			if len(docs) == 0 {
+				break
+			}
+			for _, doc := range docs {
+				if err := to.ImportDocument(doc); err != nil {
+					log.Printf("Error in import document %s: %s", doc.Key, err)
+					count.Failed++
+					continue
+				}
+				count.Migrated++
+			}
+
+			state[prefix] = docs[len(docs)-1].Key
+			if err = state.Save(statePath); err != nil {
+				return nil, fmt.Errorf("Cannot save migration state: %s", err)
+			}
+			log.Printf("Migrated %d %s documents", count.Migrated, prefix)
+		}
+
+		if count.Source, err = from.CountDocuments(prefix); err != nil {
+			return
+		}
+		if count.Target, err = to.CountDocuments(prefix); err != nil {
+			return
+		}
+		report = append(report, count)
+	}
+	return
+}
+
+// decodeDocument decodes document to bot type by key prefix
+func decodeDocument(doc Document) (value interface{}, err error) {
+	switch {
+	case strings.HasPrefix(doc.Key, "message:"):
+		msg := new(tgbotapi.Message)
+		if err = json.Unmarshal(doc.Data, msg); err != nil {
+			return
+		}
+		if msg.Chat == nil {
+			return nil, fmt.Errorf("message without chat")
+		}
+		value = msg
+	case strings.HasPrefix(doc.Key, "caption:"):
+		caption := new(Caption)
+		err = json.Unmarshal(doc.Data, caption)
+		value = caption
+	case strings.HasPrefix(doc.Key, "revision:"):
+		revision := new(MessageRevision)
+		if err = json.Unmarshal(doc.Data, revision); err != nil {
+			return
+		}
+		if revision.Message == nil {
+			return nil, fmt.Errorf("revision without message")
+		}
+		value = revision
+	case strings.HasPrefix(doc.Key, "user:"):
+		user := new(tgbotapi.User)
+		err = json.Unmarshal(doc.Data, user)
+		value = user
+	case strings.HasPrefix(doc.Key, "chat:"):
+		chat := new(chatDocument)
+		err = json.Unmarshal(doc.Data, chat)
+		value = chat
+	case strings.HasPrefix(doc.Key, "file:"):
+		parts := strings.SplitN(doc.Key, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("bad file key")
+		}
+		f := &fileDocument{File: new(tgbotapi.File)}
+		if f.ChatID, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return
+		}
+		err = json.Unmarshal(doc.Data, f.File)
+		value = f
+	case strings.HasPrefix(doc.Key, "censlevel:"):
+		level := new(CensLevel)
+		err = json.Unmarshal(doc.Data, level)
+		value = level
+	case strings.HasPrefix(doc.Key, "warnlevel:"):
+		level := new(WarnLevel)
+		err = json.Unmarshal(doc.Data, level)
+		value = level
+	case strings.HasPrefix(doc.Key, "weblink:"):
+		link := new(WebLink)
+		err = json.Unmarshal(doc.Data, link)
+		value = link
+	case strings.HasPrefix(doc.Key, "offset:"):
+		offset := new(UpdateOffset)
+		err = json.Unmarshal(doc.Data, offset)
+		value = offset
+	case strings.HasPrefix(doc.Key, "download:"):
+		download := new(FailedDownload)
+		err = json.Unmarshal(doc.Data, download)
+		value = download
+	case strings.HasPrefix(doc.Key, "media:"):
+		ref := new(MediaRef)
+		err = json.Unmarshal(doc.Data, ref)
+		value = ref
+	case strings.HasPrefix(doc.Key, "role:"):
+		role := new(ChatRole)
+		err = json.Unmarshal(doc.Data, role)
+		value = role
+	case strings.HasPrefix(doc.Key, "sanction:"):
+		sanction := new(Sanction)
+		err = json.Unmarshal(doc.Data, sanction)
+		value = sanction
+	default:
+		err = fmt.Errorf("unknown document type")
+	}
+	return
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeExporter is a migration source with documents in memory
+type fakeExporter struct {
+	docs []Document
+	// failAfter makes ExportDocuments fail after count of successful calls, 0 disables failure
+	failAfter int
+	calls     int
+}
+
+func (e *fakeExporter) CountDocuments(prefix string) (count int, err error) {
+	for _, doc := range e.docs {
+		if strings.HasPrefix(doc.Key, prefix) {
+			count++
+		}
+	}
+	return
+}
+
+func (e *fakeExporter) ExportDocuments(prefix, afterKey string, limit int) (docs []Document, err error) {
+	e.calls++
+	if e.failAfter != 0 && e.calls > e.failAfter {
+		return nil, errors.New("connection lost")
+	}
+	sort.Slice(e.docs, func(i, j int) bool { return e.docs[i].Key < e.docs[j].Key })
+	for _, doc := range e.docs {
+		if strings.HasPrefix(doc.Key, prefix) && doc.Key > afterKey && len(docs) < limit {
+			docs = append(docs, doc)
+		}
+	}
+	return
+}
+
+// migrationDocuments are couchbase documents of every type
+var migrationDocuments = []Document{
+	{"user:1", []byte(`{"id":1,"first_name":"Ivan","username":"ivan","type":"user"}`)},
+	{"chat:-5", []byte(`{"id":-5,"type":"forward-chat","title":"Forwarded"}`)},
+	{"chat:-6", []byte(`{"id":-6,"type":"chat","title":"Group"}`)},
+	{"message:-6:1", []byte(`{"message_id":1,"date":1500000000,"chat":{"id":-6},"from":{"id":1},"text":"a","type":"message"}`)},
+	{"message:-6:2", []byte(`{"message_id":2,"date":1500000001,"chat":{"id":-6},"text":"b","type":"message"}`)},
+	{"message:-6:3", []byte(`{"message_id":3,"date":1500000002,"chat":{"id":-6},"caption":"c","type":"message"}`)},
+	{"caption:-6:3", []byte(`{"chat_id":-6,"message_id":3,"entities":[{"type":"bold","offset":0,"length":1}],"type":"caption"}`)},
+	{"revision:-6:2:1500000001", []byte(`{"chat_id":-6,"message_id":2,"date":1500000001,"message":{"message_id":2,"date":1500000001,"chat":{"id":-6},"text":"b0"}}`)},
+	{"file:-6:AbC", []byte(`{"file_id":"AbC","file_path":"photos/x.jpg","type":"file"}`)},
+	{"censlevel:2019:1", []byte(`{"user_id":1,"level":3,"year":2019}`)},
+	{"warnlevel:1", []byte(`{"user_id":1,"level":2}`)},
+	{"weblink:abc", []byte(`{"hash":"abc","chat_id":-6,"created_by":1,"created_at":1500000000,"expires_at":0,"revoked":false}`)},
+	{"offset:updates", []byte(`{"update_id":7}`)},
+	{"download:-6:AbC", []byte(`{"chat_id":-6,"file_id":"AbC","attempts":3,"error":"timeout","failed_at":1500000000}`)},
+	{"media:-6:AbC", []byte(`{"chat_id":-6,"file_id":"AbC","hash":"00ff","path":"media/00/ff","size":3}`)},
+	{"role:-6:1", []byte(`{"chat_id":-6,"user_id":1,"role":"trusted","updated_at":1500000000}`)},
+	{"sanction:-6:1:mute", []byte(`{"chat_id":-6,"user_id":1,"kind":"mute","created_by":2,"created_at":1500000000,"until":1600000000}`)},
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, target := range stores {
+		statePath := filepath.Join(dir, name+"-state.json")
+		report, err := Migrate(&fakeExporter{docs: migrationDocuments}, target.(Importer), statePath, 2)
+		if err != nil {
+			t.Fatalf("%s: Migrate: %s", name, err)
+		}
+		if len(report) != len(DocumentPrefixes) {
+			t.Errorf("%s: report has %d prefixes, expected %d", name, len(report), len(DocumentPrefixes))
+		}
+		for _, count := range report {
+			if !count.Ok() || count.Failed != 0 || count.Migrated != count.Source || count.Source == 0 {
+				t.Errorf("%s: bad count %+v", name, count)
+			}
+		}
+
+		if chats, err := target.GetChats(); err != nil || len(chats) != 1 || chats[0].Title != "Group" {
+			t.Errorf("%s: migrated chats are %v, %v", name, chats, err)
+		}
+		if msgs, err := target.GetMessages(-6); err != nil || len(msgs) != 3 {
+			t.Errorf("%s: migrated messages are %v, %v", name, msgs, err)
+		}
+		if caption, err := target.GetCaption(-6, 3); err != nil || caption.Entities[0].Type != "bold" {
+			t.Errorf("%s: migrated caption is %+v, %v", name, caption, err)
+		}
+		if revisions, err := target.GetMessageRevisions(-6, 2); err != nil || len(revisions) != 1 {
+			t.Errorf("%s: migrated revisions are %v, %v", name, revisions, err)
+		}
+		if f, err := target.GetFile("AbC", -6); err != nil || f.FilePath != "photos/x.jpg" {
+			t.Errorf("%s: migrated file is %+v, %v", name, f, err)
+		}
+		if offset, err := target.GetUpdateOffset(); err != nil || offset != 7 {
+			t.Errorf("%s: migrated offset is %d, %v", name, offset, err)
+		}
+		if sanctions, err := target.GetSanctions(); err != nil || len(sanctions) != 1 || sanctions[0].Until != 1600000000 {
+			t.Errorf("%s: migrated sanctions are %v, %v", name, sanctions, err)
+		}
+
+		// migration with state does not import documents again
+		report, err = Migrate(&fakeExporter{docs: migrationDocuments}, target.(Importer), statePath, 2)
+		if err != nil {
+			t.Fatalf("%s: Migrate again: %s", name, err)
+		}
+		for _, count := range report {
+			if count.Migrated != 0 || !count.Ok() {
+				t.Errorf("%s: documents are migrated again: %+v", name, count)
+			}
+		}
+	}
+}
+
+func TestMigrateResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	for name, target := range stores {
+		statePath := filepath.Join(dir, name+"-state.json")
+		// users, chats and first batch of messages are migrated before failure
+		source := &fakeExporter{docs: migrationDocuments, failAfter: 5}
+		if _, err = Migrate(source, target.(Importer), statePath, 2); err == nil {
+			t.Fatalf("%s: error of source is ignored", name)
+		}
+		state, err := LoadMigrationState(statePath)
+		if err != nil || state["message:"] != "message:-6:2" {
+			t.Errorf("%s: migration state is %v, %v", name, state, err)
+		}
+
+		report, err := Migrate(&fakeExporter{docs: migrationDocuments}, target.(Importer), statePath, 2)
+		if err != nil {
+			t.Fatalf("%s: resumed Migrate: %s", name, err)
+		}
+		for _, count := range report {
+			if !count.Ok() {
+				t.Errorf("%s: bad count after resume %+v", name, count)
+			}
+			if count.Prefix == "message:" && count.Migrated != 1 {
+				t.Errorf("%s: %d messages are migrated after resume, expected 1", name, count.Migrated)
+			}
+		}
+	}
+}
+
+func TestMigrateBrokenDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stores, cleanup := newTestStores(t)
+	defer cleanup()
+
+	docs := []Document{
+		{"message:-6:1", []byte(`{"message_id":1,"date":1500000000,"chat":{"id":-6},"text":"a"}`)},
+		{"message:-6:2", []byte(`{"message_id":2,"date":1500000000,"text":"without chat"}`)},
+		{"user:1", []byte(`{"id":"broken"}`)},
+	}
+	for name, target := range stores {
+		report, err := Migrate(&fakeExporter{docs: docs}, target.(Importer), filepath.Join(dir, name+"-state.json"), 10)
+		if err != nil {
+			t.Fatalf("%s: Migrate: %s", name, err)
+		}
+		for _, count := range report {
+			switch count.Prefix {
+			case "message:":
+				if count.Migrated != 1 || count.Failed != 1 || count.Ok() {
+					t.Errorf("%s: bad count of messages %+v", name, count)
+				}
+			case "user:":
+				if count.Migrated != 0 || count.Failed != 1 || count.Ok() {
+					t.Errorf("%s: bad count of users %+v", name, count)
+				}
+			}
+		}
+	}
+}
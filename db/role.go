@@ -0,0 +1,21 @@
+package db
+
+import "sort"
+
+// ChatRole is a role of user in chat, records role:chat_id:user_id.
+// Role is granted with bot command, AdminRole is synced from chat administrators.
+type ChatRole struct {
+	ChatID    int64  `json:"chat_id"`
+	UserID    int    `json:"user_id"`
+	Role      string `json:"role,omitempty"`
+	AdminRole string `json:"admin_role,omitempty"`
+	GrantedBy int    `json:"granted_by,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// sortChatRoles sorts roles by user ID
+func sortChatRoles(roles []*ChatRole) {
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].UserID < roles[j].UserID
+	})
+}
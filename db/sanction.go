@@ -0,0 +1,42 @@
+package db
+
+import "sort"
+
+// Kinds of sanctions
+const (
+	SanctionMute     = "mute"
+	SanctionBan      = "ban"
+	SanctionRestrict = "restrict"
+)
+
+// Sanction is an active mute, temporary ban or restriction of user in chat, records sanction:chat_id:user_id:kind.
+// Until is a time of automatic lift, 0 means sanction is lifted by command only.
+type Sanction struct {
+	ChatID      int64  `json:"chat_id"`
+	UserID      int    `json:"user_id"`
+	Kind        string `json:"kind"`
+	Restriction string `json:"restriction,omitempty"`
+	CreatedBy   int    `json:"created_by"`
+	CreatedAt   int64  `json:"created_at"`
+	Until       int64  `json:"until"`
+}
+
+// sortSanctions sorts sanctions by lift time, sanctions without it go last
+func sortSanctions(sanctions []*Sanction) {
+	sort.Slice(sanctions, func(i, j int) bool {
+		a, b := sanctions[i], sanctions[j]
+		if (a.Until == 0) != (b.Until == 0) {
+			return b.Until == 0
+		}
+		if a.Until != b.Until {
+			return a.Until < b.Until
+		}
+		if a.ChatID != b.ChatID {
+			return a.ChatID < b.ChatID
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.Kind < b.Kind
+	})
+}
@@ -0,0 +1,1007 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	// sqlite3 driver for database/sql
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// sqliteMigrations is a list of schema migrations, index+1 is a schema version
+// stored in PRAGMA user_version. Never change applied migrations, append new ones.
+var sqliteMigrations = []string{
+	// 1: initial schema
+	`CREATE TABLE messages (
+		chat_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		date       INTEGER NOT NULL,
+		data       TEXT NOT NULL,
+		PRIMARY KEY (chat_id, message_id)
+	);
+	CREATE INDEX messages_chat_date ON messages (chat_id, date);
+
+	CREATE TABLE users (
+		id         INTEGER PRIMARY KEY,
+		username   TEXT NOT NULL DEFAULT '',
+		first_name TEXT NOT NULL DEFAULT '',
+		last_name  TEXT NOT NULL DEFAULT '',
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX users_username ON users (username);
+	CREATE INDEX users_names ON users (first_name, last_name);
+
+	CREATE TABLE chats (
+		id   INTEGER PRIMARY KEY,
+		type TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+
+	CREATE TABLE files (
+		chat_id INTEGER NOT NULL,
+		file_id TEXT NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (chat_id, file_id)
+	);
+
+	CREATE TABLE cens_levels (
+		year    INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		level   INTEGER NOT NULL,
+		PRIMARY KEY (year, user_id)
+	);
+
+	CREATE TABLE warn_levels (
+		user_id INTEGER PRIMARY KEY,
+		level   INTEGER NOT NULL
+	);`,
+	// 2: edited messages history
+	`CREATE TABLE message_revisions (
+		chat_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		date       INTEGER NOT NULL,
+		data       TEXT NOT NULL,
+		PRIMARY KEY (chat_id, message_id, date)
+	);`,
+	// 3: web links
+	`CREATE TABLE web_links (
+		hash    TEXT PRIMARY KEY,
+		chat_id INTEGER NOT NULL,
+		data    TEXT NOT NULL
+	);
+	CREATE INDEX web_links_chat ON web_links (chat_id);`,
+	// 4: last processed update
+	`CREATE TABLE update_offset (
+		id        INTEGER PRIMARY KEY CHECK (id = 1),
+		update_id INTEGER NOT NULL
+	);`,
+	// 5: failed downloads
+	`CREATE TABLE failed_downloads (
+		chat_id INTEGER NOT NULL,
+		file_id TEXT NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (chat_id, file_id)
+	);`,
+	// 6: content addressed media
+	`CREATE TABLE media_refs (
+		chat_id INTEGER NOT NULL,
+		file_id TEXT NOT NULL,
+		hash    TEXT NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (chat_id, file_id)
+	);
+	CREATE INDEX media_refs_hash ON media_refs (hash);`,
+	// 7: chat roles
+	`CREATE TABLE chat_roles (
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (chat_id, user_id)
+	);`,
+	// 8: sanctions
+	`CREATE TABLE sanctions (
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		kind    TEXT NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (chat_id, user_id, kind)
+	);`,
+	// 9: caption entities
+	`CREATE TABLE captions (
+		chat_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		data       TEXT NOT NULL,
+		PRIMARY KEY (chat_id, message_id)
+	);`,
+	// 10: authors of messages, columns of old messages are filled by fillMessageAuthors
+	`ALTER TABLE messages ADD COLUMN from_id INTEGER;
+	ALTER TABLE messages ADD COLUMN forward_from_id INTEGER;
+	CREATE INDEX messages_from ON messages (from_id, chat_id, date);
+	CREATE INDEX messages_forward_from ON messages (forward_from_id, chat_id, date);
+	CREATE INDEX messages_chat_authors ON messages (chat_id, from_id, forward_from_id);`,
+}
+
+// SQLiteStore is a Store implementation on top of embedded sqlite database
+type SQLiteStore struct {
+	db     *sql.DB
+	caches Caches
+}
+
+// NewSQLiteStore function opens sqlite database file and applies schema migrations
+func NewSQLiteStore(path string) (s *SQLiteStore, err error) {
+	s = new(SQLiteStore)
+	if s.db, err = sql.Open("sqlite3", path+"?_busy_timeout=5000"); err != nil {
+		return nil, fmt.Errorf("Cannot open sqlite database: %s", err)
+	}
+	// sqlite serializes writes anyway, one connection avoids "database is locked" errors
+	s.db.SetMaxOpenConns(1)
+
+	if err = s.migrate(); err != nil {
+		s.db.Close()
+		return nil, fmt.Errorf("Cannot migrate sqlite database: %s", err)
+	}
+	if err = s.fillMessageAuthors(); err != nil {
+		s.db.Close()
+		return nil, fmt.Errorf("Cannot fill authors of messages: %s", err)
+	}
+
+	s.caches = make(Caches)
+	if chats, err := s.GetChats(); err == nil {
+		s.caches.update(chats, s.getDates)
+	}
+	return
+}
+
+// Close closes sqlite database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) migrate() (err error) {
+	var version int
+	if err = s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		var tx *sql.Tx
+		if tx, err = s.db.Begin(); err != nil {
+			return
+		}
+		if _, err = tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %s", version+1, err)
+		}
+		// PRAGMA does not support parameters, version is an integer
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			return
+		}
+		log.Printf("SQLite schema migrated to version %d", version+1)
+	}
+	return
+}
+
+// SaveMessage method save message to database
+func (s *SQLiteStore) SaveMessage(msg *tgbotapi.Message) (err error) {
+	go s.caches.AddedDate(msg.Chat.ID, msg.Time())
+
+	if err = s.insertMessage(msg); err != nil {
+		return
+	}
+
+	err = saveMessageRelations(s, msg)
+	return
+}
+
+// SaveEditedMessage method save new revision of message and replaces message with it.
+// Original message saved as first revision on first edit.
+func (s *SQLiteStore) SaveEditedMessage(msg *tgbotapi.Message) (err error) {
+	var data string
+	err = s.db.QueryRow(`SELECT data FROM messages WHERE chat_id = ? AND message_id = ?`, msg.Chat.ID, msg.MessageID).Scan(&data)
+	if err == nil {
+		original := new(tgbotapi.Message)
+		if err = json.Unmarshal([]byte(data), original); err == nil && original.EditDate == 0 {
+			if err = s.insertRevision(NewMessageRevision(original)); err != nil {
+				return
+			}
+		}
+	}
+	if err = s.insertRevision(NewMessageRevision(msg)); err != nil {
+		return
+	}
+	return s.SaveMessage(msg)
+}
+
+func (s *SQLiteStore) insertRevision(revision *MessageRevision) (err error) {
+	data, err := json.Marshal(revision.Message)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO message_revisions (chat_id, message_id, date, data) VALUES (?, ?, ?, ?)`,
+		revision.ChatID, revision.MessageID, revision.Date, string(data))
+	return
+}
+
+// GetMessageRevisions returns all saved revisions of message ordered by date
+func (s *SQLiteStore) GetMessageRevisions(chatID int64, messageID int) (revisions []*MessageRevision, err error) {
+	rows, err := s.db.Query(`SELECT date, data FROM message_revisions WHERE chat_id = ? AND message_id = ? ORDER BY date`,
+		chatID, messageID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		revision := &MessageRevision{ChatID: chatID, MessageID: messageID, Message: new(tgbotapi.Message)}
+		if err = rows.Scan(&revision.Date, &data); err != nil {
+			return
+		}
+		if err := json.Unmarshal([]byte(data), revision.Message); err != nil {
+			log.Printf("Error in unmarshal GetMessageRevisions: %s", err)
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *SQLiteStore) insertMessage(msg *tgbotapi.Message) (err error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	fromID, forwardFromID := messageAuthors(msg)
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO messages (chat_id, message_id, date, from_id, forward_from_id, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		msg.Chat.ID, msg.MessageID, msg.Date, fromID, forwardFromID, string(data))
+	return
+}
+
+// fillMessageAuthors method fills author columns of messages saved before they were added.
+// JSON functions are not available in old sqlite, so messages are decoded here.
+func (s *SQLiteStore) fillMessageAuthors() (err error) {
+	for {
+		var count int
+		if count, err = s.fillMessageAuthorsBatch(1000); err != nil || count == 0 {
+			return
+		}
+		log.Printf("Authors of %d messages are filled", count)
+	}
+}
+
+// fillMessageAuthorsBatch method fills author columns of up to limit messages, returns count of them
+func (s *SQLiteStore) fillMessageAuthorsBatch(limit int) (count int, err error) {
+	type messageRow struct {
+		chatID    int64
+		messageID int
+		data      string
+	}
+
+	rows, err := s.db.Query(`SELECT chat_id, message_id, data FROM messages WHERE from_id IS NULL LIMIT ?`, limit)
+	if err != nil {
+		return
+	}
+	var batch []messageRow
+	for rows.Next() {
+		var row messageRow
+		if err = rows.Scan(&row.chatID, &row.messageID, &row.data); err != nil {
+			rows.Close()
+			return
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(batch) == 0 {
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	for _, row := range batch {
+		// broken message gets no authors, so it is not selected again
+		msg := new(tgbotapi.Message)
+		if err := json.Unmarshal([]byte(row.data), msg); err != nil {
+			log.Printf("Error in unmarshal message %d:%d: %s", row.chatID, row.messageID, err)
+		}
+		fromID, forwardFromID := messageAuthors(msg)
+		if _, err = tx.Exec(`UPDATE messages SET from_id = ?, forward_from_id = ? WHERE chat_id = ? AND message_id = ?`,
+			fromID, forwardFromID, row.chatID, row.messageID); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	return len(batch), tx.Commit()
+}
+
+// SaveUser method save user to database
+func (s *SQLiteStore) SaveUser(user *tgbotapi.User) (err error) {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO users (id, username, first_name, last_name, data) VALUES (?, ?, ?, ?, ?)`,
+		user.ID, user.UserName, user.FirstName, user.LastName, string(data))
+	return
+}
+
+// SaveFile method save file to database
+func (s *SQLiteStore) SaveFile(file *tgbotapi.File, chatID int64) (err error) {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO files (chat_id, file_id, data) VALUES (?, ?, ?)`,
+		chatID, file.FileID, string(data))
+	return
+}
+
+// GetFile returns file from database
+func (s *SQLiteStore) GetFile(fileID string, chatID int64) (f *tgbotapi.File, err error) {
+	var data string
+	err = s.db.QueryRow(`SELECT data FROM files WHERE chat_id = ? AND file_id = ?`, chatID, fileID).Scan(&data)
+	if err != nil {
+		return nil, convertSQLError(err)
+	}
+	f = new(tgbotapi.File)
+	err = json.Unmarshal([]byte(data), f)
+	return
+}
+
+// SaveChat method for save chat to database
+func (s *SQLiteStore) SaveChat(chat *tgbotapi.Chat, forward bool) (err error) {
+	data, err := json.Marshal(chat)
+	if err != nil {
+		return
+	}
+
+	chatType := "chat"
+	if forward {
+		chatType = "forward-chat"
+	}
+
+	// forwards from channel must not hide it if the bot is a member of channel
+	_, err = s.db.Exec(`INSERT INTO chats (id, type, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data,
+			type = CASE WHEN chats.type = 'chat' THEN 'chat' ELSE excluded.type END`,
+		chat.ID, chatType, string(data))
+	return
+}
+
+// GetChats returns chat list
+func (s *SQLiteStore) GetChats() (chats []*tgbotapi.Chat, err error) {
+	rows, err := s.db.Query(`SELECT data FROM chats WHERE type = 'chat' ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		chat := new(tgbotapi.Chat)
+		if err := json.Unmarshal([]byte(data), chat); err != nil {
+			log.Printf("Error in unmarshal GetChats: %s", err)
+			continue
+		}
+		chats = append(chats, chat)
+	}
+	err = rows.Err()
+	return
+}
+
+// GetMessages returns all chat messages
+func (s *SQLiteStore) GetMessages(chatID int64) (messages []*tgbotapi.Message, err error) {
+	return s.queryMessages(`SELECT data FROM messages WHERE chat_id = ? ORDER BY date, message_id`, chatID)
+}
+
+// GetMessagesByDate returns chat messages between dates
+func (s *SQLiteStore) GetMessagesByDate(chatID int64, beginTime, endTime time.Time) (messages []*tgbotapi.Message, err error) {
+	return s.queryMessages(`SELECT data FROM messages WHERE chat_id = ? AND date >= ? AND date <= ? ORDER BY date, message_id`,
+		chatID, beginTime.Unix(), endTime.Unix())
+}
+
+// GetMessagesPage returns up to limit chat messages between dates after cursor ordered by date and message ID
+func (s *SQLiteStore) GetMessagesPage(chatID int64, beginTime, endTime time.Time, after MessageCursor, limit int) (messages []*tgbotapi.Message, err error) {
+	return s.queryMessages(`SELECT data FROM messages WHERE chat_id = ? AND date >= ? AND date <= ?
+		AND (date > ? OR (date = ? AND message_id > ?)) ORDER BY date, message_id LIMIT ?`,
+		chatID, beginTime.Unix(), endTime.Unix(), after.Date, after.Date, after.MessageID, limit)
+}
+
+// GetChatAuthors returns IDs of senders and forwarded authors of chat messages
+func (s *SQLiteStore) GetChatAuthors(chatID int64) (authors []int, err error) {
+	rows, err := s.db.Query(`SELECT from_id FROM messages WHERE chat_id = ? AND from_id != 0
+		UNION SELECT forward_from_id FROM messages WHERE chat_id = ? AND forward_from_id != 0
+		ORDER BY 1`, chatID, chatID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		if err = rows.Scan(&userID); err != nil {
+			return
+		}
+		authors = append(authors, userID)
+	}
+	err = rows.Err()
+	return
+}
+
+// GetUserChats returns chats with messages of user
+func (s *SQLiteStore) GetUserChats(userID int) (chats []*UserChat, err error) {
+	rows, err := s.db.Query(`SELECT chat_id, COUNT(*), MAX(date) FROM messages
+		WHERE from_id = ? OR forward_from_id = ? GROUP BY chat_id ORDER BY chat_id`, userID, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		chat := new(UserChat)
+		if err = rows.Scan(&chat.ChatID, &chat.Messages, &chat.LastDate); err != nil {
+			return
+		}
+		chats = append(chats, chat)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *SQLiteStore) queryMessages(query string, args ...interface{}) (messages []*tgbotapi.Message, err error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		msg := new(tgbotapi.Message)
+		if err := json.Unmarshal([]byte(data), msg); err != nil {
+			log.Printf("Error in unmarshal GetMessages: %s", err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	err = rows.Err()
+	return
+}
+
+// GetUsers returns user list
+func (s *SQLiteStore) GetUsers() (users []*tgbotapi.User, err error) {
+	return s.queryUsers(`SELECT data FROM users ORDER BY id`)
+}
+
+// GetUserByID returns user by ID
+func (s *SQLiteStore) GetUserByID(userID int) (user *tgbotapi.User, err error) {
+	users, err := s.queryUsers(`SELECT data FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return users[0], nil
+}
+
+// GetUser get user by username or first and last name
+func (s *SQLiteStore) GetUser(username string) (user *tgbotapi.User, err error) {
+	if len(username) == 0 {
+		return
+	}
+	q, err := parseUserQuery(username)
+	if err != nil {
+		return
+	}
+
+	var users []*tgbotapi.User
+	switch {
+	case q.UserName != "":
+		users, err = s.queryUsers(`SELECT data FROM users WHERE username = ?`, q.UserName)
+	case q.LastName != "":
+		users, err = s.queryUsers(`SELECT data FROM users WHERE first_name = ? AND last_name = ?`, q.FirstName, q.LastName)
+	default:
+		users, err = s.queryUsers(`SELECT data FROM users WHERE first_name = ?`, q.FirstName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(users) {
+	case 0:
+		return nil, errUserNotFound(username)
+	case 1:
+		return users[0], nil
+	}
+
+	return nil, errManyUsers(users)
+}
+
+func (s *SQLiteStore) queryUsers(query string, args ...interface{}) (users []*tgbotapi.User, err error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		user := new(tgbotapi.User)
+		if err := json.Unmarshal([]byte(data), user); err != nil {
+			log.Printf("Error in unmarshal GetUsers: %s", err)
+			continue
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *SQLiteStore) getDates(chatID int64, beginDate, endDate int64) (result []time.Time, err error) {
+	var rows *sql.Rows
+	if beginDate != 0 || endDate != 0 {
+		rows, err = s.db.Query(`SELECT DISTINCT date FROM messages WHERE chat_id = ? AND date >= ? AND date <= ? ORDER BY date`,
+			chatID, beginDate, endDate)
+	} else {
+		rows, err = s.db.Query(`SELECT DISTINCT date FROM messages WHERE chat_id = ? ORDER BY date`, chatID)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date int64
+		if err = rows.Scan(&date); err != nil {
+			return
+		}
+		result = append(result, time.Unix(date, 0))
+	}
+	err = rows.Err()
+	return
+}
+
+// GetYears function returns years msg date from chat messages
+func (s *SQLiteStore) GetYears(chatID int64) (result []string, err error) {
+	return s.caches.years(chatID, s.getDates)
+}
+
+// GetMonthList function returns month list msg date from chat messages and year
+func (s *SQLiteStore) GetMonthList(chatID int64, year int) (result []time.Month, err error) {
+	return s.caches.months(chatID, year, s.getDates)
+}
+
+// GetDates function returns month list msg date from chat messages and year
+func (s *SQLiteStore) GetDates(chatID int64, year int, month int) (result []int, err error) {
+	return s.caches.days(chatID, year, month, s.getDates)
+}
+
+// GetCensLevel function returns censore level for user
+func (s *SQLiteStore) GetCensLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	err = s.db.QueryRow(`SELECT level FROM cens_levels WHERE year = ? AND user_id = ?`,
+		time.Now().Year(), user.ID).Scan(&currentLevel)
+	err = convertSQLError(err)
+	return
+}
+
+// SetCensLevel function sets level for user
+func (s *SQLiteStore) SetCensLevel(user *tgbotapi.User, setlevel int) (err error) {
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO cens_levels (year, user_id, level) VALUES (?, ?, ?)`,
+		time.Now().Year(), user.ID, setlevel)
+	return
+}
+
+// AddCensLevel added +1 to cens level in year
+func (s *SQLiteStore) AddCensLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	year := time.Now().Year()
+	_, err = s.db.Exec(`INSERT INTO cens_levels (year, user_id, level) VALUES (?, ?, 1)
+		ON CONFLICT (year, user_id) DO UPDATE SET level = level + 1`, year, user.ID)
+	if err != nil {
+		return
+	}
+	return s.GetCensLevel(user)
+}
+
+// ClearCensLevel removes cens level for user
+func (s *SQLiteStore) ClearCensLevel(user *tgbotapi.User) (err error) {
+	res, err := s.db.Exec(`DELETE FROM cens_levels WHERE year = ? AND user_id = ?`, time.Now().Year(), user.ID)
+	return checkAffected(res, err)
+}
+
+// GetWarnLevel function returns warning level for user
+func (s *SQLiteStore) GetWarnLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	err = s.db.QueryRow(`SELECT level FROM warn_levels WHERE user_id = ?`, user.ID).Scan(&currentLevel)
+	err = convertSQLError(err)
+	return
+}
+
+// SetWarnLevel function sets level for user
+func (s *SQLiteStore) SetWarnLevel(user *tgbotapi.User, setlevel int) (err error) {
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO warn_levels (user_id, level) VALUES (?, ?)`, user.ID, setlevel)
+	return
+}
+
+// AddWarnLevel added +1 to warning level for user
+func (s *SQLiteStore) AddWarnLevel(user *tgbotapi.User) (currentLevel int, err error) {
+	_, err = s.db.Exec(`INSERT INTO warn_levels (user_id, level) VALUES (?, 1)
+		ON CONFLICT (user_id) DO UPDATE SET level = level + 1`, user.ID)
+	if err != nil {
+		return
+	}
+	return s.GetWarnLevel(user)
+}
+
+// ClearWarnLevel removes warning level for user
+func (s *SQLiteStore) ClearWarnLevel(user *tgbotapi.User) (err error) {
+	res, err := s.db.Exec(`DELETE FROM warn_levels WHERE user_id = ?`, user.ID)
+	return checkAffected(res, err)
+}
+
+// SaveWebLink method saves or updates web link
+func (s *SQLiteStore) SaveWebLink(link *WebLink) (err error) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO web_links (hash, chat_id, data) VALUES (?, ?, ?)`,
+		link.Hash, link.ChatID, string(data))
+	return
+}
+
+// GetWebLink returns web link by token hash
+func (s *SQLiteStore) GetWebLink(hash string) (link *WebLink, err error) {
+	var data string
+	if err = s.db.QueryRow(`SELECT data FROM web_links WHERE hash = ?`, hash).Scan(&data); err != nil {
+		return nil, convertSQLError(err)
+	}
+	link = new(WebLink)
+	err = json.Unmarshal([]byte(data), link)
+	return
+}
+
+// GetWebLinks returns all web links of chat
+func (s *SQLiteStore) GetWebLinks(chatID int64) (links []*WebLink, err error) {
+	rows, err := s.db.Query(`SELECT data FROM web_links WHERE chat_id = ?`, chatID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		link := new(WebLink)
+		if err = json.Unmarshal([]byte(data), link); err != nil {
+			return
+		}
+		links = append(links, link)
+	}
+	err = rows.Err()
+	sortWebLinks(links)
+	return
+}
+
+// SaveUpdateOffset method saves ID of last processed update
+func (s *SQLiteStore) SaveUpdateOffset(updateID int) (err error) {
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO update_offset (id, update_id) VALUES (1, ?)`, updateID)
+	return
+}
+
+// GetUpdateOffset returns ID of last processed update or 0 if nothing was processed
+func (s *SQLiteStore) GetUpdateOffset() (updateID int, err error) {
+	err = s.db.QueryRow(`SELECT update_id FROM update_offset WHERE id = 1`).Scan(&updateID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return
+}
+
+// SaveFailedDownload method saves or updates failed download
+func (s *SQLiteStore) SaveFailedDownload(download *FailedDownload) (err error) {
+	data, err := json.Marshal(download)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO failed_downloads (chat_id, file_id, data) VALUES (?, ?, ?)`,
+		download.ChatID, download.FileID, string(data))
+	return
+}
+
+// GetFailedDownloads returns all failed downloads
+func (s *SQLiteStore) GetFailedDownloads() (downloads []*FailedDownload, err error) {
+	rows, err := s.db.Query(`SELECT data FROM failed_downloads`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		download := new(FailedDownload)
+		if err = json.Unmarshal([]byte(data), download); err != nil {
+			return
+		}
+		downloads = append(downloads, download)
+	}
+	err = rows.Err()
+	sortFailedDownloads(downloads)
+	return
+}
+
+// DeleteFailedDownload removes failed download
+func (s *SQLiteStore) DeleteFailedDownload(chatID int64, fileID string) (err error) {
+	res, err := s.db.Exec(`DELETE FROM failed_downloads WHERE chat_id = ? AND file_id = ?`, chatID, fileID)
+	return checkAffected(res, err)
+}
+
+// SaveCaption method saves or updates caption entities of message
+func (s *SQLiteStore) SaveCaption(caption *Caption) (err error) {
+	data, err := json.Marshal(caption)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO captions (chat_id, message_id, data) VALUES (?, ?, ?)`,
+		caption.ChatID, caption.MessageID, string(data))
+	return
+}
+
+// GetCaption returns caption entities of message
+func (s *SQLiteStore) GetCaption(chatID int64, messageID int) (caption *Caption, err error) {
+	var data string
+	err = s.db.QueryRow(`SELECT data FROM captions WHERE chat_id = ? AND message_id = ?`, chatID, messageID).Scan(&data)
+	if err != nil {
+		return nil, convertSQLError(err)
+	}
+	caption = new(Caption)
+	err = json.Unmarshal([]byte(data), caption)
+	return
+}
+
+// SaveMediaRef method saves or updates media ref
+func (s *SQLiteStore) SaveMediaRef(ref *MediaRef) (err error) {
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO media_refs (chat_id, file_id, hash, data) VALUES (?, ?, ?, ?)`,
+		ref.ChatID, ref.FileID, ref.Hash, string(data))
+	return
+}
+
+// GetMediaRef returns media ref of file in chat
+func (s *SQLiteStore) GetMediaRef(chatID int64, fileID string) (ref *MediaRef, err error) {
+	var data string
+	err = s.db.QueryRow(`SELECT data FROM media_refs WHERE chat_id = ? AND file_id = ?`, chatID, fileID).Scan(&data)
+	if err != nil {
+		return nil, convertSQLError(err)
+	}
+	ref = new(MediaRef)
+	err = json.Unmarshal([]byte(data), ref)
+	return
+}
+
+// GetMediaRefs returns all media refs
+func (s *SQLiteStore) GetMediaRefs() (refs []*MediaRef, err error) {
+	rows, err := s.db.Query(`SELECT data FROM media_refs ORDER BY chat_id, file_id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		ref := new(MediaRef)
+		if err = json.Unmarshal([]byte(data), ref); err != nil {
+			return
+		}
+		refs = append(refs, ref)
+	}
+	err = rows.Err()
+	return
+}
+
+// SaveChatRole method saves or updates role of user in chat
+func (s *SQLiteStore) SaveChatRole(role *ChatRole) (err error) {
+	data, err := json.Marshal(role)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO chat_roles (chat_id, user_id, data) VALUES (?, ?, ?)`,
+		role.ChatID, role.UserID, string(data))
+	return
+}
+
+// GetChatRoles returns roles of users in chat
+func (s *SQLiteStore) GetChatRoles(chatID int64) (roles []*ChatRole, err error) {
+	rows, err := s.db.Query(`SELECT data FROM chat_roles WHERE chat_id = ? ORDER BY user_id`, chatID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		role := new(ChatRole)
+		if err = json.Unmarshal([]byte(data), role); err != nil {
+			return
+		}
+		roles = append(roles, role)
+	}
+	err = rows.Err()
+	return
+}
+
+// DeleteChatRole removes role of user in chat
+func (s *SQLiteStore) DeleteChatRole(chatID int64, userID int) (err error) {
+	res, err := s.db.Exec(`DELETE FROM chat_roles WHERE chat_id = ? AND user_id = ?`, chatID, userID)
+	return checkAffected(res, err)
+}
+
+// SaveSanction method saves or updates sanction
+func (s *SQLiteStore) SaveSanction(sanction *Sanction) (err error) {
+	data, err := json.Marshal(sanction)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO sanctions (chat_id, user_id, kind, data) VALUES (?, ?, ?, ?)`,
+		sanction.ChatID, sanction.UserID, sanction.Kind, string(data))
+	return
+}
+
+// GetSanctions returns all active sanctions
+func (s *SQLiteStore) GetSanctions() (sanctions []*Sanction, err error) {
+	rows, err := s.db.Query(`SELECT data FROM sanctions`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		sanction := new(Sanction)
+		if err = json.Unmarshal([]byte(data), sanction); err != nil {
+			return
+		}
+		sanctions = append(sanctions, sanction)
+	}
+	err = rows.Err()
+	sortSanctions(sanctions)
+	return
+}
+
+// DeleteSanction removes sanction
+func (s *SQLiteStore) DeleteSanction(chatID int64, userID int, kind string) (err error) {
+	res, err := s.db.Exec(`DELETE FROM sanctions WHERE chat_id = ? AND user_id = ? AND kind = ?`, chatID, userID, kind)
+	return checkAffected(res, err)
+}
+
+// sqliteDocumentTables maps document key prefixes to tables
+var sqliteDocumentTables = map[string]string{
+	"message:":   "messages",
+	"caption:":   "captions",
+	"user:":      "users",
+	"chat:":      "chats",
+	"file:":      "files",
+	"censlevel:": "cens_levels",
+	"warnlevel:": "warn_levels",
+	"revision:":  "message_revisions",
+	"weblink:":   "web_links",
+	"offset:":    "update_offset",
+	"download:":  "failed_downloads",
+	"media:":     "media_refs",
+	"role:":      "chat_roles",
+	"sanction:":  "sanctions",
+}
+
+// ImportDocument saves migrated document
+func (s *SQLiteStore) ImportDocument(doc Document) (err error) {
+	value, err := decodeDocument(doc)
+	if err != nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case *tgbotapi.Message:
+		err = s.insertMessage(v)
+	case *tgbotapi.User:
+		err = s.SaveUser(v)
+	case *chatDocument:
+		err = s.SaveChat(&v.Chat, v.Type == "forward-chat")
+	case *fileDocument:
+		err = s.SaveFile(v.File, v.ChatID)
+	case *CensLevel:
+		_, err = s.db.Exec(`INSERT OR REPLACE INTO cens_levels (year, user_id, level) VALUES (?, ?, ?)`,
+			v.Year, v.ID, v.Level)
+	case *WarnLevel:
+		err = s.SetWarnLevel(&tgbotapi.User{ID: v.ID}, v.Level)
+	case *Caption:
+		err = s.SaveCaption(v)
+	case *MessageRevision:
+		err = s.insertRevision(v)
+	case *WebLink:
+		err = s.SaveWebLink(v)
+	case *UpdateOffset:
+		err = s.SaveUpdateOffset(v.UpdateID)
+	case *FailedDownload:
+		err = s.SaveFailedDownload(v)
+	case *MediaRef:
+		err = s.SaveMediaRef(v)
+	case *ChatRole:
+		err = s.SaveChatRole(v)
+	case *Sanction:
+		err = s.SaveSanction(v)
+	}
+	return
+}
+
+// CountDocuments returns count of documents with key prefix
+func (s *SQLiteStore) CountDocuments(prefix string) (count int, err error) {
+	table, ok := sqliteDocumentTables[prefix]
+	if !ok {
+		return 0, fmt.Errorf("unknown document prefix %s", prefix)
+	}
+	// table name is taken from constant map above
+	err = s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+	return
+}
+
+// convertSQLError converts database/sql specific errors to db package errors
+func convertSQLError(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// checkAffected returns ErrNotFound if statement changed nothing
+func checkAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// WebLink is a read-only access token to web log of one chat, records weblink:hash.
+// Only hash of token is stored, token itself is shown once on creation.
+type WebLink struct {
+	Hash      string `json:"hash"`
+	ChatID    int64  `json:"chat_id"`
+	CreatedBy int    `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"` // 0 for link without expiration
+	Revoked   bool   `json:"revoked"`
+}
+
+// NewWebLink function creates link for chat with random token, ttl 0 means link without expiration
+func NewWebLink(chatID int64, createdBy int, ttl time.Duration) (link *WebLink, token string, err error) {
+	data := make([]byte, 16)
+	if _, err = rand.Read(data); err != nil {
+		return
+	}
+	token = hex.EncodeToString(data)
+
+	now := time.Now()
+	link = &WebLink{Hash: WebLinkHash(token), ChatID: chatID, CreatedBy: createdBy, CreatedAt: now.Unix()}
+	if ttl > 0 {
+		link.ExpiresAt = now.Add(ttl).Unix()
+	}
+	return
+}
+
+// WebLinkHash function returns hash of token for store
+func WebLinkHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ID method returns short link identifier for commands
+func (link *WebLink) ID() string {
+	return link.Hash[:8]
+}
+
+// Active method returns true if link is not revoked and not expired
+func (link *WebLink) Active(now time.Time) bool {
+	return !link.Revoked && (link.ExpiresAt == 0 || now.Unix() < link.ExpiresAt)
+}
+
+// sortWebLinks sorts links by creation time
+func sortWebLinks(links []*WebLink) {
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt < links[j].CreatedAt })
+}
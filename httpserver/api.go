@@ -0,0 +1,521 @@
+package httpserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// APIError is an error response of API
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// APIChat is a chat of API
+type APIChat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	UserName string `json:"username,omitempty"`
+}
+
+// APIUser is a user of API
+type APIUser struct {
+	ID        int    `json:"id"`
+	UserName  string `json:"username,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+}
+
+// APIAttachment is a file attached to message
+type APIAttachment struct {
+	Type     string `json:"type"`
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int    `json:"file_size,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// APIMessage is a message of API
+type APIMessage struct {
+	ID               int             `json:"id"`
+	ChatID           int64           `json:"chat_id"`
+	Date             time.Time       `json:"date"`
+	EditDate         *time.Time      `json:"edit_date,omitempty"`
+	From             *APIUser        `json:"from,omitempty"`
+	ForwardFrom      *APIUser        `json:"forward_from,omitempty"`
+	ForwardFromChat  *APIChat        `json:"forward_from_chat,omitempty"`
+	ReplyToMessageID int             `json:"reply_to_message_id,omitempty"`
+	Text             string          `json:"text,omitempty"`
+	Caption          string          `json:"caption,omitempty"`
+	Attachments      []APIAttachment `json:"attachments,omitempty"`
+}
+
+// APIMessagesPage is a page of messages, NextCursor is empty on last page
+type APIMessagesPage struct {
+	Messages   []APIMessage `json:"messages"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// APIFile is a metadata of downloaded file
+type APIFile struct {
+	FileID   string `json:"file_id"`
+	FileSize int    `json:"file_size,omitempty"`
+	FilePath string `json:"file_path"`
+	URL      string `json:"url"`
+}
+
+// APIFailedDownload is a file which was not downloaded
+type APIFailedDownload struct {
+	ChatID   int64     `json:"chat_id"`
+	FileID   string    `json:"file_id"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// APIDownloads is a status of files downloader
+type APIDownloads struct {
+	Workers int                 `json:"workers"`
+	Queued  int                 `json:"queued"`
+	Active  int                 `json:"active"`
+	Pending int                 `json:"pending"`
+	Failed  []APIFailedDownload `json:"failed"`
+}
+
+// registerAPI adds API v1 routes to router
+func (s *Server) registerAPI(r *gin.Engine) {
+	api := r.Group("/api/v1")
+	api.GET("/openapi.json", s.apiOpenAPI)
+	api.GET("/chats", s.apiChats)
+
+	chat := api.Group("/chats/:chat_id", s.apiChatAccess)
+	chat.GET("/years", s.apiYears)
+	chat.GET("/years/:year/months", s.apiMonths)
+	chat.GET("/years/:year/months/:month/days", s.apiDays)
+	chat.GET("/messages", s.apiMessages)
+	chat.GET("/files/:file_id", s.apiFile)
+
+	users := api.Group("/users", s.apiLoginRequired)
+	users.GET("", s.apiUsers)
+	users.GET("/:user_id", s.apiUser)
+
+	downloads := api.Group("/downloads", s.apiLoginRequired)
+	downloads.GET("", s.apiDownloads)
+	downloads.POST("/retry", s.apiRetryDownloads)
+}
+
+func apiError(c *gin.Context, code int, format string, args ...interface{}) {
+	c.JSON(code, APIError{Error: fmt.Sprintf(format, args...)})
+}
+
+// apiIntParams parses int path parameters by names, writes error response if one of them is bad
+func apiIntParams(c *gin.Context, names ...string) (values []int64, ok bool) {
+	for _, name := range names {
+		value, err := strconv.ParseInt(c.Param(name), 10, 64)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "bad %s: %s", name, c.Param(name))
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+func (s *Server) apiOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(openAPISpec))
+}
+
+func (s *Server) apiChats(c *gin.Context) {
+	chats, err := s.DB.GetChats()
+	if err != nil {
+		log.Printf("Error in GetChats: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get chats")
+		return
+	}
+	userID := sessionUserID(c)
+	result := make([]APIChat, 0, len(chats))
+	for _, chat := range chats {
+		if !s.CanViewChat(userID, chat.ID) {
+			continue
+		}
+		result = append(result, *newAPIChat(chat))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) apiYears(c *gin.Context) {
+	params, ok := apiIntParams(c, "chat_id")
+	if !ok {
+		return
+	}
+	years, err := s.DB.GetYears(params[0])
+	if err != nil {
+		log.Printf("Error in GetYears for chat %d: %s", params[0], err)
+		apiError(c, http.StatusInternalServerError, "cannot get years")
+		return
+	}
+	result := make([]int, 0, len(years))
+	for _, year := range years {
+		if y, err := strconv.Atoi(year); err == nil {
+			result = append(result, y)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) apiMonths(c *gin.Context) {
+	params, ok := apiIntParams(c, "chat_id", "year")
+	if !ok {
+		return
+	}
+	months, err := s.DB.GetMonthList(params[0], int(params[1]))
+	if err != nil {
+		log.Printf("Error in GetMonthList for chat %d: %s", params[0], err)
+		apiError(c, http.StatusInternalServerError, "cannot get months")
+		return
+	}
+	result := make([]int, 0, len(months))
+	for _, month := range months {
+		result = append(result, int(month))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) apiDays(c *gin.Context) {
+	params, ok := apiIntParams(c, "chat_id", "year", "month")
+	if !ok {
+		return
+	}
+	days, err := s.DB.GetDates(params[0], int(params[1]), int(params[2]))
+	if err != nil {
+		log.Printf("Error in GetDates for chat %d: %s", params[0], err)
+		apiError(c, http.StatusInternalServerError, "cannot get days")
+		return
+	}
+	if days == nil {
+		days = []int{}
+	}
+	c.JSON(http.StatusOK, days)
+}
+
+// apiMessages returns messages of chat between from and to ordered by date.
+// from and to are RFC3339 times or unix timestamps, cursor is a next_cursor of previous page.
+func (s *Server) apiMessages(c *gin.Context) {
+	params, ok := apiIntParams(c, "chat_id")
+	if !ok {
+		return
+	}
+	chatID := params[0]
+
+	beginTime, err := parseAPITime(c.Query("from"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "bad from: %s", err)
+		return
+	}
+	endTime, err := parseAPITime(c.DefaultQuery("to", strconv.FormatInt(time.Now().Unix(), 10)))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "bad to: %s", err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(apiDefaultLimit)))
+	if err != nil || limit < 1 || limit > apiMaxLimit {
+		apiError(c, http.StatusBadRequest, "limit must be between 1 and %d", apiMaxLimit)
+		return
+	}
+	var after db.MessageCursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		if after.Date, after.MessageID, err = decodeCursor(cursor); err != nil {
+			apiError(c, http.StatusBadRequest, "bad cursor")
+			return
+		}
+	}
+
+	// one more message shows that next page exists
+	msgs, err := s.DB.GetMessagesPage(chatID, beginTime, endTime, after, limit+1)
+	if err != nil {
+		log.Printf("Error in GetMessagesPage for chat %d: %s", chatID, err)
+		apiError(c, http.StatusInternalServerError, "cannot get messages")
+		return
+	}
+
+	page := APIMessagesPage{Messages: []APIMessage{}}
+	for i, msg := range msgs {
+		if i == limit {
+			last := msgs[limit-1]
+			page.NextCursor = encodeCursor(last.Date, last.MessageID)
+			break
+		}
+		page.Messages = append(page.Messages, newAPIMessage(msg))
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (s *Server) apiFile(c *gin.Context) {
+	params, ok := apiIntParams(c, "chat_id")
+	if !ok {
+		return
+	}
+	f, err := s.DB.GetFile(c.Param("file_id"), params[0])
+	if err == db.ErrNotFound {
+		apiError(c, http.StatusNotFound, "file not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error in GetFile: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get file")
+		return
+	}
+	c.JSON(http.StatusOK, APIFile{
+		FileID:   f.FileID,
+		FileSize: f.FileSize,
+		FilePath: f.FilePath,
+		URL:      "/" + fileURL(params[0], f.FileID),
+	})
+}
+
+// apiUsers returns users seen in chats available for logged user
+func (s *Server) apiUsers(c *gin.Context) {
+	visible, err := s.visibleUsers(sessionUserID(c))
+	if err != nil {
+		log.Printf("Error in visibleUsers: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get users")
+		return
+	}
+	users, err := s.DB.GetUsers()
+	if err != nil {
+		log.Printf("Error in GetUsers: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get users")
+		return
+	}
+	result := make([]APIUser, 0, len(users))
+	for _, user := range users {
+		if visible[user.ID] {
+			result = append(result, *newAPIUser(user))
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// apiUser returns user seen in chats available for logged user
+func (s *Server) apiUser(c *gin.Context) {
+	params, ok := apiIntParams(c, "user_id")
+	if !ok {
+		return
+	}
+	visible, err := s.userVisible(sessionUserID(c), int(params[0]))
+	if err != nil {
+		log.Printf("Error in userVisible: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get users")
+		return
+	}
+	if !visible {
+		apiError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	user, err := s.DB.GetUserByID(int(params[0]))
+	if err == db.ErrNotFound {
+		apiError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error in GetUserByID: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get users")
+		return
+	}
+	c.JSON(http.StatusOK, newAPIUser(user))
+}
+
+// visibleUsers method returns IDs of logged user and authors of messages in chats available for logged user
+func (s *Server) visibleUsers(userID int) (users map[int]bool, err error) {
+	chats, err := s.DB.GetChats()
+	if err != nil {
+		return
+	}
+	users = map[int]bool{userID: true}
+	for _, chat := range chats {
+		if !s.CanViewChat(userID, chat.ID) {
+			continue
+		}
+		authors, err := s.DB.GetChatAuthors(chat.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot get authors of chat %d: %s", chat.ID, err)
+		}
+		for _, authorID := range authors {
+			users[authorID] = true
+		}
+	}
+	return
+}
+
+// userVisible method returns true if user is a logged user or an author of messages in chats available for logged user
+func (s *Server) userVisible(viewerID, userID int) (visible bool, err error) {
+	if userID == viewerID {
+		return true, nil
+	}
+	chats, err := s.DB.GetUserChats(userID)
+	if err != nil {
+		return
+	}
+	for _, chat := range chats {
+		if s.CanViewChat(viewerID, chat.ChatID) {
+			return true, nil
+		}
+	}
+	return
+}
+
+func newAPIChat(chat *tgbotapi.Chat) *APIChat {
+	if chat == nil {
+		return nil
+	}
+	title := chat.Title
+	if title == "" {
+		title = strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+	}
+	return &APIChat{ID: chat.ID, Type: chat.Type, Title: title, UserName: chat.UserName}
+}
+
+func newAPIUser(user *tgbotapi.User) *APIUser {
+	if user == nil {
+		return nil
+	}
+	return &APIUser{ID: user.ID, UserName: user.UserName, FirstName: user.FirstName, LastName: user.LastName}
+}
+
+func newAPIMessage(msg *tgbotapi.Message) (m APIMessage) {
+	m = APIMessage{
+		ID:              msg.MessageID,
+		ChatID:          msg.Chat.ID,
+		Date:            time.Unix(int64(msg.Date), 0).UTC(),
+		From:            newAPIUser(msg.From),
+		ForwardFrom:     newAPIUser(msg.ForwardFrom),
+		ForwardFromChat: newAPIChat(msg.ForwardFromChat),
+		Text:            msg.Text,
+		Caption:         msg.Caption,
+	}
+	if msg.EditDate != 0 {
+		editDate := time.Unix(int64(msg.EditDate), 0).UTC()
+		m.EditDate = &editDate
+	}
+	if msg.ReplyToMessage != nil {
+		m.ReplyToMessageID = msg.ReplyToMessage.MessageID
+	}
+
+	if msg.Photo != nil && len(*msg.Photo) > 0 {
+		photos := *msg.Photo
+		photo := photos[len(photos)-1]
+		m.Attachments = append(m.Attachments, APIAttachment{Type: "photo", FileID: photo.FileID,
+			FileSize: photo.FileSize, Width: photo.Width, Height: photo.Height})
+	}
+	if a := msg.Audio; a != nil {
+		m.Attachments = append(m.Attachments, APIAttachment{Type: "audio", FileID: a.FileID,
+			FileName: a.Title, MimeType: a.MimeType, FileSize: a.FileSize, Duration: a.Duration})
+	}
+	if d := msg.Document; d != nil {
+		m.Attachments = append(m.Attachments, APIAttachment{Type: "document", FileID: d.FileID,
+			FileName: d.FileName, MimeType: d.MimeType, FileSize: d.FileSize})
+	}
+	if st := msg.Sticker; st != nil {
+		m.Attachments = append(m.Attachments, APIAttachment{Type: "sticker", FileID: st.FileID,
+			FileSize: st.FileSize, Width: st.Width, Height: st.Height})
+	}
+	if v := msg.Video; v != nil {
+		m.Attachments = append(m.Attachments, APIAttachment{Type: "video", FileID: v.FileID,
+			MimeType: v.MimeType, FileSize: v.FileSize, Duration: v.Duration, Width: v.Width, Height: v.Height})
+	}
+	if v := msg.Voice; v != nil {
+		m.Attachments = append(m.Attachments, APIAttachment{Type: "voice", FileID: v.FileID,
+			MimeType: v.MimeType, FileSize: v.FileSize, Duration: v.Duration})
+	}
+	return
+}
+
+// parseAPITime parses RFC3339 time or unix timestamp, empty string is a zero unix time
+func parseAPITime(value string) (t time.Time, err error) {
+	if value == "" {
+		return time.Unix(0, 0), nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// encodeCursor returns opaque cursor for message position
+func encodeCursor(date, messageID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", date, messageID)))
+}
+
+func decodeCursor(cursor string) (date, messageID int, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Sscanf(string(data), "%d:%d", &date, &messageID)
+	return
+}
+
+// apiDownloads returns status of downloader and failed downloads of chats visible for user
+func (s *Server) apiDownloads(c *gin.Context) {
+	downloads, err := s.DB.GetFailedDownloads()
+	if err != nil {
+		log.Printf("Error in GetFailedDownloads: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot get failed downloads")
+		return
+	}
+
+	status := s.DownloadStatus()
+	result := APIDownloads{
+		Workers: status.Workers,
+		Queued:  status.Queued,
+		Active:  status.Active,
+		Pending: status.Pending,
+		Failed:  make([]APIFailedDownload, 0),
+	}
+	userID := sessionUserID(c)
+	for _, download := range downloads {
+		if !s.CanViewChat(userID, download.ChatID) {
+			continue
+		}
+		result.Failed = append(result.Failed, APIFailedDownload{
+			ChatID:   download.ChatID,
+			FileID:   download.FileID,
+			Attempts: download.Attempts,
+			Error:    download.Error,
+			FailedAt: time.Unix(download.FailedAt, 0).UTC(),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// apiRetryDownloads queues failed downloads of chats visible for user
+func (s *Server) apiRetryDownloads(c *gin.Context) {
+	userID := sessionUserID(c)
+	count, err := s.RetryFailedDownloads(func(download *db.FailedDownload) bool {
+		return s.CanViewChat(userID, download.ChatID)
+	})
+	if err != nil {
+		log.Printf("Error in RetryFailedDownloads: %s", err)
+		apiError(c, http.StatusInternalServerError, "cannot retry failed downloads")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"queued": count})
+}
@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// apiGet returns status and body of API request of logged user, userID 0 is an anonymous user
+func apiGet(s *Server, userID int, path string) (int, []byte) {
+	r := gin.New()
+	r.Use(s.sessionMiddleware)
+	s.registerAPI(r)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	if userID != 0 {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.newSession(userID, time.Now().Add(time.Hour))})
+	}
+	r.ServeHTTP(w, req)
+	return w.Code, w.Body.Bytes()
+}
+
+func TestAPIMessagesCursor(t *testing.T) {
+	store := db.NewMemoryStore()
+	s := &Server{DB: store, PublicChats: []int64{-5}}
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	base := int(time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC).Unix())
+
+	// messages with the same date are ordered by ID, they are saved in random order
+	dates := map[int]int{5: base, 2: base, 7: base + 1, 1: base + 1, 3: base + 1, 6: base + 2, 4: base + 3}
+	for id, date := range dates {
+		if err := store.SaveMessage(&tgbotapi.Message{MessageID: id, Date: date, Chat: chat, Text: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []int{2, 5, 1, 3, 7, 6, 4}
+
+	var ids []int
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		query := url.Values{"from": {"2017-05-01T00:00:00Z"}, "to": {"2017-05-02T00:00:00Z"}, "limit": {"3"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		code, body := apiGet(s, 0, "/api/v1/chats/-5/messages?"+query.Encode())
+		if code != http.StatusOK {
+			t.Fatalf("Page %d: status %d, %s", page, code, body)
+		}
+		var result APIMessagesPage
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range result.Messages {
+			ids = append(ids, msg.ID)
+		}
+
+		if page == 0 {
+			// messages before cursor do not shift next pages
+			store.SaveMessage(&tgbotapi.Message{MessageID: 8, Date: base, Chat: chat, Text: "x"})
+		}
+		if result.NextCursor == "" {
+			if len(result.Messages) == 0 {
+				t.Errorf("Last page is empty")
+			}
+			break
+		}
+		if len(result.Messages) != 3 {
+			t.Errorf("Page %d has %d messages, next cursor %q", page, len(result.Messages), result.NextCursor)
+		}
+		cursor = result.NextCursor
+	}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("Messages are paged as %v, expected %v", ids, expected)
+	}
+
+	for _, query := range []string{"cursor=bad", "limit=0", "limit=1001", "from=x"} {
+		if code, _ := apiGet(s, 0, "/api/v1/chats/-5/messages?"+query); code != http.StatusBadRequest {
+			t.Errorf("Status of %s is %d", query, code)
+		}
+	}
+}
+
+func TestAPIUsers(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	// logged user is not a member of private chat
+	api.status = "left"
+	s := api.server()
+	s.DB = db.NewMemoryStore()
+	s.PublicChats = []int64{-9}
+
+	public := &tgbotapi.Chat{ID: -9, Type: "supergroup"}
+	private := &tgbotapi.Chat{ID: -10, Type: "supergroup"}
+	for _, chat := range []*tgbotapi.Chat{public, private} {
+		s.DB.SaveChat(chat, false)
+	}
+	for _, user := range []*tgbotapi.User{{ID: 3, FirstName: "a"}, {ID: 4, FirstName: "f"}, {ID: 5, FirstName: "b"}, {ID: 7, FirstName: "me"}} {
+		s.DB.SaveUser(user)
+	}
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 1, Chat: public, From: &tgbotapi.User{ID: 3}, ForwardFrom: &tgbotapi.User{ID: 4}, Date: 1})
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 1, Chat: private, From: &tgbotapi.User{ID: 5}, Date: 1})
+
+	code, body := apiGet(s, 7, "/api/v1/users")
+	if code != http.StatusOK {
+		t.Fatalf("Status %d, %s", code, body)
+	}
+	var users []APIUser
+	if err := json.Unmarshal(body, &users); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	if fmt.Sprint(ids) != "[3 4 7]" {
+		t.Errorf("Visible users are %v, expected [3 4 7]", ids)
+	}
+
+	for userID, expected := range map[int]int{3: http.StatusOK, 4: http.StatusOK, 7: http.StatusOK, 5: http.StatusNotFound, 6: http.StatusNotFound} {
+		if code, body = apiGet(s, 7, fmt.Sprintf("/api/v1/users/%d", userID)); code != expected {
+			t.Errorf("Status of user %d is %d, expected %d: %s", userID, code, expected, body)
+		}
+	}
+	if code, _ = apiGet(s, 0, "/api/v1/users"); code != http.StatusUnauthorized {
+		t.Errorf("Users are available without login: %d", code)
+	}
+}
@@ -0,0 +1,279 @@
+package httpserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	sessionCookie     = "session"
+	sessionTTL        = time.Hour * 24 * 30
+	loginDataTTL      = time.Hour * 24
+	memberCacheTTL    = time.Minute * 5
+	contextUserIDKey  = "user_id"
+	telegramHashField = "hash"
+)
+
+// memberKey is a key of membership cache
+type memberKey struct {
+	chatID int64
+	userID int
+}
+
+type memberEntry struct {
+	member  bool
+	expires time.Time
+}
+
+// memberCache caches chat membership checks, because every page view checks it
+type memberCache struct {
+	sync.Mutex
+	entries map[memberKey]memberEntry
+}
+
+// registerAuth adds login and logout routes and session middleware
+func (s *Server) registerAuth(r *gin.Engine) {
+	r.Use(s.sessionMiddleware)
+	r.GET("/login", s.loginPage)
+	r.GET("/auth/telegram", s.telegramAuth)
+	r.GET("/logout", s.logout)
+}
+
+// sessionMiddleware sets user_id of valid session cookie to context
+func (s *Server) sessionMiddleware(c *gin.Context) {
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		if userID, ok := s.parseSession(cookie); ok {
+			c.Set(contextUserIDKey, userID)
+		}
+	}
+	c.Next()
+}
+
+// chatAccess is a middleware for /chat/:chat_id routes, it allows public chats, chats of logged user
+// and requests with web link token of chat
+func (s *Server) chatAccess(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("chat_id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusOK, err.Error())
+		c.Abort()
+		return
+	}
+	userID := sessionUserID(c)
+	if s.CanViewChat(userID, chatID) || s.webLinkAccess(c, chatID) {
+		c.Next()
+		return
+	}
+	if userID == 0 {
+		c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+	} else {
+		c.String(http.StatusForbidden, "Access denied")
+	}
+	c.Abort()
+}
+
+// apiChatAccess is a chatAccess for API routes
+func (s *Server) apiChatAccess(c *gin.Context) {
+	params, ok := apiIntParams(c, "chat_id")
+	if !ok {
+		c.Abort()
+		return
+	}
+	userID := sessionUserID(c)
+	if s.CanViewChat(userID, params[0]) {
+		c.Next()
+		return
+	}
+	if userID == 0 {
+		apiError(c, http.StatusUnauthorized, "login required")
+	} else {
+		apiError(c, http.StatusForbidden, "access denied")
+	}
+	c.Abort()
+}
+
+// apiLoginRequired is a middleware for API routes available for every logged user
+func (s *Server) apiLoginRequired(c *gin.Context) {
+	if sessionUserID(c) == 0 {
+		apiError(c, http.StatusUnauthorized, "login required")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// sessionUserID returns logged user ID or 0
+func sessionUserID(c *gin.Context) int {
+	return c.GetInt(contextUserIDKey)
+}
+
+// CanViewChat returns true if chat is public or user is a member of it
+func (s *Server) CanViewChat(userID int, chatID int64) bool {
+	for _, id := range s.PublicChats {
+		if id == chatID {
+			return true
+		}
+	}
+	if userID == 0 {
+		return false
+	}
+	// private chat of user with bot
+	if chatID == int64(userID) {
+		return true
+	}
+	return s.isChatMember(userID, chatID)
+}
+
+// isChatMember asks Telegram about membership of user, answers are cached for memberCacheTTL
+func (s *Server) isChatMember(userID int, chatID int64) bool {
+	key := memberKey{chatID: chatID, userID: userID}
+	s.members.Lock()
+	if s.members.entries == nil {
+		s.members.entries = make(map[memberKey]memberEntry)
+	}
+	entry, ok := s.members.entries[key]
+	s.members.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.member
+	}
+
+	member, err := s.Bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID})
+	if err != nil {
+		log.Printf("Error in GetChatMember for user %d in chat %d: %s", userID, chatID, err)
+		return false
+	}
+	entry = memberEntry{expires: time.Now().Add(memberCacheTTL)}
+	switch member.Status {
+	case "creator", "administrator", "member", "restricted":
+		entry.member = true
+	}
+
+	s.members.Lock()
+	s.members.entries[key] = entry
+	s.members.Unlock()
+	return entry.member
+}
+
+func (s *Server) loginPage(c *gin.Context) {
+	s.render(c, "login.html", map[string]interface{}{
+		"BotName": s.Bot.Self.UserName,
+		"AuthURL": "/auth/telegram?next=" + url.QueryEscape(safeRedirect(c.Query("next"))),
+		"UserID":  sessionUserID(c),
+	})
+}
+
+// telegramAuth handles redirect of Telegram Login Widget, creates session if signature is valid
+func (s *Server) telegramAuth(c *gin.Context) {
+	query := c.Request.URL.Query()
+	next := safeRedirect(query.Get("next"))
+	query.Del("next")
+
+	userID, err := s.checkTelegramAuth(query, time.Now())
+	if err != nil {
+		log.Printf("Telegram login failed: %s", err)
+		c.String(http.StatusUnauthorized, "Login failed")
+		return
+	}
+
+	c.SetCookie(sessionCookie, s.newSession(userID, time.Now().Add(sessionTTL)),
+		int(sessionTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, next)
+}
+
+func (s *Server) logout(c *gin.Context) {
+	c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, "/")
+}
+
+// checkTelegramAuth verifies data of Telegram Login Widget and returns user ID,
+// see https://core.telegram.org/widgets/login#checking-authorization
+func (s *Server) checkTelegramAuth(data url.Values, now time.Time) (userID int, err error) {
+	hash := data.Get(telegramHashField)
+	if hash == "" {
+		return 0, fmt.Errorf("no hash")
+	}
+
+	var fields []string
+	for key := range data {
+		if key != telegramHashField {
+			fields = append(fields, key+"="+data.Get(key))
+		}
+	}
+	sort.Strings(fields)
+
+	secret := sha256.Sum256([]byte(s.APIKey))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return 0, fmt.Errorf("bad hash")
+	}
+
+	authDate, err := strconv.ParseInt(data.Get("auth_date"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad auth_date")
+	}
+	if now.Sub(time.Unix(authDate, 0)) > loginDataTTL {
+		return 0, fmt.Errorf("auth_date is too old")
+	}
+
+	if userID, err = strconv.Atoi(data.Get("id")); err != nil {
+		return 0, fmt.Errorf("bad id")
+	}
+	return
+}
+
+// sessionMAC signs session payload with key derived from bot token
+func (s *Server) sessionMAC(payload string) string {
+	key := sha256.Sum256([]byte("session:" + s.APIKey))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newSession returns signed session cookie value <user_id>:<expires>:<mac>
+func (s *Server) newSession(userID int, expires time.Time) string {
+	payload := fmt.Sprintf("%d:%d", userID, expires.Unix())
+	return payload + ":" + s.sessionMAC(payload)
+}
+
+// parseSession checks session cookie value and returns user ID
+func (s *Server) parseSession(value string) (userID int, ok bool) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return
+	}
+	payload, mac := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(s.sessionMAC(payload))) {
+		return
+	}
+
+	var expires int64
+	if _, err := fmt.Sscanf(payload, "%d:%d", &userID, &expires); err != nil {
+		return 0, false
+	}
+	if time.Now().Unix() > expires {
+		return 0, false
+	}
+	return userID, true
+}
+
+// safeRedirect allows only local paths for redirect after login
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
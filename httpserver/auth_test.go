@@ -0,0 +1,250 @@
+package httpserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+)
+
+// signLogin adds hash of Telegram Login Widget to data
+func signLogin(token string, data url.Values) url.Values {
+	var fields []string
+	for key := range data {
+		fields = append(fields, key+"="+data.Get(key))
+	}
+	sort.Strings(fields)
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	data.Set(telegramHashField, hex.EncodeToString(mac.Sum(nil)))
+	return data
+}
+
+// loginData returns signed login data of user with auth_date
+func loginData(token string, userID int, authDate time.Time) url.Values {
+	return signLogin(token, url.Values{
+		"id":         {strconv.Itoa(userID)},
+		"first_name": {"Ivan"},
+		"username":   {"ivan"},
+		"auth_date":  {strconv.FormatInt(authDate.Unix(), 10)},
+	})
+}
+
+func TestCheckTelegramAuth(t *testing.T) {
+	s := &Server{APIKey: "123:ABC"}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		data   func() url.Values
+		userID int
+	}{
+		{"valid", func() url.Values { return loginData(s.APIKey, 42, now) }, 42},
+		{"upper case hash", func() url.Values {
+			data := loginData(s.APIKey, 42, now)
+			data.Set("hash", strings.ToUpper(data.Get("hash")))
+			return data
+		}, 42},
+		{"tampered id", func() url.Values {
+			data := loginData(s.APIKey, 42, now)
+			data.Set("id", "43")
+			return data
+		}, 0},
+		{"tampered name", func() url.Values {
+			data := loginData(s.APIKey, 42, now)
+			data.Set("first_name", "Eve")
+			return data
+		}, 0},
+		{"added field", func() url.Values {
+			data := loginData(s.APIKey, 42, now)
+			data.Set("photo_url", "https://example.com/eve.jpg")
+			return data
+		}, 0},
+		{"other bot", func() url.Values { return loginData("456:DEF", 42, now) }, 0},
+		{"no hash", func() url.Values {
+			data := loginData(s.APIKey, 42, now)
+			data.Del("hash")
+			return data
+		}, 0},
+		{"expired auth_date", func() url.Values { return loginData(s.APIKey, 42, now.Add(-loginDataTTL-time.Minute)) }, 0},
+		{"not expired auth_date", func() url.Values { return loginData(s.APIKey, 42, now.Add(-loginDataTTL+time.Minute)) }, 42},
+		{"bad auth_date", func() url.Values {
+			return signLogin(s.APIKey, url.Values{"id": {"42"}, "auth_date": {"yesterday"}})
+		}, 0},
+		{"bad id", func() url.Values {
+			return signLogin(s.APIKey, url.Values{"id": {"ivan"}, "auth_date": {strconv.FormatInt(now.Unix(), 10)}})
+		}, 0},
+	}
+	for _, test := range tests {
+		userID, err := s.checkTelegramAuth(test.data(), now)
+		if userID != test.userID || (err == nil) != (test.userID != 0) {
+			t.Errorf("%s: checkTelegramAuth returns %d, %v", test.name, userID, err)
+		}
+	}
+}
+
+func TestParseSession(t *testing.T) {
+	s := &Server{APIKey: "123:ABC"}
+	other := &Server{APIKey: "456:DEF"}
+	valid := s.newSession(42, time.Now().Add(time.Hour))
+	payload := valid[:strings.LastIndex(valid, ":")]
+	mac := valid[strings.LastIndex(valid, ":")+1:]
+
+	tests := []struct {
+		name   string
+		value  string
+		userID int
+	}{
+		{"valid", valid, 42},
+		{"expired", s.newSession(42, time.Now().Add(-time.Minute)), 0},
+		{"other key", other.newSession(42, time.Now().Add(time.Hour)), 0},
+		{"tampered user", strings.Replace(payload, "42:", "43:", 1) + ":" + mac, 0},
+		{"tampered expires", payload + "0:" + mac, 0},
+		{"tampered mac", payload + ":" + strings.Repeat("0", len(mac)), 0},
+		{"no mac", payload, 0},
+		{"empty", "", 0},
+		{"signed garbage", "x:" + s.sessionMAC("x"), 0},
+	}
+	for _, test := range tests {
+		userID, ok := s.parseSession(test.value)
+		if userID != test.userID || ok != (test.userID != 0) {
+			t.Errorf("%s: parseSession returns %d, %t", test.name, userID, ok)
+		}
+	}
+}
+
+func TestSafeRedirect(t *testing.T) {
+	tests := map[string]string{
+		"":                      "/",
+		"/":                     "/",
+		"/chat/-5/":             "/chat/-5/",
+		"//evil.example.com":    "/",
+		"/\\evil.example.com":   "/",
+		"https://evil.example":  "/",
+		"javascript:alert(1)":   "/",
+		"chat/-5/":              "/",
+		"/chat/-5/2017?x=//foo": "/chat/-5/2017?x=//foo",
+	}
+	for next, expected := range tests {
+		if redirect := safeRedirect(next); redirect != expected {
+			t.Errorf("safeRedirect(%q) = %q, expected %q", next, redirect, expected)
+		}
+	}
+}
+
+func TestTelegramAuth(t *testing.T) {
+	s := &Server{APIKey: "123:ABC"}
+	r := s.router()
+	login := func(query url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/telegram?"+query.Encode(), nil))
+		return w
+	}
+
+	// next is not signed by Telegram, it is added by login page
+	query := loginData(s.APIKey, 42, time.Now())
+	query.Set("next", "/chat/-5/")
+	w := login(query)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/chat/-5/" {
+		t.Errorf("Login: status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Bad session cookies %v", cookies)
+	}
+	// gin escapes cookie value
+	value, _ := url.QueryUnescape(cookies[0].Value)
+	if userID, ok := s.parseSession(value); !ok || userID != 42 {
+		t.Errorf("Session of user 42 is %d, %t", userID, ok)
+	}
+
+	query.Set("next", "//evil.example.com")
+	if w = login(query); w.Header().Get("Location") != "/" {
+		t.Errorf("Redirect to other host %q", w.Header().Get("Location"))
+	}
+
+	query.Set("id", "43")
+	if w = login(query); w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Tampered login: status %d, cookies %v", w.Code, w.Result().Cookies())
+	}
+}
+
+func TestChatAccess(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+	s.APIKey = "123:ABC"
+	s.DB = db.NewMemoryStore()
+	s.PublicChats = []int64{-1}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	r := s.router()
+	get := func(path, cookie string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: cookie})
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	session := s.newSession(42, time.Now().Add(time.Hour))
+	expired := s.newSession(42, time.Now().Add(-time.Minute))
+	forged := (&Server{APIKey: "456:DEF"}).newSession(42, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		path     string
+		cookie   string
+		status   string
+		code     int
+		location string
+	}{
+		{"public chat", "/chat/-1/", "", "left", http.StatusOK, ""},
+		{"anonymous", "/chat/-5/2017", "", "member", http.StatusFound, "/login?next=%2Fchat%2F-5%2F2017"},
+		{"expired cookie", "/chat/-5/", expired, "member", http.StatusFound, "/login?next=%2Fchat%2F-5%2F"},
+		{"forged cookie", "/chat/-5/", forged, "member", http.StatusFound, "/login?next=%2Fchat%2F-5%2F"},
+		{"private chat with bot", "/chat/42/", session, "left", http.StatusOK, ""},
+		{"member", "/chat/-5/", session, "member", http.StatusOK, ""},
+		{"restricted member", "/chat/-6/", session, "restricted", http.StatusOK, ""},
+		{"left", "/chat/-7/", session, "left", http.StatusForbidden, ""},
+		{"kicked", "/chat/-8/", session, "kicked", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		api.Lock()
+		api.status = test.status
+		api.Unlock()
+		w := get(test.path, test.cookie)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: status %d, location %q", test.name, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// membership is cached, user who left chat keeps access until cache expires
+	calls := len(api.calls("getChatMember"))
+	api.Lock()
+	api.status = "left"
+	api.Unlock()
+	if w := get("/chat/-5/", session); w.Code != http.StatusOK || len(api.calls("getChatMember")) != calls {
+		t.Errorf("Membership is not cached: status %d, %d calls", w.Code, len(api.calls("getChatMember")))
+	}
+
+	// errors of Telegram deny access
+	api.Lock()
+	api.fail = true
+	api.Unlock()
+	if w := get("/chat/-9/", session); w.Code != http.StatusForbidden {
+		t.Errorf("Error of Telegram: status %d", w.Code)
+	}
+}
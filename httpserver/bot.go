@@ -1,12 +1,11 @@
 package httpserver
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -24,7 +23,7 @@ type FilesCache map[string]string
 
 // UpdatePhotoCache function update photos cache of users
 func (s *Server) UpdatePhotoCache() {
-	users, err := db.GetUsers()
+	users, err := s.DB.GetUsers()
 	if err != nil {
 		log.Printf("Error in UpdatePhotoCache: %s", err)
 		return
@@ -49,34 +48,17 @@ func (s *Server) GetPhotoFileName(userID int64) (result string) {
 
 // GetFileNameByFileID returns file name by index
 func (s *Server) GetFileNameByFileID(chatID int64, fileID string) (filename string) {
-	f, err := db.GetFile(fileID, chatID)
-	if err != nil {
-		// try to download it
-		s.GetFile(fileID, chatID)
-		f, err = db.GetFile(fileID, chatID)
-		if err != nil {
-			log.Printf("Error in GetFileNameByFileID with FileID [%s]: %s", fileID, err)
-			return "missing-data"
-		}
-	}
-	filename = filepath.Join(s.StaticDirPath, f.FilePath)
-
-	return
+	return s.GetFileNameByFileIDURL(chatID, fileID)
 }
 
 // GetFileNameByFileIDURL returns file name by index
 func (s *Server) GetFileNameByFileIDURL(chatID int64, fileID string) (filename string) {
-	f, err := db.GetFile(fileID, chatID)
-	if err != nil {
-		// try to download it
-		s.GetFile(fileID, chatID)
-		f, err = db.GetFile(fileID, chatID)
-		if err != nil {
-			log.Printf("Error in GetFileNameByFileID with FileID [%s]: %s", fileID, err)
-			return "missing-data"
-		}
+	if _, err := s.DB.GetFile(fileID, chatID); err != nil {
+		// download it for next time
+		s.QueueFile(fileID, chatID)
+		return "missing-data"
 	}
-	filename = filepath.Join("static/", f.FilePath)
+	filename = fileURL(chatID, fileID)
 
 	return
 }
@@ -103,9 +85,9 @@ func (s *Server) GetPhoto(chatID int64) {
 		return
 	}
 	filename := fmt.Sprintf("%d.jpg", chatID)
-	err = downloadImage(link, getFileName(s.StaticDirPath, filename))
+	err = fetchFile(s.downloadClient(), link, getFileName(s.StaticDirPath, filename))
 	if err != nil {
-		log.Printf("Error in downloadImage: %s", err)
+		log.Printf("Error in download photo for ID %d: %s", chatID, err)
 		return
 	}
 	s.PhotoCache[chatID] = filename
@@ -113,38 +95,42 @@ func (s *Server) GetPhoto(chatID int64) {
 	return
 }
 
-// GetFile function for get file from telegram
-func (s *Server) GetFile(fileID string, chatID int64) {
-	fc := tgbotapi.FileConfig{}
-	fc.FileID = fileID
-	f, err := s.Bot.GetFile(fc)
-	if err != nil {
-		log.Printf("Error in GetFile for FileID [%s]: %s", fileID, err)
-		return
+// GetMessageFiles function queues downloads of all files attached to message
+func (s *Server) GetMessageFiles(msg *tgbotapi.Message) {
+	for _, fileID := range MessageFileIDs(msg) {
+		s.QueueFile(fileID, msg.Chat.ID)
 	}
+}
 
-	log.Printf(f.FilePath)
-
-	// check directory
-	dir := filepath.Dir(f.FilePath)
-	path := filepath.Join(s.StaticDirPath, dir)
-	err = os.MkdirAll(path, 0755)
-	if err != nil {
-		log.Printf("Error in MkdirAll for FileID [%s]: %s", fileID, err)
-		return
+// MessageFileIDs function returns IDs of all files attached to message and previews of videos and documents
+func MessageFileIDs(msg *tgbotapi.Message) (fileIDs []string) {
+	if msg.Audio != nil {
+		fileIDs = append(fileIDs, msg.Audio.FileID)
 	}
-
-	filename := filepath.Join(s.StaticDirPath, f.FilePath)
-	err = downloadImage(f.Link(s.APIKey), filename)
-	if err != nil {
-		log.Printf("Error in MkdirAll for FileID [%s]: %s", fileID, err)
-		return
+	if msg.Document != nil {
+		fileIDs = append(fileIDs, msg.Document.FileID)
+		if msg.Document.Thumbnail != nil {
+			fileIDs = append(fileIDs, msg.Document.Thumbnail.FileID)
+		}
 	}
-	//s.FileCache[f.FileID] = filepath.Join("static", f.FilePath)
-	err = db.SaveFile(&f, chatID)
-	if err != nil {
-		log.Printf("Error in SaveFile for FileID [%s]: %s", fileID, err)
+	if msg.Photo != nil {
+		for _, f := range *msg.Photo {
+			fileIDs = append(fileIDs, f.FileID)
+		}
+	}
+	if msg.Sticker != nil {
+		fileIDs = append(fileIDs, msg.Sticker.FileID)
+	}
+	if msg.Video != nil {
+		fileIDs = append(fileIDs, msg.Video.FileID)
+		if msg.Video.Thumbnail != nil {
+			fileIDs = append(fileIDs, msg.Video.Thumbnail.FileID)
+		}
+	}
+	if msg.Voice != nil {
+		fileIDs = append(fileIDs, msg.Voice.FileID)
 	}
+	return
 }
 
 // SendMessage function send message to given user
@@ -180,38 +166,19 @@ func (s *Server) SendMessage(msgText string, chatID int64, replyID int) {
 	}
 }
 
-// CommandHandler function for handle commands for bot
-func (s *Server) CommandHandler(msg *tgbotapi.Message) {
-	if msg == nil {
+// CallbackHandler function for handle inline keyboard buttons
+func (s *Server) CallbackHandler(query *tgbotapi.CallbackQuery) {
+	if query == nil || query.Message == nil {
 		return
 	}
-	switch msg.Command() {
-	case "start":
-		s.SendMessage("Привет", msg.Chat.ID, msg.MessageID)
-	case "help":
-		s.SendHelp(msg)
-	case "ping":
-		s.SendPing(msg)
-	case "ban":
-		s.BanUnbanUser(msg, true)
-	case "unban":
-		s.BanUnbanUser(msg, false)
-	case "banlist":
-		s.BanList(msg)
-	case "clearcens":
-		s.ClearCens(msg)
-	case "mycens":
-		s.GetCensLevel(msg)
-	case "warn":
-		s.WarnAdd(msg)
-	case "clearwarn":
-		s.WarnClear(msg)
-	case "mywarn":
-		s.GetWarnLevel(msg)
+	switch strings.SplitN(query.Data, ":", 2)[0] {
+	case searchCallbackPrefix:
+		s.SearchCallback(query)
+	case targetCallbackPrefix:
+		s.TargetCallback(query)
 	default:
-		log.Printf("Unknown command: %s", msg.Command())
-		// 	if msg.
-		// 	s.SendMessage("Неизвестная команда", msg.Chat.ID, msg.MessageID)
+		log.Printf("Unknown callback data: %s", query.Data)
+		s.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
 	}
 }
 
@@ -220,48 +187,34 @@ func (s *Server) SendError(msgText string, msg *tgbotapi.Message) {
 	s.SendMessage(msgText, msg.Chat.ID, msg.MessageID)
 }
 
-// UserIsAdmin returns user is admin or not
-func (s *Server) UserIsAdmin(userID int, chat *tgbotapi.Chat) (ok bool, err error) {
-	if chat == nil {
-		return false, fmt.Errorf("Chat pointer is nil")
-	}
-	cc := tgbotapi.ChatConfig{}
-	if chat.IsSuperGroup() || chat.IsGroup() {
-		if chat.ChatConfig().SuperGroupUsername == "" {
-			return false, fmt.Errorf("Chat with all admins!")
-		}
-		cc.SuperGroupUsername = chat.ChatConfig().SuperGroupUsername
-	} else {
-		cc.ChatID = chat.ChatConfig().ChatID
-	}
-	var admins []tgbotapi.ChatMember
-	if admins, err = s.Bot.GetChatAdministrators(cc); err != nil {
-		log.Printf("Error in GetChatAdministrators: %s", err)
+// errPrivateChat returns by member operations for private chat, it has no members
+var errPrivateChat = errors.New("Member operations are not available in private chat")
+
+// chatConfig returns config for member operations, chat is addressed by numeric ID,
+// because private groups have no username. Username is used only for chat without ID.
+func chatConfig(chat *tgbotapi.Chat) (config tgbotapi.ChatConfig, err error) {
+	if chat.IsPrivate() {
+		err = errPrivateChat
 		return
 	}
-
-	ok = false
-	for _, admin := range admins {
-		if admin.User.ID == userID {
-			ok = true
-			break
-		}
+	config.ChatID = chat.ID
+	if chat.ID == 0 && chat.UserName != "" {
+		config.SuperGroupUsername = "@" + chat.UserName
 	}
 	return
 }
 
 // UserIsBanned returns ban status user true or false
 func (s *Server) UserIsBanned(userID int, chat *tgbotapi.Chat) (banned bool, err error) {
-	cc := tgbotapi.ChatConfigWithUser{}
-	if chat.IsSuperGroup() || chat.IsGroup() {
-		if chat.ChatConfig().SuperGroupUsername == "" {
-			return false, fmt.Errorf("Chat with all admins!")
-		}
-		cc.SuperGroupUsername = chat.ChatConfig().SuperGroupUsername
-	} else {
-		cc.ChatID = chat.ID
+	config, err := chatConfig(chat)
+	if err != nil {
+		return
+	}
+	cc := tgbotapi.ChatConfigWithUser{
+		ChatID:             config.ChatID,
+		SuperGroupUsername: config.SuperGroupUsername,
+		UserID:             userID,
 	}
-	cc.UserID = userID
 
 	member, err := s.Bot.GetChatMember(cc)
 	if err != nil {
@@ -274,7 +227,7 @@ func (s *Server) UserIsBanned(userID int, chat *tgbotapi.Chat) (banned bool, err
 
 // BanList method returns ban list
 func (s *Server) BanList(msg *tgbotapi.Message) {
-	users, err := db.GetUsers()
+	users, err := s.DB.GetUsers()
 	if err != nil {
 		log.Printf("Error in GetUsers in BanList: %s", err)
 		return
@@ -302,41 +255,12 @@ func (s *Server) BanList(msg *tgbotapi.Message) {
 
 // BanUnbanUser method ban selected user
 func (s *Server) BanUnbanUser(msg *tgbotapi.Message, ban bool) {
-	isAdmin, err := s.UserIsAdmin(msg.From.ID, msg.Chat)
-	if err != nil {
-		return
-	}
-	if !isAdmin {
-		s.SendError("Не удалось установить Вашу причастность к администраторам группы!", msg)
+	user := s.resolveTarget(msg, msg.CommandArguments())
+	if user == nil {
 		return
 	}
-
-	user, err := db.GetUser(msg.CommandArguments())
-	if err != nil {
-		errStrings := strings.Split(err.Error(), "\n")
-		if len(errStrings) > 1 {
-			switch errStrings[0] {
-			case "User not found":
-				s.SendError(fmt.Sprintf("Пользователь %s не найден", msg.CommandArguments()), msg)
-				return
-			case "Many users":
-				s.SendError(fmt.Sprintf("Найдено более одного пользователя, уточните:\n%s", strings.Join(errStrings[1:], "\n")), msg)
-				return
-			default:
-				s.SendError(fmt.Sprintf("Произошла неизвестная ошибка при поиске пользователя: %s", err.Error()), msg)
-				return
-			}
-		}
-	}
-
-	if user != nil {
-		userIsAdmin, _ := s.UserIsAdmin(user.ID, msg.Chat)
-		if userIsAdmin {
-			s.SendError(fmt.Sprintf("Пользователь [%s] является администратором группы. Администраторов банить нельзя! Они хорошие!", user.String()), msg)
-			return
-		}
-	} else {
-		s.SendError(fmt.Sprintf("Пользователь [%s] не найден", msg.CommandArguments()), msg)
+	if s.UserRole(user.ID, msg.Chat) >= RoleModerator {
+		s.SendError(fmt.Sprintf("Пользователь [%s] является модератором группы. Модераторов банить нельзя! Они хорошие!", user.String()), msg)
 		return
 	}
 
@@ -347,6 +271,10 @@ func (s *Server) BanUnbanUser(msg *tgbotapi.Message, ban bool) {
 		return
 	}
 	if ok {
+		// permanent ban and unban replace temporary ban
+		if err = s.DB.DeleteSanction(msg.Chat.ID, user.ID, db.SanctionBan); err != nil && err != db.ErrNotFound {
+			log.Printf("Error in DeleteSanction: %s", err)
+		}
 		s.SendMessage("Успешно выполнено.", msg.Chat.ID, msg.MessageID)
 	}
 }
@@ -365,20 +293,6 @@ func (s *Server) SendPing(msg *tgbotapi.Message) {
 	s.SendMessage(pingMsg, msg.Chat.ID, msg.MessageID)
 }
 
-// SendHelp sends help message to chat
-func (s *Server) SendHelp(msg *tgbotapi.Message) {
-	helpMsg :=
-		`Помощь по командам бота.
-/start - приветствие (стандартная для любого бота Telegram)
-/ban @username - забанить пользователя в группе (бот должен иметь административные права в группе)
-/unban @username - разбанить пользователя в группе (бот должен иметь административные права в группе)
-/banlist - показать список забаненых пользователей
-/clearcens - очистить счетчик бранных слов
-/mycens - показать собственный счетчик бранных слов
-/ping - шуточный пинг`
-	s.SendMessage(helpMsg, msg.Chat.ID, msg.MessageID)
-}
-
 // FillCens load censore database
 func (s *Server) FillCens() {
 	f, err := os.Open(filepath.Join(s.StaticDirPath, "mat.txt"))
@@ -428,39 +342,12 @@ func (s *Server) Cens(msg *tgbotapi.Message) {
 
 // ClearCens command for clean censore level
 func (s *Server) ClearCens(msg *tgbotapi.Message) {
-	isAdmin, err := s.UserIsAdmin(msg.From.ID, msg.Chat)
-	if err != nil {
-		return
-	}
-	if !isAdmin {
-		s.SendError("Не удалось установить Вашу причастность к администраторам группы!", msg)
-		return
-	}
-
-	user, err := db.GetUser(msg.CommandArguments())
-	if err != nil {
-		errStrings := strings.Split(err.Error(), "\n")
-		if len(errStrings) > 1 {
-			switch errStrings[0] {
-			case "User not found":
-				s.SendError(fmt.Sprintf("Пользователь %s не найден", msg.CommandArguments()), msg)
-				return
-			case "Many users":
-				s.SendError(fmt.Sprintf("Найдено более одного пользователя, уточните:\n%s", strings.Join(errStrings[1:], "\n")), msg)
-				return
-			default:
-				s.SendError(fmt.Sprintf("Произошла неизвестная ошибка при поиске пользователя: %s", err.Error()), msg)
-				return
-			}
-		}
-	}
-
+	user := s.resolveTarget(msg, msg.CommandArguments())
 	if user == nil {
-		s.SendError(fmt.Sprintf("Пользователь %s не найден.", msg.CommandArguments()), msg)
 		return
 	}
 
-	err = db.ClearCensLevel(user)
+	err := s.DB.ClearCensLevel(user)
 	if err != nil {
 		log.Printf("Error in ClearCens -> ClearCensLevel: %s", err)
 		return
@@ -470,9 +357,9 @@ func (s *Server) ClearCens(msg *tgbotapi.Message) {
 
 // GetCensLevel send message with current censore level for user
 func (s *Server) GetCensLevel(msg *tgbotapi.Message) {
-	currentLevel, err := db.GetCensLevel(msg.From)
+	currentLevel, err := s.DB.GetCensLevel(msg.From)
 	if err != nil {
-		if err.Error() == "Key not found." {
+		if err == db.ErrNotFound {
 			s.SendError("Ты чист душой!", msg)
 			return
 		}
@@ -485,14 +372,13 @@ func (s *Server) GetCensLevel(msg *tgbotapi.Message) {
 func (s *Server) censWord(msg *tgbotapi.Message, mWord string) {
 	log.Printf("[%s] cens word [%s] in text [%s]", msg.From.String(), mWord, msg.Text)
 	s.SendError(fmt.Sprintf("Перестаньте сказать, %s! Вы не на привозе!", msg.From.String()), msg)
-	cur, err := db.AddCensLevel(msg.From)
+	cur, err := s.DB.AddCensLevel(msg.From)
 	if err != nil {
 		log.Printf("Error in AddCensLevel: %s", err)
 		return
 	}
 	if cur > 5 {
-		userIsAdmin, _ := s.UserIsAdmin(msg.From.ID, msg.Chat)
-		if userIsAdmin {
+		if s.UserRole(msg.From.ID, msg.Chat) >= RoleTrusted {
 			return
 		}
 
@@ -513,39 +399,18 @@ func getFileName(staticDir, fn string) string {
 	return filepath.Join(staticDir, fn)
 }
 
-func downloadImage(url string, filename string) (err error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	file, err := os.Create(filename)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-	_, err = io.Copy(file, resp.Body)
+func (s *Server) kickUser(userID int, chat *tgbotapi.Chat, ban bool) (ok bool, err error) {
+	ok = false
+	cc, err := chatConfig(chat)
 	if err != nil {
 		return
 	}
-	return
-}
-
-func (s *Server) kickUser(userID int, chat *tgbotapi.Chat, ban bool) (ok bool, err error) {
-	ok = false
-	config := tgbotapi.ChatMemberConfig{}
-	config.UserID = userID
-	if chat.IsSuperGroup() || chat.IsGroup() {
-		if chat.ChatConfig().SuperGroupUsername == "" {
-			return false, fmt.Errorf("Chat with all admins!")
-		}
-		config.SuperGroupUsername = chat.ChatConfig().SuperGroupUsername
-		config.SuperGroupUsername = chat.ChatConfig().SuperGroupUsername
-		log.Printf("Kick from %s", config.SuperGroupUsername)
-	} else {
-		config.ChatID = chat.ChatConfig().ChatID
+	config := tgbotapi.ChatMemberConfig{
+		ChatID:             cc.ChatID,
+		SuperGroupUsername: cc.SuperGroupUsername,
+		UserID:             userID,
 	}
+	log.Printf("Kick user %d from chat %d", userID, chat.ID)
 
 	var resp tgbotapi.APIResponse
 	if ban {
@@ -565,36 +430,20 @@ func (s *Server) kickUser(userID int, chat *tgbotapi.Chat, ban bool) (ok bool, e
 }
 
 func (s *Server) WarnAdd(msg *tgbotapi.Message) {
-	var (
-		user *tgbotapi.User
-		err  error
-	)
-	if user, err = db.GetUser(msg.CommandArguments()); err != nil {
-		errStrings := strings.Split(err.Error(), "\n")
-		if len(errStrings) > 1 {
-			switch errStrings[0] {
-			case "User not found":
-				s.SendError(fmt.Sprintf("Пользователь %s не найден", msg.CommandArguments()), msg)
-				return
-			case "Many users":
-				s.SendError(fmt.Sprintf("Найдено более одного пользователя, уточните:\n%s", strings.Join(errStrings[1:], "\n")), msg)
-				return
-			default:
-				s.SendError(fmt.Sprintf("Произошла неизвестная ошибка при поиске пользователя: %s", err.Error()), msg)
-				return
-			}
-		}
-	}
+	user := s.resolveTarget(msg, msg.CommandArguments())
 	if user == nil {
-		s.SendError(fmt.Sprintf("Пользователь [%s] не найден", msg.CommandArguments()), msg)
 		return
 	}
 	if user.ID == msg.From.ID {
 		s.SendError("Сам себя? O_o", msg)
 		return
 	}
+	if s.UserRole(user.ID, msg.Chat) >= RoleModerator {
+		s.SendError(fmt.Sprintf("Пользователь [%s] является модератором группы", user.String()), msg)
+		return
+	}
 
-	currentLevel, err := db.AddWarnLevel(user)
+	currentLevel, err := s.DB.AddWarnLevel(user)
 	if err != nil {
 		log.Printf("Error in AddWarnLevel: %s", err)
 		return
@@ -613,39 +462,12 @@ func (s *Server) WarnAdd(msg *tgbotapi.Message) {
 }
 
 func (s *Server) WarnClear(msg *tgbotapi.Message) {
-	isAdmin, err := s.UserIsAdmin(msg.From.ID, msg.Chat)
-	if err != nil {
-		return
-	}
-	if !isAdmin {
-		s.SendError("Не удалось установить Вашу причастность к администраторам группы!", msg)
-		return
-	}
-
-	user, err := db.GetUser(msg.CommandArguments())
-	if err != nil {
-		errStrings := strings.Split(err.Error(), "\n")
-		if len(errStrings) > 1 {
-			switch errStrings[0] {
-			case "User not found":
-				s.SendError(fmt.Sprintf("Пользователь %s не найден", msg.CommandArguments()), msg)
-				return
-			case "Many users":
-				s.SendError(fmt.Sprintf("Найдено более одного пользователя, уточните:\n%s", strings.Join(errStrings[1:], "\n")), msg)
-				return
-			default:
-				s.SendError(fmt.Sprintf("Произошла неизвестная ошибка при поиске пользователя: %s", err.Error()), msg)
-				return
-			}
-		}
-	}
-
+	user := s.resolveTarget(msg, msg.CommandArguments())
 	if user == nil {
-		s.SendError(fmt.Sprintf("Пользователь %s не найден.", msg.CommandArguments()), msg)
 		return
 	}
 
-	err = db.ClearWarnLevel(user)
+	err := s.DB.ClearWarnLevel(user)
 	if err != nil {
 		log.Printf("Error in WarnClear -> ClearWarnLevel: %s", err)
 		return
@@ -655,9 +477,9 @@ func (s *Server) WarnClear(msg *tgbotapi.Message) {
 
 // GetWarnLevel send message with current warning level for user
 func (s *Server) GetWarnLevel(msg *tgbotapi.Message) {
-	currentLevel, err := db.GetWarnLevel(msg.From)
+	currentLevel, err := s.DB.GetWarnLevel(msg.From)
 	if err != nil {
-		if err.Error() == "Key not found." {
+		if err == db.ErrNotFound {
 			s.SendError("Чист душой!", msg)
 			return
 		}
@@ -0,0 +1,248 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// memberChats are chats where member operations are available
+var memberChats = []*tgbotapi.Chat{
+	{ID: -5, Type: "group", Title: "Group"},
+	{ID: -1001234567890, Type: "supergroup", Title: "Private supergroup"},
+	{ID: -1001234567891, Type: "supergroup", Title: "Public supergroup", UserName: "public"},
+}
+
+// privateChat is a private chat with user, it has no members
+var privateChat = &tgbotapi.Chat{ID: 42, Type: "private", UserName: "user"}
+
+// fakeBotAPI is a fake Telegram Bot API server, it records forms of requests by method
+type fakeBotAPI struct {
+	*httptest.Server
+	sync.Mutex
+	requests map[string][]url.Values
+	// status is a status of user in getChatMember result
+	status string
+	// admins is a JSON list of chat members in getChatAdministrators result
+	admins string
+	// fail makes all requests fail with Telegram error
+	fail bool
+	// sent is a count of sent messages, it is a message ID of last one
+	sent int
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	f := &fakeBotAPI{requests: make(map[string][]url.Values), status: "member", admins: "[]"}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/bot123:ABC/") {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		r.ParseForm()
+		f.Lock()
+		f.requests[method] = append(f.requests[method], r.PostForm)
+		status, admins, fail := f.status, f.admins, f.fail
+		if method == "sendMessage" {
+			f.sent++
+		}
+		sent := f.sent
+		f.Unlock()
+
+		if fail {
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		switch method {
+		case "getChatMember":
+			w.Write([]byte(`{"ok":true,"result":{"user":{"id":` + r.PostForm.Get("user_id") + `},"status":"` + status + `"}}`))
+		case "getChatAdministrators":
+			w.Write([]byte(`{"ok":true,"result":` + admins + `}`))
+		case "sendMessage", "editMessageText":
+			w.Write([]byte(`{"ok":true,"result":{"message_id":` + strconv.Itoa(sent) + `,"date":1,"chat":{"id":` + r.PostForm.Get("chat_id") + `}}}`))
+		default:
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	return f
+}
+
+// server returns Server with bot which sends requests to fake Bot API
+func (f *fakeBotAPI) server() *Server {
+	base, _ := url.Parse(f.URL)
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = base.Scheme
+		r.URL.Host = base.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	return &Server{Bot: &tgbotapi.BotAPI{Token: "123:ABC", Client: client}}
+}
+
+// calls returns forms of requests of method
+func (f *fakeBotAPI) calls(method string) []url.Values {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests[method]
+}
+
+// texts returns texts of requests of method
+func (f *fakeBotAPI) texts(method string) (texts []string) {
+	for _, form := range f.calls(method) {
+		texts = append(texts, form.Get("text"))
+	}
+	return
+}
+
+// lastText returns text of last request of method
+func (f *fakeBotAPI) lastText(method string) string {
+	texts := f.texts(method)
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[len(texts)-1]
+}
+
+// total returns count of all requests
+func (f *fakeBotAPI) total() (count int) {
+	f.Lock()
+	defer f.Unlock()
+	for _, forms := range f.requests {
+		count += len(forms)
+	}
+	return
+}
+
+// roundTripFunc is a function which implements http.RoundTripper
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestChatConfig(t *testing.T) {
+	for _, chat := range memberChats {
+		config, err := chatConfig(chat)
+		if err != nil {
+			t.Errorf("%s: chatConfig returns error: %s", chat.Title, err)
+			continue
+		}
+		if config.ChatID != chat.ID || config.SuperGroupUsername != "" {
+			t.Errorf("%s: chat is not addressed by ID: %+v", chat.Title, config)
+		}
+	}
+
+	// username is used only for chat without ID
+	config, err := chatConfig(&tgbotapi.Chat{Type: "supergroup", UserName: "public"})
+	if err != nil || config.ChatID != 0 || config.SuperGroupUsername != "@public" {
+		t.Errorf("Chat without ID is not addressed by username: %+v, %v", config, err)
+	}
+
+	if _, err = chatConfig(privateChat); err != errPrivateChat {
+		t.Errorf("chatConfig of private chat returns %v, expected errPrivateChat", err)
+	}
+}
+
+func TestUserIsBanned(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+
+	for _, status := range []string{"member", "kicked"} {
+		api.Lock()
+		api.status = status
+		api.Unlock()
+		for _, chat := range memberChats {
+			before := len(api.calls("getChatMember"))
+			banned, err := s.UserIsBanned(7, chat)
+			if err != nil {
+				t.Errorf("%s: UserIsBanned returns error: %s", chat.Title, err)
+				continue
+			}
+			if banned != (status == "kicked") {
+				t.Errorf("%s: user with status %s is banned=%v", chat.Title, status, banned)
+			}
+			calls := api.calls("getChatMember")
+			if len(calls) != before+1 {
+				t.Fatalf("%s: getChatMember is called %d times", chat.Title, len(calls)-before)
+			}
+			form := calls[len(calls)-1]
+			if chatID := form.Get("chat_id"); chatID != strconv.FormatInt(chat.ID, 10) {
+				t.Errorf("%s: chat_id %q, expected numeric ID %d", chat.Title, chatID, chat.ID)
+			}
+			if userID := form.Get("user_id"); userID != "7" {
+				t.Errorf("%s: user_id %q, expected 7", chat.Title, userID)
+			}
+		}
+	}
+
+	before := api.total()
+	if _, err := s.UserIsBanned(7, privateChat); err != errPrivateChat {
+		t.Errorf("UserIsBanned in private chat returns %v, expected errPrivateChat", err)
+	}
+	if api.total() != before {
+		t.Errorf("Bot API is requested for private chat")
+	}
+
+	api.Lock()
+	api.fail = true
+	api.Unlock()
+	if _, err := s.UserIsBanned(7, memberChats[0]); err == nil {
+		t.Errorf("Error of Bot API is ignored")
+	}
+}
+
+func TestKickUser(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+
+	for _, ban := range []bool{true, false} {
+		method := "kickChatMember"
+		if !ban {
+			method = "unbanChatMember"
+		}
+		for _, chat := range memberChats {
+			before := len(api.calls(method))
+			ok, err := s.kickUser(7, chat, ban)
+			if err != nil || !ok {
+				t.Errorf("%s: kickUser(ban=%v) returns %v, %v", chat.Title, ban, ok, err)
+				continue
+			}
+			calls := api.calls(method)
+			if len(calls) != before+1 {
+				t.Fatalf("%s: %s is called %d times", chat.Title, method, len(calls)-before)
+			}
+			form := calls[len(calls)-1]
+			if chatID := form.Get("chat_id"); chatID != strconv.FormatInt(chat.ID, 10) {
+				t.Errorf("%s: %s chat_id %q, expected numeric ID %d", chat.Title, method, chatID, chat.ID)
+			}
+			if userID := form.Get("user_id"); userID != "7" {
+				t.Errorf("%s: %s user_id %q, expected 7", chat.Title, method, userID)
+			}
+		}
+	}
+
+	before := api.total()
+	for _, ban := range []bool{true, false} {
+		if ok, err := s.kickUser(7, privateChat, ban); ok || err != errPrivateChat {
+			t.Errorf("kickUser(ban=%v) in private chat returns %v, %v, expected errPrivateChat", ban, ok, err)
+		}
+	}
+	if api.total() != before {
+		t.Errorf("Bot API is requested for private chat")
+	}
+
+	api.Lock()
+	api.fail = true
+	api.Unlock()
+	if ok, err := s.kickUser(7, memberChats[1], true); ok || err == nil {
+		t.Errorf("Error of Bot API is ignored: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,342 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// CommandRole is a role of user in chat, roles are ordered from member to owner
+type CommandRole int
+
+const (
+	// RoleMember is any member of chat
+	RoleMember CommandRole = iota
+	// RoleTrusted is a member who may warn others and is not punished automatically
+	RoleTrusted
+	// RoleModerator is a moderator of chat, administrators of group are moderators
+	RoleModerator
+	// RoleOwner is an owner of chat, creator of group is an owner
+	RoleOwner
+)
+
+// groupChats is a list of group chat types
+var groupChats = []string{"group", "supergroup"}
+
+// Command is a bot command description
+type Command struct {
+	Name    string
+	Aliases []string
+	// Args is an arguments syntax for help, e.g. @username
+	Args        string
+	Description string
+	Role        CommandRole
+	// ChatTypes is a list of chat types where command is allowed, empty list allows all chats
+	ChatTypes []string
+	Handler   func(s *Server, msg *tgbotapi.Message)
+}
+
+// AllowedIn method returns true if command is allowed in chat type
+func (cmd Command) AllowedIn(chatType string) bool {
+	if len(cmd.ChatTypes) == 0 {
+		return true
+	}
+	for _, t := range cmd.ChatTypes {
+		if t == chatType {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage method returns command with arguments syntax, e.g. /ban @username
+func (cmd Command) Usage() string {
+	if cmd.Args == "" {
+		return "/" + cmd.Name
+	}
+	return "/" + cmd.Name + " " + cmd.Args
+}
+
+// Commands is a registry of bot commands, /help and bot menu are generated from it
+var Commands []Command
+
+func init() {
+	Commands = []Command{
+		{
+			Name:        "start",
+			Description: "приветствие",
+			Handler: func(s *Server, msg *tgbotapi.Message) {
+				s.SendMessage("Привет", msg.Chat.ID, msg.MessageID)
+			},
+		},
+		{Name: "help", Description: "помощь по командам бота", Handler: (*Server).SendHelp},
+		{
+			Name:        "ban",
+			Args:        "@username",
+			Description: "забанить пользователя в группе",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     func(s *Server, msg *tgbotapi.Message) { s.BanUnbanUser(msg, true) },
+		},
+		{
+			Name:        "unban",
+			Args:        "@username",
+			Description: "разбанить пользователя в группе",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     func(s *Server, msg *tgbotapi.Message) { s.BanUnbanUser(msg, false) },
+		},
+		{Name: "banlist", Description: "показать список забаненых пользователей", ChatTypes: groupChats, Handler: (*Server).BanList},
+		{
+			Name:        "tempban",
+			Args:        "@username 3d",
+			Description: "забанить пользователя на время",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).TempBanUser,
+		},
+		{
+			Name:        "mute",
+			Args:        "@username [2h]",
+			Description: "запретить пользователю писать в чат, без срока навсегда",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).MuteUser,
+		},
+		{
+			Name:        "restrict",
+			Args:        "@username media|stickers [1d]",
+			Description: "запретить пользователю медиа или стикеры",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).RestrictUser,
+		},
+		{
+			Name:        "unmute",
+			Args:        "@username",
+			Description: "снять с пользователя mute и ограничения",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).UnmuteUser,
+		},
+		{Name: "sanctions", Description: "показать активные ограничения в чате", ChatTypes: groupChats, Handler: (*Server).SanctionList},
+		{
+			Name:        "clearcens",
+			Args:        "@username",
+			Description: "очистить счетчик бранных слов пользователя",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).ClearCens,
+		},
+		{Name: "mycens", Description: "показать собственный счетчик бранных слов", Handler: (*Server).GetCensLevel},
+		{
+			Name:        "warn",
+			Args:        "@username",
+			Description: "предупредить пользователя, после 5 предупреждений он будет забанен",
+			Role:        RoleTrusted,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).WarnAdd,
+		},
+		{
+			Name:        "clearwarn",
+			Args:        "@username",
+			Description: "очистить счетчик предупреждений пользователя",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).WarnClear,
+		},
+		{Name: "mywarn", Description: "показать собственный счетчик предупреждений", Handler: (*Server).GetWarnLevel},
+		{
+			Name:        "search",
+			Aliases:     []string{"find"},
+			Args:        "слова",
+			Description: "найти сообщения в этом чате",
+			Handler:     (*Server).SearchMessages,
+		},
+		{
+			Name:        "weblink",
+			Args:        "[7d]",
+			Description: "создать ссылку на логи чата, можно указать срок действия",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).WebLinkCreate,
+		},
+		{
+			Name:        "weblinks",
+			Description: "показать активные ссылки на логи чата",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).WebLinkList,
+		},
+		{
+			Name:        "revokelink",
+			Args:        "ID",
+			Description: "отозвать ссылку на логи чата",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).WebLinkRevoke,
+		},
+		{
+			Name:        "grant",
+			Args:        "@username роль",
+			Description: "выдать роль пользователю: trusted, moderator или owner",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).GrantRole,
+		},
+		{
+			Name:        "revoke",
+			Args:        "@username",
+			Description: "отозвать выданную роль пользователя",
+			Role:        RoleModerator,
+			ChatTypes:   groupChats,
+			Handler:     (*Server).RevokeRole,
+		},
+		{Name: "roles", Description: "показать роли пользователей в чате", ChatTypes: groupChats, Handler: (*Server).RoleList},
+		{Name: "ping", Description: "шуточный пинг", Handler: (*Server).SendPing},
+	}
+}
+
+// findCommand function returns command by name or alias
+func findCommand(name string) (cmd Command, ok bool) {
+	name = strings.ToLower(name)
+	for _, cmd = range Commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// CommandHandler function for handle commands for bot
+func (s *Server) CommandHandler(msg *tgbotapi.Message) {
+	if msg == nil {
+		return
+	}
+	// command for another bot in group, e.g. /help@otherbot
+	if at := strings.Index(msg.CommandWithAt(), "@"); at != -1 && s.Bot != nil &&
+		!strings.EqualFold(msg.CommandWithAt()[at+1:], s.Bot.Self.UserName) {
+		return
+	}
+
+	// channel posts have no author, roles and targets of commands cannot be checked
+	if msg.From == nil {
+		s.SendError("Команды принимаются только от пользователей", msg)
+		return
+	}
+
+	cmd, ok := findCommand(msg.Command())
+	if !ok {
+		log.Printf("Unknown command: %s", msg.Command())
+		s.SendError(unknownCommandText(msg.Command()), msg)
+		return
+	}
+	if !cmd.AllowedIn(msg.Chat.Type) {
+		s.SendError(fmt.Sprintf("Команда /%s доступна только в группах", cmd.Name), msg)
+		return
+	}
+	if cmd.Role != RoleMember && s.UserRole(msg.From.ID, msg.Chat) < cmd.Role {
+		s.SendError(fmt.Sprintf("Команда /%s доступна с ролью %s и выше", cmd.Name, cmd.Role), msg)
+		return
+	}
+	cmd.Handler(s, msg)
+}
+
+// unknownCommandText function returns reply to unknown command with similar commands
+func unknownCommandText(name string) string {
+	name = strings.ToLower(name)
+	var similar []string
+	for _, cmd := range Commands {
+		if name != "" && (strings.HasPrefix(cmd.Name, name) || strings.HasPrefix(name, cmd.Name)) {
+			similar = append(similar, "/"+cmd.Name)
+		}
+	}
+	text := fmt.Sprintf("Неизвестная команда /%s.", name)
+	if len(similar) != 0 {
+		text += fmt.Sprintf(" Возможно, имелась в виду %s?", strings.Join(similar, " или "))
+	}
+	return text + " Список команд: /help"
+}
+
+// helpText function returns help for commands allowed in chat type
+func helpText(chatType string) string {
+	lines := []string{"Помощь по командам бота."}
+	for _, cmd := range Commands {
+		if !cmd.AllowedIn(chatType) {
+			continue
+		}
+		line := cmd.Usage() + " - " + cmd.Description
+		if len(cmd.Aliases) != 0 {
+			line += fmt.Sprintf(" (также /%s)", strings.Join(cmd.Aliases, ", /"))
+		}
+		if cmd.Role != RoleMember {
+			line += fmt.Sprintf(" (роль %s)", cmd.Role)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SendHelp sends help message to chat
+func (s *Server) SendHelp(msg *tgbotapi.Message) {
+	s.SendMessage(helpText(msg.Chat.Type), msg.Chat.ID, msg.MessageID)
+}
+
+// botCommand is a command of bot menu for setMyCommands method
+type botCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// botCommandScope is a scope of bot menu commands
+type botCommandScope struct {
+	Type string `json:"type"`
+}
+
+// menuCommands function returns bot menu commands allowed in chat type with role
+func menuCommands(chatType string, role CommandRole) (commands []botCommand) {
+	for _, cmd := range Commands {
+		if !cmd.AllowedIn(chatType) || cmd.Role > role {
+			continue
+		}
+		commands = append(commands, botCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	return
+}
+
+// SetBotCommands method sets bot menu commands for private chats, groups and group administrators
+func (s *Server) SetBotCommands() (err error) {
+	scopes := []struct {
+		scope    string
+		commands []botCommand
+	}{
+		{"all_private_chats", menuCommands("private", RoleMember)},
+		{"all_group_chats", menuCommands("supergroup", RoleMember)},
+		{"all_chat_administrators", menuCommands("supergroup", RoleOwner)},
+	}
+	for _, scope := range scopes {
+		params := url.Values{}
+		data, err := json.Marshal(scope.commands)
+		if err != nil {
+			return err
+		}
+		params.Set("commands", string(data))
+		if data, err = json.Marshal(botCommandScope{Type: scope.scope}); err != nil {
+			return err
+		}
+		params.Set("scope", string(data))
+		if _, err = s.Bot.MakeRequest("setMyCommands", params); err != nil {
+			return fmt.Errorf("Cannot set commands for %s: %s", scope.scope, err)
+		}
+	}
+	return
+}
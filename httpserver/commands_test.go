@@ -0,0 +1,193 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestCommandsRegistry(t *testing.T) {
+	// bot menu accepts only such names
+	nameRegexp := regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+	seen := make(map[string]bool)
+	for _, cmd := range Commands {
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			if seen[name] {
+				t.Errorf("Command /%s is declared twice", name)
+			}
+			seen[name] = true
+			if !nameRegexp.MatchString(name) {
+				t.Errorf("Bad command name /%s", name)
+			}
+		}
+		if cmd.Handler == nil || cmd.Description == "" || len(cmd.Description) > 256 {
+			t.Errorf("Command /%s has no handler or bad description", cmd.Name)
+		}
+	}
+
+	group := helpText("supergroup")
+	for _, cmd := range Commands {
+		if !strings.Contains(group, "\n"+cmd.Usage()+" - "+cmd.Description) {
+			t.Errorf("Group help has no /%s: %s", cmd.Name, group)
+		}
+	}
+	private := helpText("private")
+	for _, line := range []string{"\n/help - ", "\n/mycens - "} {
+		if !strings.Contains(private, line) {
+			t.Errorf("Private help has no %q: %s", line, private)
+		}
+	}
+	for _, line := range []string{"\n/ban ", "\n/warn ", "\n/sanctions "} {
+		if strings.Contains(private, line) {
+			t.Errorf("Private help has group command %q: %s", line, private)
+		}
+	}
+	if !strings.Contains(group, "(также /find)") || !strings.Contains(group, "/ban @username - забанить пользователя в группе (роль moderator)") {
+		t.Errorf("Group help has no aliases or roles: %s", group)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := map[string]string{
+		"help":   "help",
+		"HELP":   "help",
+		"find":   "search",
+		"search": "search",
+		"bann":   "",
+		"":       "",
+	}
+	for name, expected := range tests {
+		cmd, ok := findCommand(name)
+		if cmd.Name != expected || ok != (expected != "") {
+			t.Errorf("findCommand(%q) returns /%s, %t", name, cmd.Name, ok)
+		}
+	}
+}
+
+func TestUnknownCommandText(t *testing.T) {
+	tests := map[string]string{
+		"bann":   "Неизвестная команда /bann. Возможно, имелась в виду /ban? Список команд: /help",
+		"warns":  "Неизвестная команда /warns. Возможно, имелась в виду /warn? Список команд: /help",
+		"un":     "Неизвестная команда /un. Возможно, имелась в виду /unban или /unmute? Список команд: /help",
+		"qwerty": "Неизвестная команда /qwerty. Список команд: /help",
+		"":       "Неизвестная команда /. Список команд: /help",
+	}
+	for name, expected := range tests {
+		if text := unknownCommandText(name); text != expected {
+			t.Errorf("unknownCommandText(%q) = %q", name, text)
+		}
+	}
+}
+
+func TestMenuCommands(t *testing.T) {
+	names := func(commands []botCommand) string {
+		var list []string
+		for _, cmd := range commands {
+			list = append(list, cmd.Command)
+		}
+		return " " + strings.Join(list, " ") + " "
+	}
+	tests := []struct {
+		chatType string
+		role     CommandRole
+		has      []string
+		hasNot   []string
+	}{
+		{"private", RoleMember, []string{"help", "mycens"}, []string{"ban", "warn", "banlist"}},
+		{"supergroup", RoleMember, []string{"help", "banlist", "search"}, []string{"ban", "warn", "find"}},
+		{"supergroup", RoleTrusted, []string{"warn"}, []string{"ban"}},
+		{"supergroup", RoleOwner, []string{"ban", "warn", "grant", "help"}, nil},
+	}
+	for _, test := range tests {
+		menu := names(menuCommands(test.chatType, test.role))
+		for _, name := range test.has {
+			if !strings.Contains(menu, " "+name+" ") {
+				t.Errorf("Menu of %s for %s has no %s: %s", test.chatType, test.role, name, menu)
+			}
+		}
+		for _, name := range test.hasNot {
+			if strings.Contains(menu, " "+name+" ") {
+				t.Errorf("Menu of %s for %s has %s: %s", test.chatType, test.role, name, menu)
+			}
+		}
+	}
+}
+
+func TestSetBotCommands(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+	if err := s.SetBotCommands(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := api.calls("setMyCommands")
+	scopes := []string{"all_private_chats", "all_group_chats", "all_chat_administrators"}
+	if len(calls) != len(scopes) {
+		t.Fatalf("%d calls of setMyCommands", len(calls))
+	}
+	for i, call := range calls {
+		var scope botCommandScope
+		var commands []botCommand
+		if err := json.Unmarshal([]byte(call.Get("scope")), &scope); err != nil || scope.Type != scopes[i] {
+			t.Errorf("Bad scope %s, %v", call.Get("scope"), err)
+		}
+		if err := json.Unmarshal([]byte(call.Get("commands")), &commands); err != nil || len(commands) == 0 {
+			t.Errorf("Bad commands %s, %v", call.Get("commands"), err)
+		}
+	}
+
+	api.Lock()
+	api.fail = true
+	api.Unlock()
+	if err := s.SetBotCommands(); err == nil {
+		t.Errorf("Error of Telegram is ignored")
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   func() *tgbotapi.Message
+		reply string
+	}{
+		{"help", func() *tgbotapi.Message { return roleCommand(2, "/help") }, "Помощь по командам бота."},
+		{"command with bot name", func() *tgbotapi.Message { return roleCommand(2, "/help@LogBot") }, "Помощь по командам бота."},
+		{"command for other bot", func() *tgbotapi.Message { return roleCommand(2, "/help@otherbot") }, ""},
+		{"alias", func() *tgbotapi.Message { return roleCommand(2, "/find") }, "Укажите слова для поиска: /search слова"},
+		{"unknown", func() *tgbotapi.Message { return roleCommand(2, "/bann @eve") }, "Неизвестная команда /bann."},
+		{"not allowed role", func() *tgbotapi.Message { return roleCommand(2, "/ban @eve") }, "Команда /ban доступна с ролью moderator и выше"},
+		{"group command in private chat", func() *tgbotapi.Message {
+			msg := roleCommand(2, "/banlist")
+			msg.Chat = privateChat
+			return msg
+		}, "Команда /banlist доступна только в группах"},
+		{"channel post", func() *tgbotapi.Message {
+			msg := roleCommand(2, "/ban @eve")
+			msg.From = nil
+			msg.Chat = &tgbotapi.Chat{ID: -100, Type: "channel"}
+			return msg
+		}, "Команды принимаются только от пользователей"},
+	}
+	for _, test := range tests {
+		api := newFakeBotAPI(t)
+		s := api.server()
+		s.Bot.Self.UserName = "logbot"
+		s.DB = db.NewMemoryStore()
+
+		s.CommandHandler(test.msg())
+		text := api.lastText("sendMessage")
+		if test.reply == "" && api.total() != 0 {
+			t.Errorf("%s: reply %q", test.name, text)
+		}
+		if test.reply != "" && !strings.Contains(text, test.reply) {
+			t.Errorf("%s: reply %q, expected %q", test.name, text, test.reply)
+		}
+		api.Close()
+	}
+}
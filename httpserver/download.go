@@ -0,0 +1,343 @@
+package httpserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/media"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// DownloadSettings are settings of files downloader, zero values are replaced with defaults
+type DownloadSettings struct {
+	// Workers is a number of parallel downloads
+	Workers int
+	// QueueSize is a max number of queued files, files over it go to failed downloads
+	QueueSize int
+	// Retries is a number of attempts before file goes to failed downloads
+	Retries int
+	// RetryDelay is a delay before first retry, it is doubled for every next one
+	RetryDelay time.Duration
+	// Timeout is a timeout of one http request
+	Timeout time.Duration
+	// RetryInterval is an interval of retry failed downloads
+	RetryInterval time.Duration
+	// MaxAttempts is a number of attempts after which failed download is retried only manually
+	MaxAttempts int
+}
+
+// defaultDownloadSettings are used for zero values of DownloadSettings
+var defaultDownloadSettings = DownloadSettings{
+	Workers:       4,
+	QueueSize:     1000,
+	Retries:       5,
+	RetryDelay:    time.Second * 2,
+	Timeout:       time.Minute * 2,
+	RetryInterval: time.Hour,
+	MaxAttempts:   50,
+}
+
+// downloadKey identifies downloaded file
+type downloadKey struct {
+	chatID int64
+	fileID string
+}
+
+// downloadTask is a queued file
+type downloadTask struct {
+	downloadKey
+	attempt int
+}
+
+// downloader is a state of files downloader
+type downloader struct {
+	sync.Mutex
+	once   sync.Once
+	queue  chan downloadTask
+	client *http.Client
+	// pending are files in queue, waiting for retry or in progress
+	pending map[downloadKey]bool
+	active  int
+}
+
+// downloadStatus is a state of downloader for status endpoint
+type downloadStatus struct {
+	Workers int
+	Queued  int
+	Active  int
+	Pending int
+}
+
+// StartDownloads method starts download workers and retry of failed downloads.
+// It is called by QueueFile if it was not called before.
+func (s *Server) StartDownloads() {
+	s.downloads.once.Do(func() {
+		settings := &s.Downloads
+		if settings.Workers <= 0 {
+			settings.Workers = defaultDownloadSettings.Workers
+		}
+		if settings.QueueSize <= 0 {
+			settings.QueueSize = defaultDownloadSettings.QueueSize
+		}
+		if settings.Retries <= 0 {
+			settings.Retries = defaultDownloadSettings.Retries
+		}
+		if settings.RetryDelay <= 0 {
+			settings.RetryDelay = defaultDownloadSettings.RetryDelay
+		}
+		if settings.Timeout <= 0 {
+			settings.Timeout = defaultDownloadSettings.Timeout
+		}
+		if settings.RetryInterval <= 0 {
+			settings.RetryInterval = defaultDownloadSettings.RetryInterval
+		}
+		if settings.MaxAttempts <= 0 {
+			settings.MaxAttempts = defaultDownloadSettings.MaxAttempts
+		}
+
+		s.downloads.queue = make(chan downloadTask, settings.QueueSize)
+		s.downloads.pending = make(map[downloadKey]bool)
+		s.downloads.client = s.downloadClient()
+		for i := 0; i < settings.Workers; i++ {
+			go s.downloadWorker()
+		}
+		go s.retryFailedDownloadsLoop()
+	})
+}
+
+// downloadClient returns http client with timeout and transport of bot
+func (s *Server) downloadClient() *http.Client {
+	client := &http.Client{Timeout: s.Downloads.Timeout}
+	if client.Timeout <= 0 {
+		client.Timeout = defaultDownloadSettings.Timeout
+	}
+	if s.Bot != nil && s.Bot.Client != nil {
+		client.Transport = s.Bot.Client.Transport
+	}
+	return client
+}
+
+// QueueFile method adds file to download queue, files which are queued or already downloaded are skipped
+func (s *Server) QueueFile(fileID string, chatID int64) {
+	s.StartDownloads()
+	if _, err := s.DB.GetFile(fileID, chatID); err == nil {
+		return
+	}
+
+	key := downloadKey{chatID: chatID, fileID: fileID}
+	s.downloads.Lock()
+	if s.downloads.pending[key] {
+		s.downloads.Unlock()
+		return
+	}
+	s.downloads.pending[key] = true
+	s.downloads.Unlock()
+
+	s.enqueueDownload(downloadTask{downloadKey: key})
+}
+
+// enqueueDownload sends task to workers, task goes to failed downloads if queue is full
+func (s *Server) enqueueDownload(task downloadTask) {
+	select {
+	case s.downloads.queue <- task:
+	default:
+		s.failDownload(task, fmt.Errorf("download queue is full"))
+	}
+}
+
+func (s *Server) downloadWorker() {
+	for task := range s.downloads.queue {
+		s.downloads.Lock()
+		s.downloads.active++
+		s.downloads.Unlock()
+
+		err := s.downloadFile(task.fileID, task.chatID)
+
+		s.downloads.Lock()
+		s.downloads.active--
+		s.downloads.Unlock()
+
+		if err == nil {
+			s.finishDownload(task.downloadKey)
+			if err = s.DB.DeleteFailedDownload(task.chatID, task.fileID); err != nil && err != db.ErrNotFound {
+				log.Printf("Error in DeleteFailedDownload for FileID [%s]: %s", task.fileID, err)
+			}
+			continue
+		}
+
+		task.attempt++
+		if task.attempt >= s.Downloads.Retries {
+			s.failDownload(task, err)
+			continue
+		}
+		delay := s.Downloads.RetryDelay << uint(task.attempt-1)
+		log.Printf("Error in download FileID [%s], attempt %d, retry in %s: %s", task.fileID, task.attempt, delay, err)
+		retry := task
+		time.AfterFunc(delay, func() { s.enqueueDownload(retry) })
+	}
+}
+
+// finishDownload removes file from pending ones
+func (s *Server) finishDownload(key downloadKey) {
+	s.downloads.Lock()
+	delete(s.downloads.pending, key)
+	s.downloads.Unlock()
+}
+
+// failDownload saves file to failed downloads for retry later
+func (s *Server) failDownload(task downloadTask, reason error) {
+	s.finishDownload(task.downloadKey)
+	log.Printf("Download of FileID [%s] in chat %d failed: %s", task.fileID, task.chatID, reason)
+
+	download := &db.FailedDownload{
+		ChatID:   task.chatID,
+		FileID:   task.fileID,
+		Attempts: task.attempt,
+		Error:    reason.Error(),
+		FailedAt: time.Now().Unix(),
+	}
+	if previous, err := s.getFailedDownload(task.chatID, task.fileID); err == nil {
+		download.Attempts += previous.Attempts
+	}
+	if err := s.DB.SaveFailedDownload(download); err != nil {
+		log.Printf("Error in SaveFailedDownload for FileID [%s]: %s", task.fileID, err)
+	}
+}
+
+// getFailedDownload returns failed download of file
+func (s *Server) getFailedDownload(chatID int64, fileID string) (*db.FailedDownload, error) {
+	downloads, err := s.DB.GetFailedDownloads()
+	if err != nil {
+		return nil, err
+	}
+	for _, download := range downloads {
+		if download.ChatID == chatID && download.FileID == fileID {
+			return download, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+// RetryFailedDownloads method queues failed downloads accepted by filter, nil filter accepts all downloads
+func (s *Server) RetryFailedDownloads(filter func(download *db.FailedDownload) bool) (count int, err error) {
+	downloads, err := s.DB.GetFailedDownloads()
+	if err != nil {
+		return
+	}
+	for _, download := range downloads {
+		if filter != nil && !filter(download) {
+			continue
+		}
+		s.QueueFile(download.FileID, download.ChatID)
+		count++
+	}
+	return
+}
+
+// retryFailedDownloadsLoop retries failed downloads every RetryInterval until MaxAttempts,
+// e.g. files over size limit of Bot API never will be downloaded
+func (s *Server) retryFailedDownloadsLoop() {
+	for {
+		time.Sleep(s.Downloads.RetryInterval)
+		count, err := s.RetryFailedDownloads(func(download *db.FailedDownload) bool {
+			return download.Attempts < s.Downloads.MaxAttempts
+		})
+		if err != nil {
+			log.Printf("Error in RetryFailedDownloads: %s", err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("Retry of %d failed downloads started", count)
+		}
+	}
+}
+
+// DownloadStatus method returns current state of downloader
+func (s *Server) DownloadStatus() (status downloadStatus) {
+	s.StartDownloads()
+	s.downloads.Lock()
+	defer s.downloads.Unlock()
+	status.Workers = s.Downloads.Workers
+	status.Queued = len(s.downloads.queue)
+	status.Active = s.downloads.active
+	status.Pending = len(s.downloads.pending)
+	return
+}
+
+// downloadFile downloads file from Telegram to media storage and saves it to database
+func (s *Server) downloadFile(fileID string, chatID int64) (err error) {
+	f, err := s.Bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return
+	}
+
+	body, err := openURL(s.downloads.client, f.Link(s.APIKey))
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	ref, err := media.Save(s.mediaBackend(), body, f.FilePath)
+	if err != nil {
+		return
+	}
+
+	ref.ChatID = chatID
+	ref.FileID = fileID
+	if media.HasThumbnail(ref.Path) {
+		// file without thumbnail is still shown
+		if err := media.SaveThumbnail(s.mediaBackend(), ref); err != nil {
+			log.Printf("Error in SaveThumbnail for FileID [%s]: %s", fileID, err)
+		}
+	}
+	if err = s.DB.SaveMediaRef(ref); err != nil {
+		return
+	}
+	f.FilePath = ref.Path
+	f.FileSize = int(ref.Size)
+	return s.DB.SaveFile(&f, chatID)
+}
+
+// openURL returns body of successful response
+func openURL(client *http.Client, url string) (body io.ReadCloser, err error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// fetchFile downloads url to file, file is replaced only after successful download
+func fetchFile(client *http.Client, url string, filename string) (err error) {
+	body, err := openURL(client, url)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+
+	tmp := filename + ".part"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	return os.Rename(tmp, filename)
+}
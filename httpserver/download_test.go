@@ -0,0 +1,266 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/media"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// fakeFileServer is a fake Telegram file server, file ID defines response of file download:
+// "missing" is not found, "slow" is longer than any timeout, "flaky" fails twice,
+// "blocked" waits for release and others are downloaded
+type fakeFileServer struct {
+	*httptest.Server
+	sync.Mutex
+	// getFile are counts of getFile requests by file ID
+	getFile map[string]int
+	// downloads are counts of file downloads by file ID
+	downloads map[string]int
+	release   chan struct{}
+}
+
+func newFakeFileServer(t *testing.T) *fakeFileServer {
+	f := &fakeFileServer{getFile: make(map[string]int), downloads: make(map[string]int), release: make(chan struct{})}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bot123:ABC/getFile" {
+			r.ParseForm()
+			fileID := r.PostForm.Get("file_id")
+			f.Lock()
+			f.getFile[fileID]++
+			f.Unlock()
+			w.Write([]byte(`{"ok":true,"result":{"file_id":"` + fileID + `","file_path":"documents/` + fileID + `.txt"}}`))
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/file/bot123:ABC/documents/") {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		fileID := strings.TrimSuffix(filepath.Base(r.URL.Path), ".txt")
+		f.Lock()
+		f.downloads[fileID]++
+		count := f.downloads[fileID]
+		f.Unlock()
+
+		switch {
+		case fileID == "missing":
+			http.NotFound(w, r)
+			return
+		case fileID == "slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		case fileID == "flaky" && count <= 2:
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case fileID == "blocked":
+			<-f.release
+		}
+		w.Write([]byte("data of " + fileID))
+	}))
+	return f
+}
+
+// server returns Server which downloads files from fake file server to dir
+func (f *fakeFileServer) server(dir string, settings DownloadSettings) *Server {
+	base, _ := url.Parse(f.URL)
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = base.Scheme
+		r.URL.Host = base.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	return &Server{
+		Bot:       &tgbotapi.BotAPI{Token: "123:ABC", Client: client},
+		APIKey:    "123:ABC",
+		DB:        db.NewMemoryStore(),
+		Media:     media.NewLocal(dir),
+		Downloads: settings,
+	}
+}
+
+// count returns count of file requests
+func (f *fakeFileServer) count(counts map[string]int, fileID string) int {
+	f.Lock()
+	defer f.Unlock()
+	return counts[fileID]
+}
+
+// waitDownloads waits until downloader has no pending files
+func waitDownloads(t *testing.T, s *Server) {
+	deadline := time.Now().Add(5 * time.Second)
+	for s.DownloadStatus().Pending != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Downloads are not finished: %+v", s.DownloadStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// failedDownload returns failed download of file or nil
+func failedDownload(t *testing.T, s *Server, fileID string) *db.FailedDownload {
+	downloads, err := s.DB.GetFailedDownloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, download := range downloads {
+		if download.FileID == fileID {
+			return download
+		}
+	}
+	return nil
+}
+
+// newDownloadDir returns temporary media directory and cleanup function which removes it
+func newDownloadDir(t *testing.T) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestDownloads(t *testing.T) {
+	files := newFakeFileServer(t)
+	defer files.Close()
+	dir, cleanup := newDownloadDir(t)
+	defer cleanup()
+	s := files.server(dir, DownloadSettings{Workers: 2, Retries: 3, RetryDelay: 10 * time.Millisecond, Timeout: 100 * time.Millisecond})
+
+	for _, fileID := range []string{"good", "flaky", "missing", "slow"} {
+		s.QueueFile(fileID, -5)
+	}
+	waitDownloads(t, s)
+
+	// retried download is saved as successful one
+	for _, fileID := range []string{"good", "flaky"} {
+		f, err := s.DB.GetFile(fileID, -5)
+		if err != nil {
+			t.Fatalf("%s: GetFile: %s", fileID, err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.FilePath))
+		if err != nil || string(data) != "data of "+fileID || f.FileSize != len(data) || filepath.Ext(f.FilePath) != ".txt" {
+			t.Errorf("%s: downloaded file %+v has %q, %v", fileID, f, data, err)
+		}
+		if failedDownload(t, s, fileID) != nil {
+			t.Errorf("%s: downloaded file is failed", fileID)
+		}
+	}
+	if count := files.count(files.downloads, "flaky"); count != 3 {
+		t.Errorf("Flaky file is downloaded %d times", count)
+	}
+
+	tests := []struct {
+		fileID string
+		reason string
+	}{
+		{"missing", "404"},
+		{"slow", "Timeout"},
+	}
+	for _, test := range tests {
+		download := failedDownload(t, s, test.fileID)
+		if download == nil || download.ChatID != -5 || download.Attempts != 3 || !strings.Contains(download.Error, test.reason) {
+			t.Errorf("%s: failed download is %+v", test.fileID, download)
+			continue
+		}
+		if _, err := s.DB.GetFile(test.fileID, -5); err != db.ErrNotFound {
+			t.Errorf("%s: failed file is saved: %v", test.fileID, err)
+		}
+	}
+
+	// attempts of manual retry are added to previous ones
+	count, err := s.RetryFailedDownloads(func(download *db.FailedDownload) bool { return download.FileID == "missing" })
+	if err != nil || count != 1 {
+		t.Fatalf("RetryFailedDownloads returns %d, %v", count, err)
+	}
+	waitDownloads(t, s)
+	if download := failedDownload(t, s, "missing"); download == nil || download.Attempts != 6 {
+		t.Errorf("Retried failed download is %+v", download)
+	}
+}
+
+func TestDownloadsDeduplication(t *testing.T) {
+	files := newFakeFileServer(t)
+	defer files.Close()
+	dir, cleanup := newDownloadDir(t)
+	defer cleanup()
+	s := files.server(dir, DownloadSettings{Workers: 2, Retries: 3, RetryDelay: 10 * time.Millisecond})
+
+	// the same file is in several messages, e.g. forwarded ones
+	s.QueueFile("blocked", -5)
+	s.QueueFile("blocked", -5)
+	if status := s.DownloadStatus(); status.Pending != 1 {
+		t.Errorf("Queued file is queued again: %+v", status)
+	}
+	// file of other chat is other file
+	s.QueueFile("blocked", -6)
+	if status := s.DownloadStatus(); status.Pending != 2 {
+		t.Errorf("File of other chat is not queued: %+v", status)
+	}
+	close(files.release)
+	waitDownloads(t, s)
+
+	s.QueueFile("blocked", -5)
+	if status := s.DownloadStatus(); status.Pending != 0 {
+		t.Errorf("Downloaded file is queued again: %+v", status)
+	}
+	if count := files.count(files.getFile, "blocked"); count != 2 {
+		t.Errorf("File is requested %d times", count)
+	}
+}
+
+func TestDownloadsQueueFull(t *testing.T) {
+	files := newFakeFileServer(t)
+	defer files.Close()
+	dir, cleanup := newDownloadDir(t)
+	defer cleanup()
+	s := files.server(dir, DownloadSettings{Workers: 1, QueueSize: 1, Retries: 1})
+
+	// worker is busy with first file and second one waits in queue
+	s.QueueFile("blocked", -5)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.DownloadStatus().Active != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Download is not started: %+v", s.DownloadStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.QueueFile("good", -5)
+	s.QueueFile("lost", -5)
+
+	download := failedDownload(t, s, "lost")
+	if download == nil || download.Attempts != 0 || download.Error != "download queue is full" {
+		t.Errorf("File over queue size is %+v", download)
+	}
+	if status := s.DownloadStatus(); status.Pending != 2 || status.Queued != 1 {
+		t.Errorf("Bad status %+v", status)
+	}
+
+	close(files.release)
+	waitDownloads(t, s)
+	if _, err := s.DB.GetFile("good", -5); err != nil {
+		t.Errorf("Queued file is not downloaded: %s", err)
+	}
+
+	// failed download is removed after successful retry
+	if _, err := s.RetryFailedDownloads(nil); err != nil {
+		t.Fatal(err)
+	}
+	waitDownloads(t, s)
+	if download = failedDownload(t, s, "lost"); download != nil {
+		t.Errorf("Downloaded file is failed: %+v", download)
+	}
+}
@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxDuration is a max human duration, longer ones are mistakes and overflow time.Duration easily
+const maxDuration = time.Hour * 24 * 366 * 10
+
+// errDurationTooLong returns by parseDuration for duration longer than maxDuration
+var errDurationTooLong = errors.New("duration is too long")
+
+// durationUnits are units of human durations, Russian letters are accepted too
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "с": time.Second,
+	"m": time.Minute, "м": time.Minute,
+	"h": time.Hour, "ч": time.Hour,
+	"d": time.Hour * 24, "д": time.Hour * 24,
+	"w": time.Hour * 24 * 7, "н": time.Hour * 24 * 7,
+}
+
+// parseDuration parses human duration like 30m, 12h, 7d, 2w or 1d12h
+func parseDuration(s string) (d time.Duration, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	for s != "" {
+		i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+		if i <= 0 {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		var n int64
+		if n, err = strconv.ParseInt(s[:i], 10, 64); err != nil {
+			if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+				err = errDurationTooLong
+			}
+			return
+		}
+		s = s[i:]
+
+		j := strings.IndexFunc(s, unicode.IsDigit)
+		if j < 0 {
+			j = len(s)
+		}
+		unit, ok := durationUnits[s[:j]]
+		if !ok {
+			return 0, fmt.Errorf("bad duration unit %q", s[:j])
+		}
+		// checked before multiplication, so it cannot overflow
+		if n > int64((maxDuration-d)/unit) {
+			return 0, errDurationTooLong
+		}
+		d += time.Duration(n) * unit
+		s = s[j:]
+	}
+	return
+}
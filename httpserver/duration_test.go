@@ -0,0 +1,63 @@
+package httpserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected time.Duration
+		err      error
+	}{
+		{"30m", time.Minute * 30, nil},
+		{"2h", time.Hour * 2, nil},
+		{"3д", time.Hour * 72, nil},
+		{"1W", time.Hour * 24 * 7, nil},
+		{"1d12h", time.Hour * 36, nil},
+		{"3660d", maxDuration, nil},
+		{"3661d", 0, errDurationTooLong},
+		{"3660d1s", 0, errDurationTooLong},
+		{"999999999999d", 0, errDurationTooLong},
+		{"9223372036854775807s", 0, errDurationTooLong},
+		{"99999999999999999999m", 0, errDurationTooLong},
+		{"1000000w1000000w", 0, errDurationTooLong},
+	}
+	for _, test := range tests {
+		d, err := parseDuration(test.text)
+		if d != test.expected || err != test.err {
+			t.Errorf("parseDuration(%q) = %s, %v, expected %s, %v", test.text, d, err, test.expected, test.err)
+		}
+	}
+
+	for _, text := range []string{"", "d", "10", "-1d", "1x", "1d-1h", "@user"} {
+		if d, err := parseDuration(text); err == nil {
+			t.Errorf("parseDuration(%q) = %s, expected error", text, d)
+		}
+	}
+}
+
+func TestSanctionArgs(t *testing.T) {
+	tests := []struct {
+		args     string
+		query    string
+		duration time.Duration
+		fail     bool
+	}{
+		{"@user 2h", "@user", time.Hour * 2, false},
+		{"Ivan Petrov 1d", "Ivan Petrov", time.Hour * 24, false},
+		{"@user", "@user", 0, false},
+		{"", "", 0, false},
+		{"@user 30s", "", 0, true},
+		{"@user 367d", "", 0, true},
+		{"@user 999999999999d", "", 0, true},
+		{"@user 99999999999999999999d", "", 0, true},
+	}
+	for _, test := range tests {
+		query, duration, err := sanctionArgs(test.args)
+		if (err != nil) != test.fail || query != test.query || duration != test.duration {
+			t.Errorf("sanctionArgs(%q) = %q, %s, %v", test.args, query, duration, err)
+		}
+	}
+}
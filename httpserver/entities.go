@@ -0,0 +1,179 @@
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// linkSchemes is a list of allowed schemes of text_link and url entities
+var linkSchemes = map[string]bool{"http": true, "https": true, "ftp": true, "mailto": true, "tg": true}
+
+// utf16Text is a text in UTF-16 code units, offsets and lengths of entities are in them
+type utf16Text []uint16
+
+// toUTF16 function converts text to UTF-16 code units
+func toUTF16(text string) utf16Text {
+	return utf16Text(utf16.Encode([]rune(text)))
+}
+
+// substring method returns text by UTF-16 range
+func (text utf16Text) substring(start, end int) string {
+	return string(utf16.Decode(text[start:end]))
+}
+
+// entityRenderer renders message text with Telegram entities to safe HTML.
+// Entity offsets and lengths are in UTF-16 code units.
+type entityRenderer struct {
+	chatID int64
+	text   utf16Text
+	buf    bytes.Buffer
+	// linkify enables links search in text without entities, e.g. in old messages and captions
+	linkify bool
+}
+
+// renderText function returns message text as safe HTML with entities.
+// Text without entities is rendered with links found by linkRegexp.
+func renderText(chatID int64, text string, entities *[]tgbotapi.MessageEntity) template.HTML {
+	r := &entityRenderer{
+		chatID: chatID,
+		text:   toUTF16(text),
+	}
+
+	var list []tgbotapi.MessageEntity
+	if entities != nil {
+		for _, e := range *entities {
+			if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(r.text) {
+				continue
+			}
+			list = append(list, e)
+		}
+	}
+	r.linkify = len(list) == 0
+
+	// parents go before nested entities
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Offset != list[j].Offset {
+			return list[i].Offset < list[j].Offset
+		}
+		return list[i].Length > list[j].Length
+	})
+	r.write(0, len(r.text), list)
+	return template.HTML(r.buf.String())
+}
+
+// write method renders text from start to end, entities must be sorted and lay inside of range.
+// Entities which cross previous sibling are ignored, entities which cross parent are cut by parent.
+func (r *entityRenderer) write(start, end int, entities []tgbotapi.MessageEntity) {
+	pos := start
+	for i := 0; i < len(entities); {
+		e := entities[i]
+		if e.Offset < pos {
+			i++
+			continue
+		}
+		eEnd := e.Offset + e.Length
+		if eEnd > end {
+			eEnd = end
+		}
+		j := i + 1
+		for j < len(entities) && entities[j].Offset < eEnd {
+			j++
+		}
+
+		r.plain(pos, e.Offset)
+		open, close := r.tags(e, r.text.substring(e.Offset, eEnd))
+		r.buf.WriteString(open)
+		r.write(e.Offset, eEnd, entities[i+1:j])
+		r.buf.WriteString(close)
+
+		pos = eEnd
+		i = j
+	}
+	r.plain(pos, end)
+}
+
+// plain method writes escaped text without entities
+func (r *entityRenderer) plain(start, end int) {
+	if start >= end {
+		return
+	}
+	text := r.text.substring(start, end)
+	if !r.linkify {
+		r.buf.WriteString(template.HTMLEscapeString(text))
+		return
+	}
+	for _, part := range splitLinks(text) {
+		if part.URL == "" {
+			r.buf.WriteString(template.HTMLEscapeString(part.Text))
+			continue
+		}
+		fmt.Fprintf(&r.buf, `<a href="%s">%s</a>`, template.HTMLEscapeString(part.URL), template.HTMLEscapeString(part.Text))
+	}
+}
+
+// tags method returns open and close HTML tags of entity, unknown entities are rendered as plain text
+func (r *entityRenderer) tags(e tgbotapi.MessageEntity, text string) (open, close string) {
+	switch e.Type {
+	case "bold":
+		return "<b>", "</b>"
+	case "italic":
+		return "<i>", "</i>"
+	case "code":
+		return "<code>", "</code>"
+	case "pre":
+		return "<pre>", "</pre>"
+	case "bot_command":
+		return `<code class="command">`, "</code>"
+	case "url":
+		link := text
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		return linkTags(link)
+	case "email":
+		return linkTags("mailto:" + text)
+	case "text_link":
+		return linkTags(e.URL)
+	case "mention":
+		return linkTags("/user/" + url.PathEscape(strings.TrimPrefix(text, "@")))
+	case "text_mention":
+		if e.User == nil {
+			return
+		}
+		return linkTags(fmt.Sprintf("/user/%d", e.User.ID))
+	case "hashtag":
+		return linkTags(fmt.Sprintf("/chat/%d/search?q=%s", r.chatID, url.QueryEscape(text)))
+	}
+	return
+}
+
+// linkTags function returns link tags for URL, links with not allowed scheme are rendered as plain text
+func linkTags(link string) (open, close string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return
+	}
+	if u.Scheme != "" && !linkSchemes[strings.ToLower(u.Scheme)] {
+		return
+	}
+	if u.Scheme == "" && !isLocalPath(link) {
+		return
+	}
+	return fmt.Sprintf(`<a href="%s">`, template.HTMLEscapeString(link)), "</a>"
+}
+
+// isLocalPath function returns true if link is a path on this site,
+// "//host" and "/\host" are treated by browsers as links to other hosts
+func isLocalPath(link string) bool {
+	if !strings.HasPrefix(link, "/") {
+		return false
+	}
+	return len(link) == 1 || (link[1] != '/' && link[1] != '\\')
+}
@@ -0,0 +1,128 @@
+package httpserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// entity returns entity of type typ
+func entity(typ string, offset, length int) tgbotapi.MessageEntity {
+	return tgbotapi.MessageEntity{Type: typ, Offset: offset, Length: length}
+}
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tgbotapi.MessageEntity
+		expected string
+	}{
+		// plain text
+		{"escaped without entities", `<b>"&'`, nil, "&lt;b&gt;&#34;&amp;&#39;"},
+		{"links without entities", "see http://a.b/c?x=1&y=2 ok", nil,
+			`see <a href="http://a.b/c?x=1&amp;y=2">http://a.b/c?x=1&amp;y=2</a> ok`},
+		{"no links with entities", "x http://a.b", []tgbotapi.MessageEntity{entity("bold", 0, 1)}, "<b>x</b> http://a.b"},
+
+		// offsets are in UTF-16 code units
+		{"surrogate pair before entity", "😀 bold", []tgbotapi.MessageEntity{entity("bold", 3, 4)}, "😀 <b>bold</b>"},
+		{"surrogate pair in entity", "a😀b", []tgbotapi.MessageEntity{entity("italic", 1, 2)}, "a<i>😀</i>b"},
+		{"surrogate pairs around entity", "👍🏻x👍🏻", []tgbotapi.MessageEntity{entity("bold", 4, 1)}, "👍🏻<b>x</b>👍🏻"},
+		{"cyrillic", "привет мир", []tgbotapi.MessageEntity{entity("italic", 7, 3)}, "привет <i>мир</i>"},
+		{"entity out of text", "abc", []tgbotapi.MessageEntity{entity("bold", 2, 5)}, "abc"},
+		{"negative offset", "abc", []tgbotapi.MessageEntity{entity("bold", -1, 2)}, "abc"},
+
+		// nested and overlapping entities
+		{"nested", "abc def", []tgbotapi.MessageEntity{entity("bold", 0, 7), entity("italic", 4, 3)}, "<b>abc <i>def</i></b>"},
+		{"nested in any order", "abc def", []tgbotapi.MessageEntity{entity("italic", 4, 3), entity("bold", 0, 7)}, "<b>abc <i>def</i></b>"},
+		{"same range", "abc", []tgbotapi.MessageEntity{entity("bold", 0, 3), entity("italic", 0, 3)}, "<b><i>abc</i></b>"},
+		{"overlapping is cut by parent", "abcdef", []tgbotapi.MessageEntity{entity("bold", 0, 4), entity("italic", 2, 4)},
+			"<b>ab<i>cd</i></b>ef"},
+		{"crossing sibling is ignored", "abcdef", []tgbotapi.MessageEntity{entity("bold", 0, 6), entity("italic", 1, 3), entity("code", 2, 3)},
+			"<b>a<i>b<code>cd</code></i>ef</b>"},
+		{"link in bold", "go example.com", []tgbotapi.MessageEntity{entity("bold", 0, 14), entity("url", 3, 11)},
+			`<b>go <a href="http://example.com">example.com</a></b>`},
+
+		// links
+		{"url", "go example.com", []tgbotapi.MessageEntity{entity("url", 3, 11)}, `go <a href="http://example.com">example.com</a>`},
+		{"email", "a@b.c", []tgbotapi.MessageEntity{entity("email", 0, 5)}, `<a href="mailto:a@b.c">a@b.c</a>`},
+		{"text_link", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "https://x.y/?a=1&b=2"}},
+			`<a href="https://x.y/?a=1&amp;b=2">click</a>`},
+		{"text_link javascript", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "javascript:alert(1)"}},
+			"click"},
+		{"text_link javascript in upper case", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "JavaScript:alert(1)"}},
+			"click"},
+		{"text_link data", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "data:text/html,<script>"}},
+			"click"},
+		{"text_link with quote", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: `https://x.y/"onclick="alert(1)`}},
+			`<a href="https://x.y/&#34;onclick=&#34;alert(1)">click</a>`},
+		{"text_link local path", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "/chat/-5"}},
+			`<a href="/chat/-5">click</a>`},
+		{"text_link protocol relative", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "//evil.example"}},
+			"click"},
+		{"text_link backslash host", "click", []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: `/\evil.example`}},
+			"click"},
+		{"url javascript", "javascript://x%0aalert(1)", []tgbotapi.MessageEntity{entity("url", 0, 25)}, "javascript://x%0aalert(1)"},
+		{"mention", "hi @bob", []tgbotapi.MessageEntity{entity("mention", 3, 4)}, `hi <a href="/user/bob">@bob</a>`},
+		{"text_mention", "Bob", []tgbotapi.MessageEntity{{Type: "text_mention", Offset: 0, Length: 3, User: &tgbotapi.User{ID: 42, UserName: "bob"}}},
+			`<a href="/user/42">Bob</a>`},
+		{"text_mention without user", "Bob", []tgbotapi.MessageEntity{entity("text_mention", 0, 3)}, "Bob"},
+		{"hashtag", "#тег", []tgbotapi.MessageEntity{entity("hashtag", 0, 4)}, `<a href="/chat/-5/search?q=%23%D1%82%D0%B5%D0%B3">#тег</a>`},
+
+		// escaping in entities
+		{"pre escaped", `<script>alert("x")</script>`, []tgbotapi.MessageEntity{entity("pre", 0, 27)},
+			"<pre>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</pre>"},
+		{"code escaped", "a && b < c", []tgbotapi.MessageEntity{entity("code", 0, 10)}, "<code>a &amp;&amp; b &lt; c</code>"},
+		{"pre has no links", "<a href=x>http://a.b</a>", []tgbotapi.MessageEntity{entity("pre", 0, 24)},
+			"<pre>&lt;a href=x&gt;http://a.b&lt;/a&gt;</pre>"},
+		{"code in text escaped", "1<2 `x>y`", []tgbotapi.MessageEntity{entity("code", 4, 5)}, "1&lt;2 <code>`x&gt;y`</code>"},
+
+		{"command", "/help@bot", []tgbotapi.MessageEntity{entity("bot_command", 0, 9)}, `<code class="command">/help@bot</code>`},
+		{"unknown type", "$USD", []tgbotapi.MessageEntity{entity("cashtag", 0, 4)}, "$USD"},
+	}
+	for _, test := range tests {
+		var entities *[]tgbotapi.MessageEntity
+		if test.entities != nil {
+			entities = &test.entities
+		}
+		if html := string(renderText(-5, test.text, entities)); html != test.expected {
+			t.Errorf("%s: renderText returns %q, expected %q", test.name, html, test.expected)
+		}
+	}
+}
+
+func TestCaptionEntities(t *testing.T) {
+	store := db.NewMemoryStore()
+	s := &Server{DB: store}
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	date := int(time.Date(2017, 5, 1, 12, 0, 0, 0, time.Local).Unix())
+
+	// text entities are not used for caption and caption entities are not used for text
+	withText := &tgbotapi.Message{MessageID: 1, Date: date, Chat: chat, Text: "bold", Caption: "x",
+		Entities: &[]tgbotapi.MessageEntity{entity("bold", 0, 4)}}
+	withCaption := &tgbotapi.Message{MessageID: 2, Date: date + 1, Chat: chat, Caption: "photo of @bob"}
+	for _, msg := range []*tgbotapi.Message{withText, withCaption} {
+		if err := store.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	caption := &db.Caption{ChatID: -5, MessageID: 2, Entities: []tgbotapi.MessageEntity{entity("mention", 9, 4)}}
+	if err := store.SaveCaption(caption); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Unix(int64(date), 0)
+	views := s.getMessages(-5, day.Add(-time.Hour), day.Add(time.Hour))
+	if len(views) != 2 {
+		t.Fatalf("getMessages returns %d messages", len(views))
+	}
+	if views[0].Text != "<b>bold</b>" || views[0].Caption != "x" {
+		t.Errorf("Message with text is rendered as %q, %q", views[0].Text, views[0].Caption)
+	}
+	if views[1].Text != "" || views[1].Caption != `photo of <a href="/user/bob">@bob</a>` {
+		t.Errorf("Message with caption is rendered as %q, %q", views[1].Text, views[1].Caption)
+	}
+}
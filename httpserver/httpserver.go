@@ -2,7 +2,7 @@ package httpserver
 
 import (
 	"fmt"
-	"html"
+	"html/template"
 	"log"
 	"net/http"
 	"regexp"
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/media"
+	"github.com/elemc/gotelegrambot/search"
 
 	"github.com/gin-gonic/gin"
 	"gopkg.in/telegram-bot-api.v4"
@@ -20,67 +22,185 @@ import (
 type Server struct {
 	Addr          string
 	Bot           *tgbotapi.BotAPI
+	DB            db.Store
+	Search        search.Index
 	PhotoCache    PhotosCache
 	FileCache     FilesCache
 	APIKey        string
 	CensList      []string
 	StaticDirPath string
+	// WebURL is a public url of web logs without trailing slash
+	WebURL string
+	// TemplatesDir is a directory with templates which replace built-in ones
+	TemplatesDir string
+	// PublicChats are chats visible without login
+	PublicChats []int64
+	// TLSCertFile and TLSKeyFile enable https if set
+	TLSCertFile string
+	TLSKeyFile  string
+	// Downloads are settings of files downloader
+	Downloads DownloadSettings
+	// Media is a storage of downloaded files, local StaticDirPath if nil
+	Media media.Backend
+	// MediaServe is MediaServeProxy or MediaServeRedirect, MediaURLTTL is a lifetime of redirect urls
+	MediaServe  string
+	MediaURLTTL time.Duration
+
+	templates      map[string]*template.Template
+	members        memberCache
+	webhookPath    string
+	webhookSecret  string
+	webhookUpdates chan db.Update
+	downloads      downloader
+	roles          roleCache
+	targets        targetChoices
+	sanctions      sanctionScheduler
 }
 
-const (
-	header = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN"
-        "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
-	<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en">
-    <head>
-		<title>Telegram logs</title>
-		<meta charset="utf-8;" />
-		<style type="text/css">
-			TH {
-		    	background: #FFFFFF; /* Цвет фона */
-		    	color: white; /* Цвет текста */
-		   	}
-			TD {
-				vertical-align: top;
-			}
-		   	TR.even {
-    			background: #F0F4F7;
-   			}
-			P.reply {
-				color: grey;
-			}
-		</style>
-    </head>
-    <body>
-	<h2><a href="/">Telegram logs</a></h2>`
-	footer = `</body>
-</html>`
-	tableBegin = `<table border="0"><caption>%s</caption>`
-	classEven  = `class="even"`
-	tableEnd   = `</table>`
-)
+const searchPageSize = 50
+
+var linkRegexp = regexp.MustCompile(`(http|ftp|https):\/\/([\w\-_]+(?:(?:\.[\w\-_]+)+))([\w\-\.,@?^=%&:/~\+#]*[\w\-\@?^=%&/~\+#])?`)
+
+// chatView is a chat in chats list
+type chatView struct {
+	ID   int64
+	Name string
+}
+
+// textPart is a part of message text, parts with URL are links
+type textPart struct {
+	Text string
+	URL  string
+}
+
+// replyView is a quote of replied message
+type replyView struct {
+	Link string
+	Text string
+}
+
+// attachmentView is a file attached to message, Kind is photo, sticker, audio, document, video or voice.
+// Thumb is an url of preview image, Size and Duration are human readable.
+type attachmentView struct {
+	Kind     string
+	URL      string
+	Thumb    string
+	Name     string
+	Size     string
+	Duration string
+}
+
+// messageView is a message row of day page
+type messageView struct {
+	ID          int
+	Time        string
+	Photo       string
+	Author      string
+	Text        template.HTML
+	Caption     template.HTML
+	Reply       *replyView
+	Attachments []attachmentView
+	EditDate    string
+	HistoryLink string
+}
+
+// revisionView is a row of message history page
+type revisionView struct {
+	Date    string
+	DayLink string
+	Text    string
+	Caption string
+}
+
+// hitView is a row of search page
+type hitView struct {
+	Date    string
+	DayLink string
+	Sender  string
+	Snippet template.HTML
+}
+
+// userChatView is a chat on user page, Messages is a count of user messages in it
+type userChatView struct {
+	ID       int64
+	Name     string
+	Messages int
+	LastDate string
+	LastLink string
+}
+
+// userView is a data of user page
+type userView struct {
+	ID       int
+	Name     string
+	UserName string
+	Chats    []userChatView
+}
+
+// searchView is a data of search page and search form
+type searchView struct {
+	ChatID   int64
+	Query    string
+	Enabled  bool
+	Failed   bool
+	Total    int
+	Hits     []hitView
+	PrevPage int
+	NextPage int
+}
 
 // Start method starts http server
 func (s *Server) Start() {
+	if s.templates == nil {
+		if err := s.LoadTemplates(); err != nil {
+			log.Fatalf("Cannot load templates: %s", err)
+		}
+	}
 	s.UpdatePhotoCache()
 	go s.updatePhotoCacheServer()
+	go s.syncRolesServer()
+
+	r := s.router()
+	var err error
+	if s.TLSCertFile != "" {
+		err = r.RunTLS(s.Addr, s.TLSCertFile, s.TLSKeyFile)
+	} else {
+		err = r.Run(s.Addr)
+	}
+	log.Fatalf("Cannot start http server: %s", err)
+}
 
+// router returns http routes of web server
+func (s *Server) router() *gin.Engine {
 	r := gin.Default()
 
-	r.StaticFS("/static", http.Dir(s.StaticDirPath))
-	r.GET("/chat/:chat_id/:year/:month/:day", s.dayPage)
-	r.GET("/chat/:chat_id/:year/:month", s.monthPage)
-	r.GET("/chat/:chat_id/:year", s.yearPage)
-	r.GET("/chat/:chat_id/", s.chatPage)
-
+	if s.webhookUpdates != nil {
+		r.POST(s.webhookPath, s.webhookHandler)
+	}
+	r.GET("/static/*path", s.staticFile)
+	s.registerAuth(r)
+
+	chat := r.Group("/chat/:chat_id", s.chatAccess)
+	chat.GET("/message/:message_id", s.historyPage)
+	chat.GET("/search", s.searchPage)
+	chat.GET("/file/:file_id", s.chatFile)
+	chat.GET("/thumb/:file_id", s.chatThumb)
+	chat.GET("/:year/:month/:day", s.dayPage)
+	chat.GET("/:year/:month", s.monthPage)
+	chat.GET("/:year", s.yearPage)
+	chat.GET("/", s.chatPage)
+
+	r.GET("/user/:name", s.userPage)
 	r.GET("/", s.mainPage)
-
-	r.Run(s.Addr)
+	s.registerAPI(r)
+	return r
 }
 
 func (s *Server) mainPage(c *gin.Context) {
-	page := parseTemplate(s.getMain())
-	c.Header("X-XSS-Protection", "1; mode=block")
-	c.Data(http.StatusOK, "text/html", page)
+	s.render(c, "main.html", map[string]interface{}{
+		"Chats":  s.getChats(sessionUserID(c)),
+		"UserID": sessionUserID(c),
+	})
 }
 
 func (s *Server) chatPage(c *gin.Context) {
@@ -91,10 +211,14 @@ func (s *Server) chatPage(c *gin.Context) {
 		return
 	}
 
-	page := parseTemplate(s.getYears(chatID))
-	// page := parseTemplate(s.getMessages(chatID))
-	c.Header("X-XSS-Protection", "1; mode=block")
-	c.Data(http.StatusOK, "text/html", page)
+	years, err := s.DB.GetYears(chatID)
+	if err != nil {
+		log.Printf("Error in GetYears for chat %d: %s", chatID, err)
+	}
+	s.render(c, "chat.html", map[string]interface{}{
+		"ChatID": chatID,
+		"Years":  years,
+	})
 }
 
 func (s *Server) yearPage(c *gin.Context) {
@@ -111,10 +235,15 @@ func (s *Server) yearPage(c *gin.Context) {
 		return
 	}
 
-	page := parseTemplate(s.getMonths(chatID, year))
-	// page := parseTemplate(s.getMessages(chatID))
-	c.Header("X-XSS-Protection", "1; mode=block")
-	c.Data(http.StatusOK, "text/html", page)
+	months, err := s.DB.GetMonthList(chatID, year)
+	if err != nil {
+		log.Printf("Error in GetMonthList for chat %d: %s", chatID, err)
+	}
+	s.render(c, "year.html", map[string]interface{}{
+		"ChatID": chatID,
+		"Year":   year,
+		"Months": months,
+	})
 }
 
 func (s *Server) monthPage(c *gin.Context) {
@@ -137,9 +266,16 @@ func (s *Server) monthPage(c *gin.Context) {
 		return
 	}
 
-	page := parseTemplate(s.getDates(chatID, year, month))
-	c.Header("X-XSS-Protection", "1; mode=block")
-	c.Data(http.StatusOK, "text/html", page)
+	days, err := s.DB.GetDates(chatID, year, month)
+	if err != nil {
+		log.Printf("Error in GetDates for chat %d: %s", chatID, err)
+	}
+	s.render(c, "month.html", map[string]interface{}{
+		"ChatID": chatID,
+		"Year":   year,
+		"Month":  month,
+		"Days":   days,
+	})
 }
 
 func (s *Server) dayPage(c *gin.Context) {
@@ -171,9 +307,61 @@ func (s *Server) dayPage(c *gin.Context) {
 	beginTime := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
 	endTime := time.Date(year, time.Month(month), day, 23, 59, 59, 100, time.Local)
 
-	page := parseTemplate(s.getMessages(chatID, beginTime, endTime))
-	c.Header("X-XSS-Protection", "1; mode=block")
-	c.Data(http.StatusOK, "text/html", page)
+	s.render(c, "day.html", map[string]interface{}{
+		"ChatID":   chatID,
+		"Messages": s.getMessages(chatID, beginTime, endTime),
+	})
+}
+
+func (s *Server) historyPage(c *gin.Context) {
+	strChatID := c.Param("chat_id")
+	strMessageID := c.Param("message_id")
+	chatID, err := strconv.ParseInt(strChatID, 10, 64)
+	if err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+	messageID, err := strconv.Atoi(strMessageID)
+	if err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+
+	s.render(c, "history.html", map[string]interface{}{
+		"ChatID":    chatID,
+		"Revisions": s.getHistory(chatID, messageID),
+	})
+}
+
+func (s *Server) searchPage(c *gin.Context) {
+	strChatID := c.Param("chat_id")
+	chatID, err := strconv.ParseInt(strChatID, 10, 64)
+	if err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	s.render(c, "search.html", s.getSearch(chatID, c.Query("q"), page))
+}
+
+// userPage shows user by ID or username with chats where the user wrote,
+// only logged user and authors of messages in chats available for viewer are shown
+func (s *Server) userPage(c *gin.Context) {
+	view, err := s.getUser(sessionUserID(c), c.Param("name"))
+	if err != nil {
+		log.Printf("Error in getUser: %s", err)
+		c.String(http.StatusInternalServerError, "Cannot get user")
+		return
+	}
+	if view == nil {
+		c.String(http.StatusNotFound, "User not found")
+		return
+	}
+	s.render(c, "user.html", view)
 }
 
 func (s *Server) updatePhotoCacheServer() {
@@ -186,21 +374,86 @@ func (s *Server) updatePhotoCacheServer() {
 	}
 }
 
-func parseTemplate(body string) []byte {
-	result := fmt.Sprintf("%s\n%s\n%s", header, body, footer)
-	return []byte(result)
+// getAttachments returns files of message with previews and metadata
+func (s *Server) getAttachments(msg *tgbotapi.Message) (attachments []attachmentView) {
+	chatID := msg.Chat.ID
+	if msg.Audio != nil {
+		name := msg.Audio.Title
+		if msg.Audio.Performer != "" && name != "" {
+			name = msg.Audio.Performer + " - " + name
+		}
+		attachments = append(attachments, attachmentView{
+			Kind:     "audio",
+			URL:      s.GetFileNameByFileID(chatID, msg.Audio.FileID),
+			Name:     name,
+			Size:     formatFileSize(msg.Audio.FileSize),
+			Duration: formatDuration(msg.Audio.Duration),
+		})
+	}
+	if msg.Document != nil {
+		view := attachmentView{
+			Kind: "document",
+			URL:  s.GetFileNameByFileID(chatID, msg.Document.FileID),
+			Name: msg.Document.FileName,
+			Size: formatFileSize(msg.Document.FileSize),
+		}
+		if msg.Document.Thumbnail != nil {
+			view.Thumb = s.previewURL(chatID, msg.Document.Thumbnail.FileID)
+		}
+		attachments = append(attachments, view)
+	}
+	if msg.Photo != nil && len(*msg.Photo) > 0 {
+		f := (*msg.Photo)[len(*msg.Photo)-1]
+		attachments = append(attachments, attachmentView{
+			Kind:  "photo",
+			URL:   s.GetFileNameByFileIDURL(chatID, f.FileID),
+			Thumb: s.previewURL(chatID, f.FileID),
+			Size:  formatFileSize(f.FileSize),
+		})
+	}
+	if msg.Sticker != nil {
+		attachments = append(attachments, attachmentView{
+			Kind:  "sticker",
+			URL:   s.GetFileNameByFileIDURL(chatID, msg.Sticker.FileID),
+			Thumb: s.previewURL(chatID, msg.Sticker.FileID),
+			Name:  msg.Sticker.Emoji,
+		})
+	}
+	if msg.Video != nil {
+		view := attachmentView{
+			Kind:     "video",
+			URL:      s.GetFileNameByFileIDURL(chatID, msg.Video.FileID),
+			Size:     formatFileSize(msg.Video.FileSize),
+			Duration: formatDuration(msg.Video.Duration),
+		}
+		if msg.Video.Thumbnail != nil {
+			view.Thumb = s.previewURL(chatID, msg.Video.Thumbnail.FileID)
+		}
+		attachments = append(attachments, view)
+	}
+	if msg.Voice != nil {
+		attachments = append(attachments, attachmentView{
+			Kind:     "voice",
+			URL:      s.GetFileNameByFileIDURL(chatID, msg.Voice.FileID),
+			Size:     formatFileSize(msg.Voice.FileSize),
+			Duration: formatDuration(msg.Voice.Duration),
+		})
+	}
+	return
 }
 
-func (s *Server) getMain() (body string) {
-	body += fmt.Sprintf(tableBegin, "Chats")
-
-	chats, err := db.GetChats()
+// getChats returns chats visible for user
+func (s *Server) getChats(userID int) (views []chatView) {
+	chats, err := s.DB.GetChats()
 	if err != nil {
-		log.Printf("Error in getMain: %s", err)
-		return ""
+		log.Printf("Error in getChats: %s", err)
+		return
 	}
 
-	for index, chat := range chats {
+	for _, chat := range chats {
+		if !s.CanViewChat(userID, chat.ID) {
+			continue
+		}
 		chatName := chat.Title
 		if chat.Title == "" {
 			chatName = chat.UserName
@@ -214,192 +467,204 @@ func (s *Server) getMain() (body string) {
 			chatName += fmt.Sprintf(" (%s)", names)
 		}
 
-		class := ""
-		if index%2 == 0 {
-			class = classEven
-		}
-
-		body += fmt.Sprintf(`
-			<tr %s>
-				<td class="la"><a href="/chat/%d/">%s</a></td>
-			</tr>`, class, chat.ID, chatName)
-
+		views = append(views, chatView{ID: chat.ID, Name: chatName})
 	}
-	body += tableEnd
-
 	return
 }
 
-func getDate(id int64) (body string) {
-	// TODO: create it
-	return
+// captionEntities method returns stored entities of message caption, text entities are not used for caption
+func (s *Server) captionEntities(msg *tgbotapi.Message) *[]tgbotapi.MessageEntity {
+	caption, err := s.DB.GetCaption(msg.Chat.ID, msg.MessageID)
+	if err != nil {
+		if err != db.ErrNotFound {
+			log.Printf("Error in GetCaption: %s", err)
+		}
+		return nil
+	}
+	return &caption.Entities
 }
 
-func (s *Server) getMessages(chatID int64, beginTime, endTime time.Time) (body string) {
-	body += fmt.Sprintf(tableBegin, "Messages")
-
-	msgs, err := db.GetMessagesByDate(chatID, beginTime, endTime)
+func (s *Server) getMessages(chatID int64, beginTime, endTime time.Time) (views []messageView) {
+	msgs, err := s.DB.GetMessagesByDate(chatID, beginTime, endTime)
 	if err != nil {
 		log.Printf("Error in getMessages: %s", err)
-		return ""
+		return
 	}
 
-	for index, msg := range msgs {
+	for _, msg := range msgs {
 		t := time.Unix(int64(msg.Date), 0)
-		name := msg.From.UserName
-		if msg.From.UserName == "" {
-			name = fmt.Sprintf("%s %s", msg.From.FirstName, msg.From.LastName)
+		view := messageView{
+			ID:     msg.MessageID,
+			Time:   t.Format("15:04:05"),
+			Author: getAuthorName(msg),
+			Text:   renderText(msg.Chat.ID, msg.Text, msg.Entities),
 		}
-		if msg.From.FirstName != "" || msg.From.LastName != "" {
-			names := strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)
-			name += fmt.Sprintf(" (%s)", names)
+		if msg.Caption != "" {
+			view.Caption = renderText(msg.Chat.ID, msg.Caption, s.captionEntities(msg))
 		}
 
-		msgText := formatMessage(msg.Text)
-		re := regexp.MustCompile(`(http|ftp|https):\/\/([\w\-_]+(?:(?:\.[\w\-_]+)+))([\w\-\.,@?^=%&amp;:/~\+#]*[\w\-\@?^=%&amp;/~\+#])?`)
-		msgText = re.ReplaceAllString(msgText, `<a href="$0">$0</a>`)
-
 		if msg.ReplyToMessage != nil {
-			lt := time.Unix(int64(msg.ReplyToMessage.Date), 0)
-			replyLink := fmt.Sprintf("/chat/%d/%d/%d/%d#%s", msg.Chat.ID, lt.Year(), lt.Month(), lt.Day(), lt.Format("15:04:05"))
-			msgText = fmt.Sprintf(`<p class="reply"> <a href="%s">></a> %s</p><p>%s</p>`, replyLink, msg.ReplyToMessage.Text, msgText)
+			view.Reply = &replyView{
+				Link: dayLink(msg.Chat.ID, msg.ReplyToMessage.Date),
+				Text: msg.ReplyToMessage.Text,
+			}
 		}
 
-		class := ""
-		if index%2 == 0 {
-			class = classEven
+		if msg.From != nil {
+			view.Photo = s.GetPhotoFileName(int64(msg.From.ID))
+		} else {
+			view.Photo = s.GetPhotoFileName(msg.Chat.ID)
 		}
 
-		photo := s.GetPhotoFileName(int64(msg.From.ID))
-		timeStr := t.Format("15:04:05")
-
-		if msg.Audio != nil {
-			msgText += fmt.Sprintf(`<p><a href="/%s">Audio in message</a></p>`, s.GetFileNameByFileID(msg.Chat.ID, msg.Audio.FileID))
-		}
-		if msg.Document != nil {
-			msgText += fmt.Sprintf(`<p><a href="/%s">Document in message</a></p>`, s.GetFileNameByFileID(msg.Chat.ID, msg.Document.FileID))
-		}
-		if msg.Photo != nil {
-			msgText += "<p>"
-			f := (*msg.Photo)[len(*msg.Photo)-1]
-			//for _, f := range *msg.Photo {
-			photoName := s.GetFileNameByFileIDURL(msg.Chat.ID, f.FileID)
-			msgText += fmt.Sprintf(`<p><a href="/%s"><img src="/%s"></img></a>`, photoName, photoName)
-			//}
-			msgText += "</p>"
-		}
-		if msg.Sticker != nil {
-			msgText += fmt.Sprintf(`<p><img src="/%s"></img></p>`, s.GetFileNameByFileIDURL(msg.Chat.ID, msg.Sticker.FileID))
-		}
-		if msg.Video != nil {
-			msgText += fmt.Sprintf(`<p><a href="/%s">Video in message</a></p>`, s.GetFileNameByFileIDURL(msg.Chat.ID, msg.Video.FileID))
-		}
-		if msg.Voice != nil {
-			msgText += fmt.Sprintf(`<p><a href="/%s">Voice in message</a></p>`, s.GetFileNameByFileIDURL(msg.Chat.ID, msg.Voice.FileID))
+		view.Attachments = s.getAttachments(msg)
+		if msg.EditDate != 0 {
+			view.EditDate = time.Unix(int64(msg.EditDate), 0).Format("2006-01-02 15:04:05")
+			view.HistoryLink = fmt.Sprintf("/chat/%d/message/%d", msg.Chat.ID, msg.MessageID)
 		}
 
-		body += fmt.Sprintf(`
-			<tr %s>
-				<td class="la" align="center" width='3%%'><img src="/%s" height="30px" width="30px"></img></td>
-				<td class="la" align="center" width='5%%'><a id="%s" name="%s" href="#%s" class="time">%s</td>
-				<td class="la" width='17%%'><strong>%s</strong></td>
-				<td class="la">%s</td>
-				<td style="display:none;">%d</td>
-			</tr>`, class, photo, timeStr, timeStr, timeStr, timeStr, formatMessage(name), msgText, msg.MessageID)
+		views = append(views, view)
 	}
-	body += tableEnd
+	return
+}
 
+// splitLinks splits text to plain parts and links
+func splitLinks(text string) (parts []textPart) {
+	last := 0
+	for _, loc := range linkRegexp.FindAllStringIndex(text, -1) {
+		if loc[0] > last {
+			parts = append(parts, textPart{Text: text[last:loc[0]]})
+		}
+		link := text[loc[0]:loc[1]]
+		parts = append(parts, textPart{Text: link, URL: link})
+		last = loc[1]
+	}
+	if last < len(text) {
+		parts = append(parts, textPart{Text: text[last:]})
+	}
 	return
 }
 
-func (s *Server) getYears(chatID int64) (body string) {
-	body += fmt.Sprintf(tableBegin, "Years")
+// dayLink returns link to message time anchor on day page
+func dayLink(chatID int64, date int) string {
+	lt := time.Unix(int64(date), 0)
+	return fmt.Sprintf("/chat/%d/%d/%d/%d#%s", chatID, lt.Year(), lt.Month(), lt.Day(), lt.Format("15:04:05"))
+}
 
-	dates, err := db.GetYears(chatID)
-	if err != nil {
-		log.Printf("Error in GetYears for chat %d: %s", chatID, err)
-		return ""
-	}
-	for index, date := range dates {
-		class := ""
-		if index%2 == 0 {
-			class = classEven
+// getAuthorName returns message author name, channel posts have no author and signed by channel title
+func getAuthorName(msg *tgbotapi.Message) (name string) {
+	if msg.From == nil {
+		if msg.Chat != nil {
+			name = msg.Chat.Title
 		}
-		body += fmt.Sprintf(`
-			<tr %s>
-				<td class="la"><a href="/chat/%d/%s">%s</a></td>
-			</tr>`, class, chatID, date, date)
-
+		return
 	}
-	body += tableEnd
 
+	name = msg.From.UserName
+	if msg.From.UserName == "" {
+		name = fmt.Sprintf("%s %s", msg.From.FirstName, msg.From.LastName)
+	}
+	if msg.From.FirstName != "" || msg.From.LastName != "" {
+		names := strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)
+		name += fmt.Sprintf(" (%s)", names)
+	}
 	return
 }
 
-func (s *Server) getMonths(chatID int64, year int) (body string) {
-	body += fmt.Sprintf(tableBegin, "Months")
+// getUser method returns user page of user with ID or username name, nil if user is not found or not visible for viewer
+func (s *Server) getUser(viewerID int, name string) (view *userView, err error) {
+	var user *tgbotapi.User
+	if id, convErr := strconv.Atoi(name); convErr == nil {
+		if user, err = s.DB.GetUserByID(id); err == db.ErrNotFound {
+			return nil, nil
+		}
+	} else if user, err = s.DB.GetUser("@" + strings.TrimPrefix(name, "@")); err != nil {
+		if _, notFound := err.(*db.UserNotFoundError); notFound {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return
+	}
 
-	dates, err := db.GetMonthList(chatID, year)
+	view = &userView{
+		ID:       user.ID,
+		Name:     strings.TrimSpace(user.FirstName + " " + user.LastName),
+		UserName: user.UserName,
+	}
+	userChats, err := s.DB.GetUserChats(user.ID)
 	if err != nil {
-		log.Printf("Error in GetYears for chat %d: %s", chatID, err)
-		return ""
+		return nil, fmt.Errorf("Cannot get chats of user %d: %s", user.ID, err)
 	}
-	for index, date := range dates {
-		class := ""
-		if index%2 == 0 {
-			class = classEven
+	names := make(map[int64]string)
+	for _, chat := range s.getChats(viewerID) {
+		names[chat.ID] = chat.Name
+	}
+	for _, chat := range userChats {
+		name, visible := names[chat.ChatID]
+		if !visible {
+			continue
 		}
-		body += fmt.Sprintf(`
-			<tr %s>
-				<td class="la" ><a href="/chat/%d/%d/%d">%s</a></td>
-			</tr>`, class, chatID, year, date, date.String())
-
+		view.Chats = append(view.Chats, userChatView{
+			ID:       chat.ChatID,
+			Name:     name,
+			Messages: chat.Messages,
+			LastDate: time.Unix(int64(chat.LastDate), 0).Format("2006-01-02 15:04:05"),
+			LastLink: dayLink(chat.ChatID, chat.LastDate),
+		})
+	}
+	if len(view.Chats) == 0 && user.ID != viewerID {
+		return nil, nil
 	}
-	body += tableEnd
-
 	return
 }
 
-func (s *Server) getDates(chatID int64, year int, month int) (body string) {
-	body += fmt.Sprintf(tableBegin, "Dates")
-
-	dates, err := db.GetDates(chatID, year, month)
+func (s *Server) getHistory(chatID int64, messageID int) (views []revisionView) {
+	revisions, err := s.DB.GetMessageRevisions(chatID, messageID)
 	if err != nil {
-		log.Printf("Error in GetYears for chat %d: %s", chatID, err)
-		return ""
+		log.Printf("Error in getHistory: %s", err)
+		return
 	}
-	for index, date := range dates {
-		class := ""
-		if index%2 == 0 {
-			class = classEven
-		}
-		body += fmt.Sprintf(`
-			<tr %s>
-				<td class="la" ><a href="/chat/%d/%d/%d/%d">%02d</a></td>
-			</tr>`, class, chatID, year, month, date, date)
 
+	for _, revision := range revisions {
+		msg := revision.Message
+		views = append(views, revisionView{
+			Date:    time.Unix(int64(revision.Date), 0).Format("2006-01-02 15:04:05"),
+			DayLink: dayLink(chatID, msg.Date),
+			Text:    msg.Text,
+			Caption: msg.Caption,
+		})
 	}
-	body += tableEnd
-
 	return
 }
 
-func searchAndReplace(msg string, phrase string, replace string) string {
-	bytesMsg := []byte(msg)
-	loMsg := strings.ToLower(msg)
-	scriptIdx := strings.Index(loMsg, phrase)
-	if scriptIdx >= 0 {
-		for i, b := range []byte(replace) {
-			bytesMsg[scriptIdx+i] = b
-		}
+func (s *Server) getSearch(chatID int64, query string, page int) (view searchView) {
+	view = searchView{ChatID: chatID, Query: query, Enabled: s.Search != nil}
+	if !view.Enabled || strings.TrimSpace(query) == "" {
+		return
 	}
 
-	return string(bytesMsg)
-}
+	result, err := s.Search.Search(chatID, query, (page-1)*searchPageSize, searchPageSize)
+	if err != nil {
+		log.Printf("Error in search %q in chat %d: %s", query, chatID, err)
+		view.Failed = true
+		return
+	}
 
-func formatMessage(msg string) string {
-	return html.EscapeString(msg)
-	// msg = searchAndReplace(msg, "<script", "%SCRIPT")
-	// msg = searchAndReplace(msg, "script:", "script%")
-	//return msg
+	view.Total = result.Total
+	for _, hit := range result.Hits {
+		view.Hits = append(view.Hits, hitView{
+			Date:    time.Unix(int64(hit.Date), 0).Format("2006-01-02 15:04:05"),
+			DayLink: dayLink(chatID, hit.Date),
+			Sender:  hit.Sender,
+			// snippet is escaped by search package, only <mark> tags are added
+			Snippet: template.HTML(hit.HTMLSnippet()),
+		})
+	}
+	if page > 1 {
+		view.PrevPage = page - 1
+	}
+	if page*searchPageSize < result.Total {
+		view.NextPage = page + 1
+	}
+	return
 }
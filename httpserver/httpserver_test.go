@@ -0,0 +1,152 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestUserPage(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	// viewers are not members of private chat
+	api.status = "left"
+	s := api.server()
+	s.DB = db.NewMemoryStore()
+	s.PublicChats = []int64{-1}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	public := &tgbotapi.Chat{ID: -1, Type: "group", Title: "Public"}
+	private := &tgbotapi.Chat{ID: -2, Type: "group", Title: "Private"}
+	bob := &tgbotapi.User{ID: 7, FirstName: "Bob", UserName: "bob"}
+	eve := &tgbotapi.User{ID: 8, FirstName: "Eve", UserName: "eve"}
+	last := int(time.Date(2017, 5, 2, 10, 0, 0, 0, time.Local).Unix())
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 1, Date: last - 86400, Chat: public, From: bob, Text: "a"})
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 2, Date: last, Chat: public, From: eve, ForwardFrom: bob, Text: "b"})
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 3, Date: last, Chat: private, From: bob, Text: "c"})
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 4, Date: last, Chat: private, From: eve, Text: "d"})
+
+	r := s.router()
+	get := func(path string, viewerID int) (int, string) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if viewerID != 0 {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.newSession(viewerID, time.Now().Add(time.Hour))})
+		}
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	// messages of chats not available for viewer are not counted
+	for _, path := range []string{"/user/bob", "/user/@bob", "/user/7"} {
+		code, body := get(path, 0)
+		if code != http.StatusOK || !strings.Contains(body, "Public") || !strings.Contains(body, "2 messages") {
+			t.Errorf("%s: status %d, %s", path, code, body)
+		}
+		if strings.Contains(body, "Private") {
+			t.Errorf("%s: chat not available for viewer is shown", path)
+		}
+		if !strings.Contains(body, dayLink(-1, last)) {
+			t.Errorf("%s: no link to day of last message %s", path, dayLink(-1, last))
+		}
+	}
+
+	// user who wrote only in private chat is visible only for self
+	for _, path := range []string{"/user/nobody", "/user/999"} {
+		if code, _ := get(path, 0); code != http.StatusNotFound {
+			t.Errorf("%s: status %d", path, code)
+		}
+	}
+	code, body := get("/user/eve", 0)
+	if code != http.StatusOK || !strings.Contains(body, "1 messages") {
+		t.Errorf("Author of message in public chat: status %d, %s", code, body)
+	}
+	if code, _ = get("/user/9", 0); code != http.StatusNotFound {
+		t.Errorf("Unknown user: status %d", code)
+	}
+	s.DB.SaveUser(&tgbotapi.User{ID: 9, FirstName: "Carol"})
+	if code, _ = get("/user/9", 0); code != http.StatusNotFound {
+		t.Errorf("User without messages in visible chats: status %d", code)
+	}
+	if code, _ = get("/user/9", 9); code != http.StatusOK {
+		t.Errorf("User page for self: status %d", code)
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	s := &Server{DB: db.NewMemoryStore(), PublicChats: []int64{-1}}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	chat := &tgbotapi.Chat{ID: -1, Type: "group", Title: "Public"}
+	date := int(time.Date(2017, 5, 2, 10, 0, 0, 0, time.Local).Unix())
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 1, Date: date, Chat: chat, Text: "original <b>"})
+	s.DB.SaveEditedMessage(&tgbotapi.Message{MessageID: 1, Date: date, EditDate: date + 60, Chat: chat, Text: "edited"})
+
+	r := s.router()
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := get("/chat/-1/message/1")
+	original, edited := strings.Index(body, ">original &lt;b&gt;<"), strings.Index(body, ">edited<")
+	if code != http.StatusOK || original < 0 || edited < original {
+		t.Errorf("History: status %d, %s", code, body)
+	}
+	if !strings.Contains(body, dayLink(-1, date)) {
+		t.Errorf("History has no link to day of message %s", dayLink(-1, date))
+	}
+
+	// edited message links to history on day page
+	_, body = get(strings.Split(dayLink(-1, date), "#")[0])
+	if !strings.Contains(body, `href="/chat/-1/message/1"`) {
+		t.Errorf("Day page has no history link: %s", body)
+	}
+}
+
+func TestChannelPages(t *testing.T) {
+	s := &Server{DB: db.NewMemoryStore(), PublicChats: []int64{-100}}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	// channel posts have no author
+	channel := &tgbotapi.Chat{ID: -100, Type: "channel", Title: "News"}
+	if err := s.DB.SaveChat(channel, false); err != nil {
+		t.Fatal(err)
+	}
+	date := int(time.Date(2017, 5, 2, 10, 0, 0, 0, time.Local).Unix())
+	if err := s.DB.SaveMessage(&tgbotapi.Message{MessageID: 1, Date: date, Chat: channel, Text: "post"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.router()
+	pages := []struct {
+		path     string
+		expected string
+	}{
+		{"/", `href="/chat/-100/"`},
+		{"/chat/-100/", `href="/chat/-100/2017"`},
+		{"/chat/-100/2017", `href="/chat/-100/2017/5"`},
+		{"/chat/-100/2017/5", `href="/chat/-100/2017/5/2"`},
+		{"/chat/-100/2017/5/2", "News"},
+	}
+	for _, page := range pages {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", page.path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), page.expected) {
+			t.Errorf("%s: status %d, no %s in %s", page.path, w.Code, page.expected, w.Body.String())
+		}
+	}
+}
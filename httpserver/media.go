@@ -0,0 +1,192 @@
+package httpserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/media"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// MediaServeProxy serves media through web server
+	MediaServeProxy = "proxy"
+	// MediaServeRedirect redirects to presigned url of backend, backends without presigned urls are proxied
+	MediaServeRedirect = "redirect"
+
+	defaultMediaURLTTL = time.Hour
+)
+
+// mediaBackend returns storage of media, local static dir by default
+func (s *Server) mediaBackend() media.Backend {
+	if s.Media == nil {
+		s.Media = media.NewLocal(s.StaticDirPath)
+	}
+	return s.Media
+}
+
+// fileURL returns url path of file of chat without leading slash, files are served with chat access check
+func fileURL(chatID int64, fileID string) string {
+	return fmt.Sprintf("chat/%d/file/%s", chatID, url.PathEscape(fileID))
+}
+
+// previewURL returns url path of thumbnail of file, url of file itself if it has no thumbnail
+// or empty string if file is not downloaded
+func (s *Server) previewURL(chatID int64, fileID string) string {
+	if ref, err := s.DB.GetMediaRef(chatID, fileID); err == nil && ref.Thumb != "" {
+		return fmt.Sprintf("chat/%d/thumb/%s", chatID, url.PathEscape(fileID))
+	}
+	if _, err := s.DB.GetFile(fileID, chatID); err == nil {
+		return fileURL(chatID, fileID)
+	}
+	return ""
+}
+
+// formatFileSize returns human readable size or empty string for unknown size
+func formatFileSize(size int) string {
+	if size <= 0 {
+		return ""
+	}
+	return media.FormatSize(int64(size))
+}
+
+// formatDuration returns duration in seconds as m:ss or h:mm:ss, empty string for unknown duration
+func formatDuration(seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// staticFile serves files of static dir root: user photos and assets. Files of chats are stored
+// in subdirectories and served by chatFile with access check, so subdirectories and listings are not available.
+func (s *Server) staticFile(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("path"), "/")
+	if name == "" || strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	s.serveLocalFile(c, filepath.Join(s.StaticDirPath, name))
+}
+
+// chatFile serves downloaded file of chat, route is behind chatAccess
+func (s *Server) chatFile(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("chat_id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	f, err := s.DB.GetFile(c.Param("file_id"), chatID)
+	if err == db.ErrNotFound {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error in GetFile for chat %d: %s", chatID, err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	s.serveStoredFile(c, f.FilePath)
+}
+
+// chatThumb serves thumbnail of file of chat, route is behind chatAccess
+func (s *Server) chatThumb(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("chat_id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	ref, err := s.DB.GetMediaRef(chatID, c.Param("file_id"))
+	if err == db.ErrNotFound || (err == nil && ref.Thumb == "") {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error in GetMediaRef for chat %d: %s", chatID, err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	s.serveStoredFile(c, ref.Thumb)
+}
+
+// serveStoredFile serves file by path relative to static dir, content addressed media are served from backend
+func (s *Server) serveStoredFile(c *gin.Context, filePath string) {
+	name := path.Clean("/" + filePath)[1:]
+	if strings.HasPrefix(name, media.Dir+"/") {
+		s.serveMedia(c, name)
+		return
+	}
+	s.serveLocalFile(c, filepath.Join(s.StaticDirPath, filepath.FromSlash(name)))
+}
+
+// serveLocalFile serves regular file, directories are not listed
+func (s *Server) serveLocalFile(c *gin.Context, name string) {
+	info, err := os.Stat(name)
+	if err != nil || info.IsDir() {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	c.File(name)
+}
+
+// serveMedia serves content addressed media from backend
+func (s *Server) serveMedia(c *gin.Context, name string) {
+	backend := s.mediaBackend()
+	if presigner, ok := backend.(media.Presigner); ok && s.MediaServe == MediaServeRedirect {
+		ttl := s.MediaURLTTL
+		if ttl <= 0 {
+			ttl = defaultMediaURLTTL
+		}
+		link, err := presigner.PresignGet(name, ttl)
+		if err != nil {
+			log.Printf("Error in PresignGet for %s: %s", name, err)
+			c.String(http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		c.Redirect(http.StatusFound, link)
+		return
+	}
+
+	content, err := backend.Open(name)
+	if err == media.ErrNotExist {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error in open media %s: %s", name, err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer content.Close()
+
+	// content never changes, path contains its hash, but it is a content of chat
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, name, time.Time{}, seeker)
+		return
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, content); err != nil {
+		log.Printf("Error in send media %s: %s", name, err)
+	}
+}
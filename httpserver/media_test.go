@@ -0,0 +1,184 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/media"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// presignedLocal is a local backend with presigned urls of S3-like storage
+type presignedLocal struct {
+	*media.Local
+}
+
+func (p presignedLocal) PresignGet(name string, ttl time.Duration) (string, error) {
+	return "https://s3.example.com/" + name + "?ttl=" + ttl.String(), nil
+}
+
+func TestChatFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	api := newFakeBotAPI(t)
+	defer api.Close()
+
+	local := media.NewLocal(dir)
+	ref, err := media.Save(local, strings.NewReader("content"), "photos/file_1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files downloaded before content addressed storage and user photos are in static dir
+	os.MkdirAll(filepath.Join(dir, "photos"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "photos", "file_2.jpg"), []byte("legacy"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "42.jpg"), []byte("avatar"), 0644)
+
+	s := api.server()
+	s.APIKey = "123:ABC"
+	s.DB = db.NewMemoryStore()
+	s.StaticDirPath = dir
+	s.Media = local
+	s.PublicChats = []int64{-1}
+	s.DB.SaveFile(&tgbotapi.File{FileID: "new", FilePath: ref.Path}, -5)
+	s.DB.SaveMediaRef(&db.MediaRef{ChatID: -5, FileID: "new", Hash: ref.Hash, Path: ref.Path, Thumb: ref.Path})
+	s.DB.SaveFile(&tgbotapi.File{FileID: "old", FilePath: "photos/file_2.jpg"}, -5)
+	s.DB.SaveFile(&tgbotapi.File{FileID: "public", FilePath: "photos/file_2.jpg"}, -1)
+
+	r := s.router()
+	get := func(path string, userID int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if userID != 0 {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.newSession(userID, time.Now().Add(time.Hour))})
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	api.Lock()
+	api.status = "kicked"
+	api.Unlock()
+	if w := get("/chat/-5/file/new", 9); w.Code != http.StatusForbidden {
+		t.Errorf("File of chat is available for not member: status %d", w.Code)
+	}
+	api.Lock()
+	api.status = "member"
+	api.Unlock()
+
+	tests := []struct {
+		path   string
+		userID int
+		code   int
+		body   string
+	}{
+		{"/chat/-5/file/new", 0, http.StatusFound, ""},
+		{"/chat/-5/file/new", 7, http.StatusOK, "content"},
+		{"/chat/-5/thumb/new", 7, http.StatusOK, "content"},
+		{"/chat/-5/file/old", 7, http.StatusOK, "legacy"},
+		{"/chat/-5/thumb/old", 7, http.StatusNotFound, ""},
+		{"/chat/-5/file/unknown", 7, http.StatusNotFound, ""},
+		{"/chat/-1/file/public", 0, http.StatusOK, "legacy"},
+		// file ID of other chat
+		{"/chat/-1/file/new", 0, http.StatusNotFound, ""},
+		{"/static/42.jpg", 0, http.StatusOK, "avatar"},
+		// files of chats are not available without access check
+		{"/static/photos/file_2.jpg", 0, http.StatusNotFound, ""},
+		{"/static/" + ref.Path, 0, http.StatusNotFound, ""},
+		{"/" + ref.Path, 0, http.StatusNotFound, ""},
+		{"/static/photos/", 0, http.StatusNotFound, ""},
+		{"/static/", 0, http.StatusNotFound, ""},
+		{"/static/..%2F42.jpg", 0, http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := get(test.path, test.userID)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%s as %d: status %d, %q", test.path, test.userID, w.Code, w.Body.String())
+		}
+	}
+
+	// backend without presigned urls is proxied
+	s.MediaServe = MediaServeRedirect
+	if w := get("/chat/-5/file/new", 7); w.Code != http.StatusOK || w.Body.String() != "content" {
+		t.Errorf("Redirect without presigned urls: status %d, %q", w.Code, w.Body.String())
+	}
+	s.Media = presignedLocal{local}
+	w := get("/chat/-5/file/new", 7)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "https://s3.example.com/"+ref.Path+"?ttl=1h0m0s" {
+		t.Errorf("Redirect: status %d, location %q", w.Code, location)
+	}
+	// legacy files are not in backend
+	if w = get("/chat/-5/file/old", 7); w.Code != http.StatusOK || w.Body.String() != "legacy" {
+		t.Errorf("Legacy file with redirect: status %d, %q", w.Code, w.Body.String())
+	}
+	s.MediaServe = MediaServeProxy
+	if w = get("/chat/-5/file/new", 7); w.Code != http.StatusOK || w.Body.String() != "content" {
+		t.Errorf("Proxy: status %d, %q", w.Code, w.Body.String())
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	// day page queues download of not downloaded files
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	api.fail = true
+	s := api.server()
+	s.DB = db.NewMemoryStore()
+	s.PublicChats = []int64{-5}
+	s.Downloads = DownloadSettings{Workers: 1, Retries: 1}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	// file without downloaded content is shown without preview
+	s.DB.SaveFile(&tgbotapi.File{FileID: "photo", FilePath: "media/aa/aaa.jpg"}, -5)
+	s.DB.SaveMediaRef(&db.MediaRef{ChatID: -5, FileID: "photo", Hash: "aaa", Path: "media/aa/aaa.jpg", Thumb: "media/thumbs/aa/aaa.jpg"})
+	s.DB.SaveFile(&tgbotapi.File{FileID: "video thumb", FilePath: "thumbs/file_1.jpg"}, -5)
+	s.DB.SaveFile(&tgbotapi.File{FileID: "video", FilePath: "videos/file_2.mp4"}, -5)
+	s.DB.SaveFile(&tgbotapi.File{FileID: "document", FilePath: "documents/file_3.pdf"}, -5)
+	s.DB.SaveFile(&tgbotapi.File{FileID: "audio", FilePath: "music/file_4.mp3"}, -5)
+
+	date := int(time.Date(2017, 7, 14, 10, 0, 0, 0, time.Local).Unix())
+	photos := []tgbotapi.PhotoSize{{FileID: "small"}, {FileID: "photo", FileSize: 150000}}
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 1, Date: date, Chat: &tgbotapi.Chat{ID: -5, Type: "group"}, Photo: &photos,
+		Video:    &tgbotapi.Video{FileID: "video", Duration: 75, FileSize: 2 * 1024 * 1024, Thumbnail: &tgbotapi.PhotoSize{FileID: "video thumb"}},
+		Document: &tgbotapi.Document{FileID: "document", FileName: "report <1>.pdf", FileSize: 1000},
+		Audio:    &tgbotapi.Audio{FileID: "audio", Performer: "Ария", Title: "Беспечный ангел", Duration: 3700}})
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 2, Date: date, Chat: &tgbotapi.Chat{ID: -5, Type: "group"},
+		Document: &tgbotapi.Document{FileID: "not downloaded", FileName: "lost.pdf"}})
+
+	w := httptest.NewRecorder()
+	s.router().ServeHTTP(w, httptest.NewRequest("GET", "/chat/-5/2017/7/14", nil))
+	body := w.Body.String()
+	for _, expected := range []string{
+		`<a href="/chat/-5/file/photo"><img src="/chat/-5/thumb/photo" loading="lazy" /></a> <span class="meta">146.5 KiB</span>`,
+		`<img src="/chat/-5/file/video%20thumb" loading="lazy" />`,
+		`<span class="meta">1:15, 2.0 MiB</span>`,
+		`report &lt;1&gt;.pdf</a> <span class="meta">1000 B</span>`,
+		`Ария - Беспечный ангел`,
+		`<span class="meta">1:01:40</span>`,
+		`lost.pdf`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Day page has no %s: %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "not%20downloaded") {
+		t.Errorf("Link to not downloaded file: %s", body)
+	}
+
+	ids := MessageFileIDs(&tgbotapi.Message{Video: &tgbotapi.Video{FileID: "video", Thumbnail: &tgbotapi.PhotoSize{FileID: "video thumb"}}})
+	if strings.Join(ids, ",") != "video,video thumb" {
+		t.Errorf("File IDs of video are %v", ids)
+	}
+}
@@ -0,0 +1,240 @@
+package httpserver
+
+// openAPISpec is an OpenAPI description of API v1, served at /api/v1/openapi.json
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "gotelegrambot logs API",
+    "version": "1.0.0",
+    "description": "Read-only access to archived Telegram chats. Chats which are not public require session cookie from /login and membership of logged user, otherwise 401 or 403 error is returned. Users require login."
+  },
+  "servers": [{"url": "/api/v1"}],
+  "paths": {
+    "/chats": {
+      "get": {
+        "summary": "List archived chats",
+        "responses": {
+          "200": {"description": "Chats", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Chat"}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/chats/{chat_id}/years": {
+      "get": {
+        "summary": "List years with messages",
+        "parameters": [{"$ref": "#/components/parameters/ChatID"}],
+        "responses": {
+          "200": {"description": "Years", "content": {"application/json": {"schema": {"type": "array", "items": {"type": "integer"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/chats/{chat_id}/years/{year}/months": {
+      "get": {
+        "summary": "List months of year with messages",
+        "parameters": [{"$ref": "#/components/parameters/ChatID"}, {"$ref": "#/components/parameters/Year"}],
+        "responses": {
+          "200": {"description": "Months, 1 is January", "content": {"application/json": {"schema": {"type": "array", "items": {"type": "integer", "minimum": 1, "maximum": 12}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/chats/{chat_id}/years/{year}/months/{month}/days": {
+      "get": {
+        "summary": "List days of month with messages",
+        "parameters": [
+          {"$ref": "#/components/parameters/ChatID"},
+          {"$ref": "#/components/parameters/Year"},
+          {"name": "month", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1, "maximum": 12}}
+        ],
+        "responses": {
+          "200": {"description": "Days", "content": {"application/json": {"schema": {"type": "array", "items": {"type": "integer", "minimum": 1, "maximum": 31}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/chats/{chat_id}/messages": {
+      "get": {
+        "summary": "List messages by date range",
+        "description": "Messages are ordered by date and id. Pass next_cursor of response as cursor for next page.",
+        "parameters": [
+          {"$ref": "#/components/parameters/ChatID"},
+          {"name": "from", "in": "query", "description": "RFC3339 time or unix timestamp, default is beginning of history", "schema": {"type": "string"}},
+          {"name": "to", "in": "query", "description": "RFC3339 time or unix timestamp, default is now", "schema": {"type": "string"}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 100}},
+          {"name": "cursor", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Page of messages", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MessagesPage"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/chats/{chat_id}/files/{file_id}": {
+      "get": {
+        "summary": "Get metadata of downloaded file",
+        "parameters": [
+          {"$ref": "#/components/parameters/ChatID"},
+          {"name": "file_id", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "File", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/File"}}}},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/users": {
+      "get": {
+        "summary": "List users seen in chats available for logged user",
+        "responses": {
+          "200": {"description": "Users", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/User"}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/users/{user_id}": {
+      "get": {
+        "summary": "Get user by id, only users seen in chats available for logged user",
+        "parameters": [{"name": "user_id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+        "responses": {
+          "200": {"description": "User", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/downloads": {
+      "get": {
+        "summary": "Status of files downloader and failed downloads of visible chats",
+        "responses": {
+          "200": {"description": "Status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Downloads"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/downloads/retry": {
+      "post": {
+        "summary": "Queue failed downloads of visible chats again",
+        "responses": {
+          "200": {"description": "Number of queued files", "content": {"application/json": {"schema": {"type": "object", "properties": {"queued": {"type": "integer"}}}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ChatID": {"name": "chat_id", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}},
+      "Year": {"name": "year", "in": "path", "required": true, "schema": {"type": "integer"}}
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {"error": {"type": "string"}}
+      },
+      "Chat": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "type": {"type": "string", "enum": ["private", "group", "supergroup", "channel"]},
+          "title": {"type": "string"},
+          "username": {"type": "string"}
+        }
+      },
+      "User": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {
+          "id": {"type": "integer"},
+          "username": {"type": "string"},
+          "first_name": {"type": "string"},
+          "last_name": {"type": "string"}
+        }
+      },
+      "Attachment": {
+        "type": "object",
+        "required": ["type", "file_id"],
+        "properties": {
+          "type": {"type": "string", "enum": ["photo", "audio", "document", "sticker", "video", "voice"]},
+          "file_id": {"type": "string"},
+          "file_name": {"type": "string"},
+          "mime_type": {"type": "string"},
+          "file_size": {"type": "integer"},
+          "duration": {"type": "integer", "description": "seconds"},
+          "width": {"type": "integer"},
+          "height": {"type": "integer"}
+        }
+      },
+      "Message": {
+        "type": "object",
+        "required": ["id", "chat_id", "date"],
+        "properties": {
+          "id": {"type": "integer"},
+          "chat_id": {"type": "integer", "format": "int64"},
+          "date": {"type": "string", "format": "date-time"},
+          "edit_date": {"type": "string", "format": "date-time"},
+          "from": {"$ref": "#/components/schemas/User"},
+          "forward_from": {"$ref": "#/components/schemas/User"},
+          "forward_from_chat": {"$ref": "#/components/schemas/Chat"},
+          "reply_to_message_id": {"type": "integer"},
+          "text": {"type": "string"},
+          "caption": {"type": "string"},
+          "attachments": {"type": "array", "items": {"$ref": "#/components/schemas/Attachment"}}
+        }
+      },
+      "MessagesPage": {
+        "type": "object",
+        "required": ["messages"],
+        "properties": {
+          "messages": {"type": "array", "items": {"$ref": "#/components/schemas/Message"}},
+          "next_cursor": {"type": "string", "description": "absent on last page"}
+        }
+      },
+      "File": {
+        "type": "object",
+        "required": ["file_id", "file_path", "url"],
+        "properties": {
+          "file_id": {"type": "string"},
+          "file_size": {"type": "integer"},
+          "file_path": {"type": "string"},
+          "url": {"type": "string"}
+        }
+      },
+      "FailedDownload": {
+        "type": "object",
+        "required": ["chat_id", "file_id", "attempts", "error", "failed_at"],
+        "properties": {
+          "chat_id": {"type": "integer", "format": "int64"},
+          "file_id": {"type": "string"},
+          "attempts": {"type": "integer"},
+          "error": {"type": "string"},
+          "failed_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Downloads": {
+        "type": "object",
+        "required": ["workers", "queued", "active", "pending", "failed"],
+        "properties": {
+          "workers": {"type": "integer"},
+          "queued": {"type": "integer", "description": "files waiting for free worker"},
+          "active": {"type": "integer", "description": "files in progress"},
+          "pending": {"type": "integer", "description": "queued, active and waiting for retry files"},
+          "failed": {"type": "array", "items": {"$ref": "#/components/schemas/FailedDownload"}}
+        }
+      }
+    }
+  }
+}`
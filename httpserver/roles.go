@@ -0,0 +1,311 @@
+package httpserver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const roleSyncInterval = time.Minute * 10
+
+// roleNames are names of roles for commands and storage
+var roleNames = map[CommandRole]string{
+	RoleMember:    "member",
+	RoleTrusted:   "trusted",
+	RoleModerator: "moderator",
+	RoleOwner:     "owner",
+}
+
+// String method returns name of role
+func (role CommandRole) String() string {
+	return roleNames[role]
+}
+
+// ParseRole function returns role by name, empty name is a member
+func ParseRole(name string) (role CommandRole, ok bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return RoleMember, true
+	}
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+	return RoleMember, false
+}
+
+// adminRole function returns role of chat administrator by member status
+func adminRole(status string) string {
+	switch status {
+	case "creator":
+		return RoleOwner.String()
+	case "administrator":
+		return RoleModerator.String()
+	}
+	return ""
+}
+
+// effectiveRole function returns highest of granted and synced roles
+func effectiveRole(role *db.ChatRole) CommandRole {
+	granted, _ := ParseRole(role.Role)
+	synced, _ := ParseRole(role.AdminRole)
+	if synced > granted {
+		return synced
+	}
+	return granted
+}
+
+type chatRoles struct {
+	roles    map[int]CommandRole
+	syncedAt time.Time
+}
+
+// roleCache caches roles of users by chat, roles are synced with chat administrators every roleSyncInterval
+type roleCache struct {
+	sync.Mutex
+	chats map[int64]*chatRoles
+}
+
+// UserRole method returns role of user in chat, user is an owner of private chat with bot
+func (s *Server) UserRole(userID int, chat *tgbotapi.Chat) CommandRole {
+	if chat.IsPrivate() {
+		return RoleOwner
+	}
+
+	s.roles.Lock()
+	entry := s.roles.chats[chat.ID]
+	s.roles.Unlock()
+	if entry == nil || time.Since(entry.syncedAt) > roleSyncInterval {
+		if err := s.SyncRoles(chat.ID); err != nil {
+			log.Printf("Error in SyncRoles for chat %d: %s", chat.ID, err)
+		}
+	}
+
+	s.roles.Lock()
+	defer s.roles.Unlock()
+	if entry = s.roles.chats[chat.ID]; entry == nil {
+		return RoleMember
+	}
+	return entry.roles[userID]
+}
+
+// SyncRoles method updates roles of chat administrators in storage and cache.
+// Granted roles are cached even if administrators are not available.
+func (s *Server) SyncRoles(chatID int64) (err error) {
+	roles, err := s.DB.GetChatRoles(chatID)
+	if err != nil {
+		return fmt.Errorf("Cannot get roles: %s", err)
+	}
+
+	admins, adminsErr := s.Bot.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: chatID})
+	if adminsErr == nil {
+		synced := make(map[int]string)
+		for _, admin := range admins {
+			if admin.User != nil {
+				synced[admin.User.ID] = adminRole(admin.Status)
+			}
+		}
+		roles = s.applyAdminRoles(chatID, roles, synced)
+	}
+
+	entry := &chatRoles{roles: make(map[int]CommandRole), syncedAt: time.Now()}
+	for _, role := range roles {
+		entry.roles[role.UserID] = effectiveRole(role)
+	}
+	s.roles.Lock()
+	if s.roles.chats == nil {
+		s.roles.chats = make(map[int64]*chatRoles)
+	}
+	s.roles.chats[chatID] = entry
+	s.roles.Unlock()
+
+	if adminsErr != nil {
+		return fmt.Errorf("Cannot get chat administrators: %s", adminsErr)
+	}
+	return
+}
+
+// applyAdminRoles method saves changed roles of administrators and removes roles of former ones, returns actual roles
+func (s *Server) applyAdminRoles(chatID int64, roles []*db.ChatRole, synced map[int]string) (actual []*db.ChatRole) {
+	now := time.Now().Unix()
+	for _, role := range roles {
+		adminRole := synced[role.UserID]
+		delete(synced, role.UserID)
+		if role.AdminRole == adminRole {
+			actual = append(actual, role)
+			continue
+		}
+
+		role.AdminRole = adminRole
+		role.UpdatedAt = now
+		if role.Role == "" && role.AdminRole == "" {
+			if err := s.DB.DeleteChatRole(chatID, role.UserID); err != nil {
+				log.Printf("Error in DeleteChatRole: %s", err)
+			}
+			continue
+		}
+		if err := s.DB.SaveChatRole(role); err != nil {
+			log.Printf("Error in SaveChatRole: %s", err)
+		}
+		actual = append(actual, role)
+	}
+
+	for userID, adminRole := range synced {
+		role := &db.ChatRole{ChatID: chatID, UserID: userID, AdminRole: adminRole, UpdatedAt: now}
+		if err := s.DB.SaveChatRole(role); err != nil {
+			log.Printf("Error in SaveChatRole: %s", err)
+		}
+		actual = append(actual, role)
+	}
+	return
+}
+
+// syncRolesServer syncs roles of cached chats with chat administrators
+func (s *Server) syncRolesServer() {
+	for {
+		time.Sleep(roleSyncInterval)
+		s.roles.Lock()
+		var chats []int64
+		for chatID := range s.roles.chats {
+			chats = append(chats, chatID)
+		}
+		s.roles.Unlock()
+
+		for _, chatID := range chats {
+			if err := s.SyncRoles(chatID); err != nil {
+				log.Printf("Error in SyncRoles for chat %d: %s", chatID, err)
+			}
+		}
+	}
+}
+
+// setRole method grants role to user in chat, member role removes granted role
+func (s *Server) setRole(chatID int64, userID int, role CommandRole, grantedBy int) (err error) {
+	roles, err := s.DB.GetChatRoles(chatID)
+	if err != nil {
+		return
+	}
+	current := &db.ChatRole{ChatID: chatID, UserID: userID}
+	for _, r := range roles {
+		if r.UserID == userID {
+			current = r
+			break
+		}
+	}
+
+	current.Role = ""
+	if role != RoleMember {
+		current.Role = role.String()
+	}
+	current.GrantedBy = grantedBy
+	current.UpdatedAt = time.Now().Unix()
+	if current.Role == "" && current.AdminRole == "" {
+		if err = s.DB.DeleteChatRole(chatID, userID); err == db.ErrNotFound {
+			err = nil
+		}
+	} else {
+		err = s.DB.SaveChatRole(current)
+	}
+	if err != nil {
+		return
+	}
+
+	s.roles.Lock()
+	if entry := s.roles.chats[chatID]; entry != nil {
+		entry.roles[userID] = effectiveRole(current)
+	}
+	s.roles.Unlock()
+	return
+}
+
+// changeRole method checks that sender may change role of user and sets it
+func (s *Server) changeRole(msg *tgbotapi.Message, name string, role CommandRole) {
+	user := s.resolveTarget(msg, name)
+	if user == nil {
+		return
+	}
+	if user.ID == msg.From.ID {
+		s.SendError("Сам себе? O_o", msg)
+		return
+	}
+
+	// only owner may grant own role, others grant and revoke roles below own
+	own := s.UserRole(msg.From.ID, msg.Chat)
+	if own != RoleOwner && (role >= own || s.UserRole(user.ID, msg.Chat) >= own) {
+		s.SendError("Недостаточно прав для изменения роли этого пользователя", msg)
+		return
+	}
+
+	if err := s.setRole(msg.Chat.ID, user.ID, role, msg.From.ID); err != nil {
+		log.Printf("Error in setRole: %s", err)
+		s.SendError("Не удалось сохранить роль", msg)
+		return
+	}
+	s.SendMessage(fmt.Sprintf("Роль пользователя %s: %s", user.String(), s.UserRole(user.ID, msg.Chat)), msg.Chat.ID, msg.MessageID)
+}
+
+// GrantRole method grants role to user, arguments are user and role name, e.g. /grant @username trusted.
+// User may be omitted in reply to message of user.
+func (s *Server) GrantRole(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		s.SendError("Укажите пользователя и роль: /grant @username trusted", msg)
+		return
+	}
+	role, ok := ParseRole(args[len(args)-1])
+	if !ok {
+		s.SendError(fmt.Sprintf("Неизвестная роль %s, доступны: trusted, moderator, owner, member", args[len(args)-1]), msg)
+		return
+	}
+	s.changeRole(msg, strings.Join(args[:len(args)-1], " "), role)
+}
+
+// RevokeRole method removes granted role of user, roles of chat administrators are kept
+func (s *Server) RevokeRole(msg *tgbotapi.Message) {
+	s.changeRole(msg, strings.TrimSpace(msg.CommandArguments()), RoleMember)
+}
+
+// RoleList method sends list of users with roles in chat
+func (s *Server) RoleList(msg *tgbotapi.Message) {
+	// actual administrators first
+	s.UserRole(msg.From.ID, msg.Chat)
+	roles, err := s.DB.GetChatRoles(msg.Chat.ID)
+	if err != nil {
+		log.Printf("Error in GetChatRoles: %s", err)
+		return
+	}
+
+	names := make(map[int]string)
+	if users, err := s.DB.GetUsers(); err == nil {
+		for _, user := range users {
+			names[user.ID] = user.String()
+		}
+	} else {
+		log.Printf("Error in GetUsers: %s", err)
+	}
+
+	var lines []string
+	for _, role := range roles {
+		name, ok := names[role.UserID]
+		if !ok {
+			name = fmt.Sprintf("%d", role.UserID)
+		}
+		line := fmt.Sprintf("%s - %s", name, effectiveRole(role))
+		if role.AdminRole != "" {
+			line += " (администратор группы)"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		s.SendMessage("Ролей в чате нет", msg.Chat.ID, msg.MessageID)
+		return
+	}
+	s.SendMessage(fmt.Sprintf("Роли в чате:\n%s", strings.Join(lines, "\n")), msg.Chat.ID, msg.MessageID)
+}
@@ -0,0 +1,189 @@
+package httpserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// roleCommand returns command message of user in group chat
+func roleCommand(userID int, text string) *tgbotapi.Message {
+	command := strings.Fields(text)[0]
+	return &tgbotapi.Message{
+		Entities:  &[]tgbotapi.MessageEntity{entity("bot_command", 0, len(command))},
+		MessageID: 100,
+		From:      &tgbotapi.User{ID: userID, FirstName: fmt.Sprintf("user%d", userID)},
+		Chat:      memberChats[0],
+		Text:      text,
+	}
+}
+
+// grantedRole returns role granted to user in chat
+func grantedRole(t *testing.T, store db.Store, chatID int64, userID int) string {
+	roles, err := store.GetChatRoles(chatID)
+	if err != nil {
+		t.Fatalf("GetChatRoles returns error: %s", err)
+	}
+	for _, role := range roles {
+		if role.UserID == userID {
+			return role.Role
+		}
+	}
+	return ""
+}
+
+func TestChangeRolePermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		sender  CommandRole
+		target  CommandRole
+		command string
+		allowed bool
+	}{
+		{"owner grants moderator", RoleOwner, RoleMember, "/grant 2 moderator", true},
+		{"owner grants owner", RoleOwner, RoleMember, "/grant 2 owner", true},
+		{"owner revokes moderator", RoleOwner, RoleModerator, "/revoke 2", true},
+		{"moderator grants trusted", RoleModerator, RoleMember, "/grant 2 trusted", true},
+		{"moderator revokes trusted", RoleModerator, RoleTrusted, "/revoke 2", true},
+		{"moderator grants moderator", RoleModerator, RoleMember, "/grant 2 moderator", false},
+		{"moderator grants owner", RoleModerator, RoleMember, "/grant 2 owner", false},
+		{"moderator revokes moderator", RoleModerator, RoleModerator, "/revoke 2", false},
+		{"moderator demotes moderator", RoleModerator, RoleModerator, "/grant 2 trusted", false},
+		{"trusted grants trusted", RoleTrusted, RoleMember, "/grant 2 trusted", false},
+		{"member grants trusted", RoleMember, RoleMember, "/grant 2 trusted", false},
+	}
+	for _, test := range tests {
+		api := newFakeBotAPI(t)
+		s := api.server()
+		store := db.NewMemoryStore()
+		s.DB = store
+
+		chatID := memberChats[0].ID
+		for userID, role := range map[int]CommandRole{1: test.sender, 2: test.target} {
+			if role != RoleMember {
+				store.SaveChatRole(&db.ChatRole{ChatID: chatID, UserID: userID, Role: role.String()})
+			}
+		}
+		before := grantedRole(t, store, chatID, 2)
+
+		msg := roleCommand(1, test.command)
+		if msg.Command() == "grant" {
+			s.GrantRole(msg)
+		} else {
+			s.RevokeRole(msg)
+		}
+
+		after := grantedRole(t, store, chatID, 2)
+		if test.allowed && after == before {
+			t.Errorf("%s: role is not changed: %q, reply %q", test.name, after, api.lastText("sendMessage"))
+		}
+		if !test.allowed && after != before {
+			t.Errorf("%s: role is changed from %q to %q", test.name, before, after)
+		}
+		api.Close()
+	}
+}
+
+func TestChangeOwnRole(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+	s.DB = db.NewMemoryStore()
+
+	s.GrantRole(roleCommand(1, "/grant 1 owner"))
+	if role := grantedRole(t, s.DB, memberChats[0].ID, 1); role != "" {
+		t.Errorf("User grants role %q to self", role)
+	}
+}
+
+func TestRoleSync(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+	store := db.NewMemoryStore()
+	s.DB = store
+	chat := memberChats[1]
+
+	api.Lock()
+	api.admins = `[{"user":{"id":1},"status":"creator"},{"user":{"id":2},"status":"administrator"}]`
+	api.Unlock()
+
+	expected := map[int]CommandRole{1: RoleOwner, 2: RoleModerator, 3: RoleMember}
+	for i := 0; i < 2; i++ {
+		for userID, role := range expected {
+			if actual := s.UserRole(userID, chat); actual != role {
+				t.Errorf("Role of user %d is %s, expected %s", userID, actual, role)
+			}
+		}
+	}
+	if calls := len(api.calls("getChatAdministrators")); calls != 1 {
+		t.Errorf("Administrators are requested %d times, roles are not cached", calls)
+	}
+	if role := s.UserRole(1, privateChat); role != RoleOwner {
+		t.Errorf("User is %s in private chat, expected owner", role)
+	}
+
+	// granted role is cached without sync
+	if err := s.setRole(chat.ID, 3, RoleTrusted, 1); err != nil {
+		t.Fatalf("setRole returns error: %s", err)
+	}
+	if role := s.UserRole(3, chat); role != RoleTrusted {
+		t.Errorf("Granted role is %s, expected trusted", role)
+	}
+	if calls := len(api.calls("getChatAdministrators")); calls != 1 {
+		t.Errorf("Administrators are requested after grant")
+	}
+
+	// granted role is higher than administrator role
+	if err := s.setRole(chat.ID, 2, RoleOwner, 1); err != nil {
+		t.Fatalf("setRole returns error: %s", err)
+	}
+	if role := s.UserRole(2, chat); role != RoleOwner {
+		t.Errorf("Administrator with granted owner role is %s", role)
+	}
+	if err := s.setRole(chat.ID, 2, RoleMember, 1); err != nil {
+		t.Fatalf("setRole returns error: %s", err)
+	}
+	if role := s.UserRole(2, chat); role != RoleModerator {
+		t.Errorf("Administrator with revoked role is %s, expected moderator", role)
+	}
+
+	// former administrator loses synced role, granted roles are kept
+	api.Lock()
+	api.admins = `[{"user":{"id":1},"status":"creator"}]`
+	api.Unlock()
+	if err := s.SyncRoles(chat.ID); err != nil {
+		t.Fatalf("SyncRoles returns error: %s", err)
+	}
+	if role := s.UserRole(2, chat); role != RoleMember {
+		t.Errorf("Former administrator is %s", role)
+	}
+	roles, _ := store.GetChatRoles(chat.ID)
+	for _, role := range roles {
+		if role.UserID == 2 {
+			t.Errorf("Role of former administrator is stored: %+v", role)
+		}
+	}
+	if role := s.UserRole(3, chat); role != RoleTrusted {
+		t.Errorf("Granted role is %s after sync", role)
+	}
+
+	// stored roles are cached when administrators are not available
+	api.Lock()
+	api.fail = true
+	api.Unlock()
+	s.roles.chats = nil
+	if err := s.SyncRoles(chat.ID); err == nil {
+		t.Errorf("Error of getChatAdministrators is ignored")
+	}
+	if role := s.UserRole(1, chat); role != RoleOwner {
+		t.Errorf("Stored owner is %s without administrators", role)
+	}
+	if role := s.UserRole(3, chat); role != RoleTrusted {
+		t.Errorf("Granted role is %s without administrators", role)
+	}
+}
@@ -0,0 +1,397 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	sanctionCheckInterval = time.Second * 30
+	// Telegram treats shorter or longer restrictions as permanent
+	minSanctionDuration = time.Minute
+	maxSanctionDuration = time.Hour * 24 * 366
+)
+
+// chatPermissions are permissions of chat member for restrictChatMember method
+type chatPermissions struct {
+	CanSendMessages       bool `json:"can_send_messages"`
+	CanSendMediaMessages  bool `json:"can_send_media_messages"`
+	CanSendPolls          bool `json:"can_send_polls"`
+	CanSendOtherMessages  bool `json:"can_send_other_messages"`
+	CanAddWebPagePreviews bool `json:"can_add_web_page_previews"`
+	CanChangeInfo         bool `json:"can_change_info"`
+	CanInviteUsers        bool `json:"can_invite_users"`
+	CanPinMessages        bool `json:"can_pin_messages"`
+}
+
+// fullPermissions lift all restrictions of member, chat permissions are still applied by Telegram
+var fullPermissions = chatPermissions{true, true, true, true, true, true, true, true}
+
+// restrictions are permissions by name of /restrict command
+var restrictions = map[string]chatPermissions{
+	"media":    {CanSendMessages: true, CanSendPolls: true},
+	"stickers": {CanSendMessages: true, CanSendMediaMessages: true, CanSendPolls: true, CanAddWebPagePreviews: true},
+}
+
+// sanctionScheduler serializes changes of sanctions and lifts expired ones
+type sanctionScheduler struct {
+	sync.Mutex
+	once sync.Once
+}
+
+// StartSanctions method starts lifting of expired sanctions, sanctions expired while bot was stopped are lifted at once
+func (s *Server) StartSanctions() {
+	s.sanctions.once.Do(func() {
+		go func() {
+			for {
+				s.LiftExpiredSanctions(time.Now())
+				time.Sleep(sanctionCheckInterval)
+			}
+		}()
+	})
+}
+
+// LiftExpiredSanctions method lifts sanctions expired before now and announces it in chats
+func (s *Server) LiftExpiredSanctions(now time.Time) {
+	sanctions, err := s.DB.GetSanctions()
+	if err != nil {
+		log.Printf("Error in GetSanctions: %s", err)
+		return
+	}
+	for _, sanction := range sanctions {
+		if sanction.Until == 0 || sanction.Until > now.Unix() {
+			// sanctions are sorted by lift time
+			break
+		}
+		deleted, err := s.liftSanction(sanction)
+		if err != nil {
+			log.Printf("Error in lift %s of user %d in chat %d: %s", sanction.Kind, sanction.UserID, sanction.ChatID, err)
+		}
+		if !deleted {
+			// sanction is still stored, it is lifted on next check
+			continue
+		}
+		s.SendMessage(liftedText(sanction, s.userByID(sanction.UserID)), sanction.ChatID, 0)
+	}
+}
+
+// liftedText function returns announce of lifted sanction
+func liftedText(sanction *db.Sanction, user *tgbotapi.User) string {
+	switch sanction.Kind {
+	case db.SanctionBan:
+		return fmt.Sprintf("Срок бана пользователя %s истек, теперь можно вернуться в чат", user.String())
+	case db.SanctionRestrict:
+		return fmt.Sprintf("С пользователя %s сняты ограничения (%s)", user.String(), sanction.Restriction)
+	}
+	return fmt.Sprintf("Пользователь %s снова может писать в чат", user.String())
+}
+
+// liftSanction method removes sanction from storage and lifts it in Telegram, deleted is false if sanction is not removed.
+// Telegram lifts expired restrictions itself, so sanction is deleted even if request to Telegram failed.
+func (s *Server) liftSanction(sanction *db.Sanction) (deleted bool, err error) {
+	s.sanctions.Lock()
+	defer s.sanctions.Unlock()
+
+	if err = s.DB.DeleteSanction(sanction.ChatID, sanction.UserID, sanction.Kind); err != nil && err != db.ErrNotFound {
+		return false, err
+	}
+	if sanction.Kind == db.SanctionBan {
+		return true, s.unbanMember(sanction.ChatID, sanction.UserID)
+	}
+	return true, s.applyRestrictions(sanction.ChatID, sanction.UserID)
+}
+
+// applyRestrictions method sets permissions of member by active sanctions: mute is stronger than restriction,
+// member without sanctions gets all permissions
+func (s *Server) applyRestrictions(chatID int64, userID int) (err error) {
+	sanctions, err := s.DB.GetSanctions()
+	if err != nil {
+		return
+	}
+
+	var active *db.Sanction
+	for _, sanction := range sanctions {
+		if sanction.ChatID != chatID || sanction.UserID != userID || sanction.Kind == db.SanctionBan {
+			continue
+		}
+		if active == nil || sanction.Kind == db.SanctionMute {
+			active = sanction
+		}
+	}
+
+	switch {
+	case active == nil:
+		return s.restrictMember(chatID, userID, fullPermissions, 0)
+	case active.Kind == db.SanctionMute:
+		return s.restrictMember(chatID, userID, chatPermissions{}, active.Until)
+	}
+	return s.restrictMember(chatID, userID, restrictions[active.Restriction], active.Until)
+}
+
+// restrictMember method sets permissions of member until unix time, 0 means forever
+func (s *Server) restrictMember(chatID int64, userID int, permissions chatPermissions, until int64) (err error) {
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return
+	}
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(chatID, 10))
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("permissions", string(data))
+	if until != 0 {
+		params.Set("until_date", strconv.FormatInt(until, 10))
+	}
+	_, err = s.Bot.MakeRequest("restrictChatMember", params)
+	return
+}
+
+// banMember method bans member until unix time, 0 means forever
+func (s *Server) banMember(chatID int64, userID int, until int64) (err error) {
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(chatID, 10))
+	params.Set("user_id", strconv.Itoa(userID))
+	if until != 0 {
+		params.Set("until_date", strconv.FormatInt(until, 10))
+	}
+	_, err = s.Bot.MakeRequest("banChatMember", params)
+	return
+}
+
+// unbanMember method unbans banned member, members in chat are not removed
+func (s *Server) unbanMember(chatID int64, userID int) (err error) {
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(chatID, 10))
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("only_if_banned", "true")
+	_, err = s.Bot.MakeRequest("unbanChatMember", params)
+	return
+}
+
+// sanctionArgs function splits command arguments to user query and optional duration at the end
+func sanctionArgs(args string) (query string, duration time.Duration, err error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return
+	}
+	d, parseErr := parseDuration(fields[len(fields)-1])
+	if parseErr == errDurationTooLong || (parseErr == nil && (d < minSanctionDuration || d > maxSanctionDuration)) {
+		return "", 0, fmt.Errorf("Срок должен быть от 1 минуты до 366 дней")
+	}
+	if parseErr == nil {
+		fields = fields[:len(fields)-1]
+		duration = d
+	}
+	return strings.Join(fields, " "), duration, nil
+}
+
+// sanctionTarget method returns target of sanction, moderators and sender are not allowed
+func (s *Server) sanctionTarget(msg *tgbotapi.Message, query string) *tgbotapi.User {
+	user := s.resolveTarget(msg, query)
+	if user == nil {
+		return nil
+	}
+	if user.ID == msg.From.ID {
+		s.SendError("Сам себя? O_o", msg)
+		return nil
+	}
+	if s.UserRole(user.ID, msg.Chat) >= RoleModerator {
+		s.SendError(fmt.Sprintf("Пользователь [%s] является модератором группы", user.String()), msg)
+		return nil
+	}
+	return user
+}
+
+// newSanction function returns sanction of command for duration, 0 duration means forever
+func newSanction(msg *tgbotapi.Message, user *tgbotapi.User, kind string, duration time.Duration) *db.Sanction {
+	now := time.Now()
+	sanction := &db.Sanction{
+		ChatID:    msg.Chat.ID,
+		UserID:    user.ID,
+		Kind:      kind,
+		CreatedBy: msg.From.ID,
+		CreatedAt: now.Unix(),
+	}
+	if duration != 0 {
+		sanction.Until = now.Add(duration).Unix()
+	}
+	return sanction
+}
+
+// untilText function returns human readable lift time of sanction
+func untilText(sanction *db.Sanction) string {
+	if sanction.Until == 0 {
+		return "навсегда"
+	}
+	return "до " + time.Unix(sanction.Until, 0).Format("2006-01-02 15:04")
+}
+
+// restrict method saves mute or restriction and applies permissions, previous sanction of the same kind is restored on error
+func (s *Server) restrict(msg *tgbotapi.Message, user *tgbotapi.User, sanction *db.Sanction) (ok bool) {
+	s.sanctions.Lock()
+	defer s.sanctions.Unlock()
+
+	var previous *db.Sanction
+	if sanctions, err := s.DB.GetSanctions(); err == nil {
+		for _, v := range sanctions {
+			if v.ChatID == sanction.ChatID && v.UserID == sanction.UserID && v.Kind == sanction.Kind {
+				previous = v
+			}
+		}
+	}
+
+	if err := s.DB.SaveSanction(sanction); err != nil {
+		log.Printf("Error in SaveSanction: %s", err)
+		s.SendError("Не удалось сохранить ограничение", msg)
+		return false
+	}
+	if err := s.applyRestrictions(sanction.ChatID, sanction.UserID); err != nil {
+		log.Printf("Error in restrictChatMember: %s", err)
+		var restoreErr error
+		if previous != nil {
+			restoreErr = s.DB.SaveSanction(previous)
+		} else {
+			restoreErr = s.DB.DeleteSanction(sanction.ChatID, sanction.UserID, sanction.Kind)
+		}
+		if restoreErr != nil {
+			log.Printf("Error in restore sanction: %s", restoreErr)
+		}
+		s.SendError(fmt.Sprintf("Не удалось ограничить пользователя %s: %s", user.String(), err), msg)
+		return false
+	}
+	return true
+}
+
+// MuteUser method forbids user to send messages, e.g. /mute @username 2h, without duration mute is permanent
+func (s *Server) MuteUser(msg *tgbotapi.Message) {
+	query, duration, err := sanctionArgs(msg.CommandArguments())
+	if err != nil {
+		s.SendError(err.Error(), msg)
+		return
+	}
+	user := s.sanctionTarget(msg, query)
+	if user == nil {
+		return
+	}
+
+	sanction := newSanction(msg, user, db.SanctionMute, duration)
+	if s.restrict(msg, user, sanction) {
+		s.SendMessage(fmt.Sprintf("Пользователь %s не может писать в чат %s", user.String(), untilText(sanction)), msg.Chat.ID, msg.MessageID)
+	}
+}
+
+// RestrictUser method forbids user to send media or stickers, e.g. /restrict @username media 1d
+func (s *Server) RestrictUser(msg *tgbotapi.Message) {
+	query, duration, err := sanctionArgs(msg.CommandArguments())
+	if err != nil {
+		s.SendError(err.Error(), msg)
+		return
+	}
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		s.SendError("Укажите ограничение: /restrict @username media|stickers [1d]", msg)
+		return
+	}
+	restriction := strings.ToLower(fields[len(fields)-1])
+	if _, ok := restrictions[restriction]; !ok {
+		s.SendError(fmt.Sprintf("Неизвестное ограничение %s, доступны: media, stickers", restriction), msg)
+		return
+	}
+	user := s.sanctionTarget(msg, strings.Join(fields[:len(fields)-1], " "))
+	if user == nil {
+		return
+	}
+
+	sanction := newSanction(msg, user, db.SanctionRestrict, duration)
+	sanction.Restriction = restriction
+	if s.restrict(msg, user, sanction) {
+		s.SendMessage(fmt.Sprintf("Пользователь %s ограничен (%s) %s", user.String(), restriction, untilText(sanction)), msg.Chat.ID, msg.MessageID)
+	}
+}
+
+// UnmuteUser method lifts mute and restrictions of user
+func (s *Server) UnmuteUser(msg *tgbotapi.Message) {
+	user := s.sanctionTarget(msg, msg.CommandArguments())
+	if user == nil {
+		return
+	}
+
+	s.sanctions.Lock()
+	defer s.sanctions.Unlock()
+	for _, kind := range []string{db.SanctionMute, db.SanctionRestrict} {
+		if err := s.DB.DeleteSanction(msg.Chat.ID, user.ID, kind); err != nil && err != db.ErrNotFound {
+			log.Printf("Error in DeleteSanction: %s", err)
+		}
+	}
+	if err := s.applyRestrictions(msg.Chat.ID, user.ID); err != nil {
+		log.Printf("Error in restrictChatMember: %s", err)
+		s.SendError(fmt.Sprintf("Не удалось снять ограничения пользователя %s: %s", user.String(), err), msg)
+		return
+	}
+	s.SendMessage(fmt.Sprintf("С пользователя %s сняты ограничения", user.String()), msg.Chat.ID, msg.MessageID)
+}
+
+// TempBanUser method bans user for duration, e.g. /tempban @username 3d
+func (s *Server) TempBanUser(msg *tgbotapi.Message) {
+	query, duration, err := sanctionArgs(msg.CommandArguments())
+	if err != nil {
+		s.SendError(err.Error(), msg)
+		return
+	}
+	if duration == 0 {
+		s.SendError("Укажите срок бана: /tempban @username 3d", msg)
+		return
+	}
+	user := s.sanctionTarget(msg, query)
+	if user == nil {
+		return
+	}
+
+	s.sanctions.Lock()
+	defer s.sanctions.Unlock()
+	sanction := newSanction(msg, user, db.SanctionBan, duration)
+	if err = s.banMember(msg.Chat.ID, user.ID, sanction.Until); err != nil {
+		log.Printf("Error in banChatMember: %s", err)
+		s.SendError(fmt.Sprintf("Не удалось забанить пользователя %s: %s", user.String(), err), msg)
+		return
+	}
+	if err = s.DB.SaveSanction(sanction); err != nil {
+		log.Printf("Error in SaveSanction: %s", err)
+	}
+	s.SendMessage(fmt.Sprintf("Пользователь %s забанен %s", user.String(), untilText(sanction)), msg.Chat.ID, msg.MessageID)
+}
+
+// SanctionList method sends list of active sanctions in chat
+func (s *Server) SanctionList(msg *tgbotapi.Message) {
+	sanctions, err := s.DB.GetSanctions()
+	if err != nil {
+		log.Printf("Error in GetSanctions: %s", err)
+		return
+	}
+
+	var lines []string
+	for _, sanction := range sanctions {
+		if sanction.ChatID != msg.Chat.ID {
+			continue
+		}
+		line := fmt.Sprintf("%s - %s", s.userByID(sanction.UserID).String(), sanction.Kind)
+		if sanction.Restriction != "" {
+			line += " " + sanction.Restriction
+		}
+		lines = append(lines, line+" "+untilText(sanction))
+	}
+	if len(lines) == 0 {
+		s.SendMessage("Активных ограничений нет", msg.Chat.ID, msg.MessageID)
+		return
+	}
+	s.SendMessage(fmt.Sprintf("Активные ограничения:\n%s", strings.Join(lines, "\n")), msg.Chat.ID, msg.MessageID)
+}
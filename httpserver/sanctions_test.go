@@ -0,0 +1,241 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// newSanctionServer returns Server with fake Bot API and memory store with user @bad
+func newSanctionServer(t *testing.T) (*fakeBotAPI, *Server) {
+	api := newFakeBotAPI(t)
+	s := api.server()
+	s.DB = db.NewMemoryStore()
+	if err := s.DB.SaveUser(&tgbotapi.User{ID: 10, FirstName: "Bad", UserName: "bad"}); err != nil {
+		t.Fatalf("SaveUser returns error: %s", err)
+	}
+	return api, s
+}
+
+// lastRestriction returns permissions and until_date of last restrictChatMember request
+func lastRestriction(t *testing.T, api *fakeBotAPI) (permissions chatPermissions, until string) {
+	calls := api.calls("restrictChatMember")
+	if len(calls) == 0 {
+		t.Fatalf("restrictChatMember is not called")
+	}
+	form := calls[len(calls)-1]
+	if err := json.Unmarshal([]byte(form.Get("permissions")), &permissions); err != nil {
+		t.Fatalf("Bad permissions %q: %s", form.Get("permissions"), err)
+	}
+	return permissions, form.Get("until_date")
+}
+
+// storedSanction returns stored sanction of user 10 in memberChats[0] or nil
+func storedSanction(t *testing.T, store db.Store, kind string) *db.Sanction {
+	sanctions, err := store.GetSanctions()
+	if err != nil {
+		t.Fatalf("GetSanctions returns error: %s", err)
+	}
+	for _, sanction := range sanctions {
+		if sanction.ChatID == memberChats[0].ID && sanction.UserID == 10 && sanction.Kind == kind {
+			return sanction
+		}
+	}
+	return nil
+}
+
+// failDeleteStore is a store which fails to delete sanctions
+type failDeleteStore struct {
+	db.Store
+}
+
+func (s failDeleteStore) DeleteSanction(chatID int64, userID int, kind string) error {
+	return errors.New("disk is full")
+}
+
+func TestMuteOverRestriction(t *testing.T) {
+	api, s := newSanctionServer(t)
+	defer api.Close()
+
+	s.MuteUser(roleCommand(1, "/mute @bad 2h"))
+	mute := storedSanction(t, s.DB, db.SanctionMute)
+	if mute == nil || mute.CreatedBy != 1 {
+		t.Fatalf("Mute is not stored: %+v", mute)
+	}
+	permissions, until := lastRestriction(t, api)
+	if permissions != (chatPermissions{}) || until != strconv.FormatInt(mute.Until, 10) {
+		t.Errorf("Mute sets permissions %+v until %s", permissions, until)
+	}
+
+	// restriction does not weaken mute
+	s.RestrictUser(roleCommand(1, "/restrict @bad media 1d"))
+	restriction := storedSanction(t, s.DB, db.SanctionRestrict)
+	if restriction == nil || restriction.Restriction != "media" {
+		t.Fatalf("Restriction is not stored: %+v", restriction)
+	}
+	permissions, until = lastRestriction(t, api)
+	if permissions != (chatPermissions{}) || until != strconv.FormatInt(mute.Until, 10) {
+		t.Errorf("Restriction over mute sets permissions %+v until %s", permissions, until)
+	}
+
+	// restriction is applied after mute is lifted
+	s.LiftExpiredSanctions(time.Unix(mute.Until, 0))
+	permissions, until = lastRestriction(t, api)
+	if permissions != restrictions["media"] || until != strconv.FormatInt(restriction.Until, 10) {
+		t.Errorf("Lift of mute sets permissions %+v until %s", permissions, until)
+	}
+	if text := api.lastText("sendMessage"); text != "Пользователь bad снова может писать в чат" {
+		t.Errorf("Lift of mute is announced as %q", text)
+	}
+
+	s.LiftExpiredSanctions(time.Unix(restriction.Until, 0))
+	permissions, until = lastRestriction(t, api)
+	if permissions != fullPermissions || until != "" {
+		t.Errorf("Lift of restriction sets permissions %+v until %s", permissions, until)
+	}
+	if sanctions, _ := s.DB.GetSanctions(); len(sanctions) != 0 {
+		t.Errorf("Sanctions are not deleted: %v", sanctions)
+	}
+}
+
+func TestUnmuteUser(t *testing.T) {
+	api, s := newSanctionServer(t)
+	defer api.Close()
+
+	s.MuteUser(roleCommand(1, "/mute @bad"))
+	s.RestrictUser(roleCommand(1, "/restrict @bad stickers"))
+	if mute := storedSanction(t, s.DB, db.SanctionMute); mute == nil || mute.Until != 0 {
+		t.Fatalf("Permanent mute is stored as %+v", mute)
+	}
+
+	s.UnmuteUser(roleCommand(1, "/unmute @bad"))
+	if sanctions, _ := s.DB.GetSanctions(); len(sanctions) != 0 {
+		t.Errorf("Sanctions are not deleted: %v", sanctions)
+	}
+	if permissions, until := lastRestriction(t, api); permissions != fullPermissions || until != "" {
+		t.Errorf("Unmute sets permissions %+v until %s", permissions, until)
+	}
+	if text := api.lastText("sendMessage"); text != "С пользователя bad сняты ограничения" {
+		t.Errorf("Unmute is announced as %q", text)
+	}
+}
+
+func TestSanctionRollback(t *testing.T) {
+	api, s := newSanctionServer(t)
+	defer api.Close()
+	setFail := func(fail bool) {
+		api.Lock()
+		api.fail = fail
+		api.Unlock()
+	}
+
+	// new sanction is deleted if Telegram fails
+	setFail(true)
+	s.MuteUser(roleCommand(1, "/mute @bad 2h"))
+	s.RestrictUser(roleCommand(1, "/restrict @bad media"))
+	s.TempBanUser(roleCommand(1, "/tempban @bad 1d"))
+	if sanctions, _ := s.DB.GetSanctions(); len(sanctions) != 0 {
+		t.Errorf("Sanctions are stored after error of Telegram: %v", sanctions)
+	}
+
+	// previous sanction of the same kind is restored
+	setFail(false)
+	s.MuteUser(roleCommand(1, "/mute @bad 2h"))
+	previous := storedSanction(t, s.DB, db.SanctionMute)
+	if previous == nil {
+		t.Fatalf("Mute is not stored")
+	}
+	setFail(true)
+	s.MuteUser(roleCommand(1, "/mute @bad 1d"))
+	if mute := storedSanction(t, s.DB, db.SanctionMute); mute == nil || *mute != *previous {
+		t.Errorf("Mute is %+v after error of Telegram, expected %+v", mute, previous)
+	}
+}
+
+func TestLiftExpiredSanctions(t *testing.T) {
+	now := time.Now()
+	store := db.NewMemoryStore()
+	store.SaveUser(&tgbotapi.User{ID: 10, FirstName: "Bad", UserName: "bad"})
+	// sanctions are expired while bot was stopped
+	sanctions := []*db.Sanction{
+		{ChatID: -5, UserID: 10, Kind: db.SanctionBan, Until: now.Add(-time.Hour).Unix()},
+		{ChatID: -5, UserID: 11, Kind: db.SanctionMute, Until: now.Add(-time.Minute).Unix()},
+		{ChatID: -5, UserID: 12, Kind: db.SanctionRestrict, Restriction: "media", Until: now.Add(time.Hour).Unix()},
+		{ChatID: -5, UserID: 13, Kind: db.SanctionMute},
+	}
+	for _, sanction := range sanctions {
+		store.SaveSanction(sanction)
+	}
+
+	// deleted sanction is lifted on next check only
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	s := api.server()
+	s.DB = failDeleteStore{store}
+	s.LiftExpiredSanctions(now)
+	if api.total() != 0 {
+		t.Errorf("Sanctions are lifted without delete from storage")
+	}
+
+	s.DB = store
+	s.LiftExpiredSanctions(now)
+	if unban := api.calls("unbanChatMember"); len(unban) != 1 || unban[0].Get("user_id") != "10" || unban[0].Get("only_if_banned") != "true" {
+		t.Errorf("Unexpected unbanChatMember requests: %v", unban)
+	}
+	if restrict := api.calls("restrictChatMember"); len(restrict) != 1 || restrict[0].Get("user_id") != "11" {
+		t.Errorf("Unexpected restrictChatMember requests: %v", restrict)
+	}
+	texts := api.texts("sendMessage")
+	expected := []string{"Срок бана пользователя bad истек, теперь можно вернуться в чат", "Пользователь 11 снова может писать в чат"}
+	if strings.Join(texts, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Lifts are announced as %q", texts)
+	}
+	if left, _ := store.GetSanctions(); len(left) != 2 || *left[0] != *sanctions[2] || *left[1] != *sanctions[3] {
+		t.Errorf("Unexpected sanctions after lift: %v", left)
+	}
+}
+
+func TestStartSanctions(t *testing.T) {
+	api, s := newSanctionServer(t)
+	defer api.Close()
+	s.DB.SaveSanction(&db.Sanction{ChatID: -5, UserID: 10, Kind: db.SanctionBan, Until: time.Now().Add(-time.Hour).Unix()})
+
+	// scheduler is started once and lifts expired sanctions at once
+	s.StartSanctions()
+	s.StartSanctions()
+	deadline := time.Now().Add(time.Second * 5)
+	for len(api.calls("sendMessage")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if unban := api.calls("unbanChatMember"); len(unban) != 1 {
+		t.Errorf("unbanChatMember is called %d times", len(unban))
+	}
+	if sanctions, _ := s.DB.GetSanctions(); len(sanctions) != 0 {
+		t.Errorf("Expired sanction is not deleted: %v", sanctions)
+	}
+}
+
+func TestLiftedText(t *testing.T) {
+	user := &tgbotapi.User{ID: 10, FirstName: "Bad", LastName: "User"}
+	tests := []struct {
+		sanction db.Sanction
+		text     string
+	}{
+		{db.Sanction{Kind: db.SanctionBan}, "Срок бана пользователя Bad User истек, теперь можно вернуться в чат"},
+		{db.Sanction{Kind: db.SanctionMute}, "Пользователь Bad User снова может писать в чат"},
+		{db.Sanction{Kind: db.SanctionRestrict, Restriction: "stickers"}, "С пользователя Bad User сняты ограничения (stickers)"},
+	}
+	for _, test := range tests {
+		if text := liftedText(&test.sanction, user); text != test.text {
+			t.Errorf("liftedText of %s is %q, expected %q", test.sanction.Kind, text, test.text)
+		}
+	}
+}
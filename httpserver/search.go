@@ -0,0 +1,117 @@
+package httpserver
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	searchCallbackPrefix = "search"
+	botSearchPageSize    = 5
+)
+
+// SearchMessages method replies to /search command with first page of matched messages of current chat
+func (s *Server) SearchMessages(msg *tgbotapi.Message) {
+	query := strings.TrimSpace(msg.CommandArguments())
+	if query == "" {
+		s.SendError("Укажите слова для поиска: /search слова", msg)
+		return
+	}
+	if s.Search == nil {
+		s.SendError("Поиск отключен", msg)
+		return
+	}
+
+	text, markup, err := s.botSearchPage(msg.Chat.ID, query, 0)
+	if err != nil {
+		log.Printf("Error in search %q in chat %d: %s", query, msg.Chat.ID, err)
+		s.SendError("Не удалось выполнить поиск", msg)
+		return
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ParseMode = tgbotapi.ModeHTML
+	reply.DisableWebPagePreview = true
+	reply.ReplyToMessageID = msg.MessageID
+	if markup != nil {
+		reply.ReplyMarkup = markup
+	}
+	if _, err = s.Bot.Send(reply); err != nil {
+		log.Printf("Error: %s", err.Error())
+	}
+}
+
+// SearchCallback method shows another page of search results in the same message.
+// Query is taken from /search command, because results message is a reply to it
+// and callback data is too short for long queries.
+func (s *Server) SearchCallback(query *tgbotapi.CallbackQuery) {
+	defer s.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	parts := strings.SplitN(query.Data, ":", 2)
+	if len(parts) != 2 || query.Message.ReplyToMessage == nil || s.Search == nil {
+		return
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil || page < 0 {
+		return
+	}
+
+	chatID := query.Message.Chat.ID
+	words := strings.TrimSpace(query.Message.ReplyToMessage.CommandArguments())
+	text, markup, err := s.botSearchPage(chatID, words, page)
+	if err != nil {
+		log.Printf("Error in search %q in chat %d: %s", words, chatID, err)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, text)
+	edit.ParseMode = tgbotapi.ModeHTML
+	edit.DisableWebPagePreview = true
+	edit.ReplyMarkup = markup
+	if _, err = s.Bot.Send(edit); err != nil {
+		log.Printf("Error: %s", err.Error())
+	}
+}
+
+// botSearchPage returns HTML text and navigation keyboard for page of search results
+func (s *Server) botSearchPage(chatID int64, query string, page int) (text string, markup *tgbotapi.InlineKeyboardMarkup, err error) {
+	result, err := s.Search.Search(chatID, query, page*botSearchPageSize, botSearchPageSize)
+	if err != nil {
+		return
+	}
+	if result.Total == 0 {
+		return fmt.Sprintf("По запросу «%s» ничего не найдено", html.EscapeString(query)), nil, nil
+	}
+
+	lines := []string{fmt.Sprintf("Найдено сообщений: %d, страница %d из %d",
+		result.Total, page+1, (result.Total+botSearchPageSize-1)/botSearchPageSize)}
+	for _, hit := range result.Hits {
+		lt := time.Unix(int64(hit.Date), 0)
+		date := lt.Format("2006-01-02 15:04:05")
+		if s.WebURL != "" {
+			dayLink := fmt.Sprintf("%s/chat/%d/%d/%d/%d#%s", s.WebURL, chatID, lt.Year(), lt.Month(), lt.Day(), lt.Format("15:04:05"))
+			date = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(dayLink), date)
+		}
+		lines = append(lines, fmt.Sprintf("\n%s %s\n%s", date, html.EscapeString(hit.Sender), hit.HighlightedSnippet("<b>", "</b>")))
+	}
+	text = strings.Join(lines, "\n")
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("« Назад", fmt.Sprintf("%s:%d", searchCallbackPrefix, page-1)))
+	}
+	if (page+1)*botSearchPageSize < result.Total {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("Далее »", fmt.Sprintf("%s:%d", searchCallbackPrefix, page+1)))
+	}
+	if len(buttons) > 0 {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+		markup = &keyboard
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/search"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// stubIndex is a search index with total count of generated hits for any query
+type stubIndex struct {
+	sync.Mutex
+	total int
+	date  int
+	fail  bool
+	// queries are received queries
+	queries []string
+}
+
+func (index *stubIndex) Add(msg *tgbotapi.Message) error {
+	return nil
+}
+
+func (index *stubIndex) Search(chatID int64, query string, offset, limit int) (*search.Result, error) {
+	index.Lock()
+	defer index.Unlock()
+	index.queries = append(index.queries, query)
+	if index.fail {
+		return nil, errors.New("index is broken")
+	}
+	result := &search.Result{Total: index.total}
+	for i := offset; i < offset+limit && i < index.total; i++ {
+		result.Hits = append(result.Hits, search.Hit{
+			ChatID:    chatID,
+			MessageID: index.total - i,
+			Date:      index.date,
+			Sender:    "Eve <eve>",
+			Snippet:   "a " + search.MarkStart + "<x>" + search.MarkEnd,
+		})
+	}
+	return result, nil
+}
+
+func (index *stubIndex) Reset() error {
+	return nil
+}
+
+func (index *stubIndex) Close() error {
+	return nil
+}
+
+// keyboardData returns callback data of keyboard buttons
+func keyboardData(markup *tgbotapi.InlineKeyboardMarkup) (data []string) {
+	if markup == nil {
+		return
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			data = append(data, *button.CallbackData)
+		}
+	}
+	return
+}
+
+func TestBotSearchPage(t *testing.T) {
+	date := int(time.Date(2017, 5, 2, 9, 5, 7, 0, time.Local).Unix())
+	s := &Server{Search: &stubIndex{total: 12, date: date}, WebURL: "http://logs.example.com"}
+
+	tests := []struct {
+		page     int
+		header   string
+		hits     int
+		keyboard string
+	}{
+		{0, "Найдено сообщений: 12, страница 1 из 3", 5, "search:1"},
+		{1, "Найдено сообщений: 12, страница 2 из 3", 5, "search:0 search:2"},
+		{2, "Найдено сообщений: 12, страница 3 из 3", 2, "search:1"},
+	}
+	for _, test := range tests {
+		text, markup, err := s.botSearchPage(-5, "x", test.page)
+		if err != nil {
+			t.Fatalf("Page %d: %s", test.page, err)
+		}
+		if !strings.HasPrefix(text, test.header) {
+			t.Errorf("Page %d: bad header of %s", test.page, text)
+		}
+		if count := strings.Count(text, "<b>&lt;x&gt;</b>"); count != test.hits {
+			t.Errorf("Page %d: %d escaped hits, expected %d: %s", test.page, count, test.hits, text)
+		}
+		if keyboard := strings.Join(keyboardData(markup), " "); keyboard != test.keyboard {
+			t.Errorf("Page %d: keyboard %q, expected %q", test.page, keyboard, test.keyboard)
+		}
+	}
+
+	// link goes to message anchor of day page, the same as on site
+	text, _, _ := s.botSearchPage(-5, "x", 0)
+	link := `<a href="http://logs.example.com/chat/-5/2017/5/2#09:05:07">2017-05-02 09:05:07</a> Eve &lt;eve&gt;`
+	if !strings.Contains(text, link) {
+		t.Errorf("No day link %s in %s", link, text)
+	}
+	if s.WebURL+dayLink(-5, date) != "http://logs.example.com/chat/-5/2017/5/2#09:05:07" {
+		t.Errorf("Day link differs from site one: %s", dayLink(-5, date))
+	}
+	s.WebURL = ""
+	if text, _, _ = s.botSearchPage(-5, "x", 0); strings.Contains(text, "<a ") {
+		t.Errorf("Link without web url: %s", text)
+	}
+
+	// single page has no keyboard
+	s.Search = &stubIndex{total: 5, date: date}
+	if _, markup, _ := s.botSearchPage(-5, "x", 0); markup != nil {
+		t.Errorf("Single page has keyboard %v", keyboardData(markup))
+	}
+	s.Search = &stubIndex{}
+	text, markup, err := s.botSearchPage(-5, "<кот>", 0)
+	if err != nil || markup != nil || text != "По запросу «&lt;кот&gt;» ничего не найдено" {
+		t.Errorf("Empty result is %q, %v, %v", text, markup, err)
+	}
+	s.Search = &stubIndex{fail: true}
+	if _, _, err = s.botSearchPage(-5, "x", 0); err == nil {
+		t.Errorf("Error of index is ignored")
+	}
+}
+
+func TestSearchCallback(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	index := &stubIndex{total: 12, date: 1500000000}
+	s := api.server()
+	s.Search = index
+
+	chat := memberChats[0]
+	command := &tgbotapi.Message{MessageID: 10, Chat: chat, Text: "/search кот дома",
+		Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 7}}}
+	results := &tgbotapi.Message{MessageID: 11, Chat: chat, ReplyToMessage: command}
+
+	s.CallbackHandler(&tgbotapi.CallbackQuery{ID: "1", Message: results, Data: "search:2"})
+	edits := api.calls("editMessageText")
+	if len(edits) != 1 {
+		t.Fatalf("%d edits of results message", len(edits))
+	}
+	if edit := edits[0]; edit.Get("message_id") != "11" || edit.Get("parse_mode") != tgbotapi.ModeHTML ||
+		!strings.HasPrefix(edit.Get("text"), "Найдено сообщений: 12, страница 3 из 3") {
+		t.Errorf("Bad edit %v", edit)
+	}
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(edits[0].Get("reply_markup")), &markup); err != nil {
+		t.Fatal(err)
+	}
+	if keyboard := strings.Join(keyboardData(&markup), " "); keyboard != "search:1" {
+		t.Errorf("Keyboard of last page is %q", keyboard)
+	}
+	if len(index.queries) != 1 || index.queries[0] != "кот дома" {
+		t.Errorf("Query is not taken from command: %q", index.queries)
+	}
+	if len(api.calls("answerCallbackQuery")) != 1 {
+		t.Errorf("Callback is not answered")
+	}
+
+	// bad pages and results without command are ignored, but answered
+	for _, query := range []*tgbotapi.CallbackQuery{
+		{ID: "2", Message: results, Data: "search:-1"},
+		{ID: "3", Message: results, Data: "search:x"},
+		{ID: "4", Message: &tgbotapi.Message{MessageID: 12, Chat: chat}, Data: "search:1"},
+	} {
+		s.CallbackHandler(query)
+	}
+	if len(api.calls("editMessageText")) != 1 || len(api.calls("answerCallbackQuery")) != 4 {
+		t.Errorf("Bad callbacks: %d edits, %d answers", len(api.calls("editMessageText")), len(api.calls("answerCallbackQuery")))
+	}
+}
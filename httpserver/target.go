@@ -0,0 +1,168 @@
+package httpserver
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	targetCallbackPrefix = "target"
+	maxTargetChoices     = 10
+)
+
+// targetKey is a command message with chosen target
+type targetKey struct {
+	chatID    int64
+	messageID int
+}
+
+// targetChoices keeps target users chosen with buttons until command is run again
+type targetChoices struct {
+	sync.Mutex
+	chosen map[targetKey]int
+}
+
+// resolveTarget method finds target user of command. Target is a user chosen with buttons, user of text_mention
+// entity in query, numeric user ID, @username or first and last name. Author of replied message is a target
+// if query is empty. Returns nil and sends error or buttons for choice between several users if target is not found.
+func (s *Server) resolveTarget(msg *tgbotapi.Message, query string) *tgbotapi.User {
+	query = strings.TrimSpace(query)
+	if userID, ok := s.takeChosenTarget(msg); ok {
+		return s.userByID(userID)
+	}
+	if user := mentionedUser(msg, query); user != nil {
+		return user
+	}
+	if query == "" {
+		if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil {
+			return msg.ReplyToMessage.From
+		}
+		s.SendError("Укажите пользователя: @username, имя, ID или ответьте командой на его сообщение", msg)
+		return nil
+	}
+	if userID, err := strconv.Atoi(query); err == nil && userID > 0 {
+		return s.userByID(userID)
+	}
+
+	user, err := s.DB.GetUser(query)
+	if many, ok := err.(*db.ManyUsersError); ok {
+		s.sendTargetChoice(msg, query, many.Users)
+		return nil
+	}
+	if _, notFound := err.(*db.UserNotFoundError); err != nil && !notFound {
+		s.SendError(fmt.Sprintf("Произошла неизвестная ошибка при поиске пользователя: %s", err.Error()), msg)
+		return nil
+	}
+	if user == nil {
+		s.SendError(fmt.Sprintf("Пользователь %s не найден", query), msg)
+	}
+	return user
+}
+
+// userByID method returns known user or user with ID only, Telegram accepts IDs of unknown users
+func (s *Server) userByID(userID int) *tgbotapi.User {
+	user, err := s.DB.GetUserByID(userID)
+	if err != nil {
+		if err != db.ErrNotFound {
+			log.Printf("Error in GetUserByID: %s", err)
+		}
+		return &tgbotapi.User{ID: userID, FirstName: strconv.Itoa(userID)}
+	}
+	return user
+}
+
+// mentionedUser function returns user of text_mention entity inside of query, users without username are mentioned so
+func mentionedUser(msg *tgbotapi.Message, query string) *tgbotapi.User {
+	if msg.Entities == nil || query == "" {
+		return nil
+	}
+	text := toUTF16(msg.Text)
+	for _, e := range *msg.Entities {
+		if e.Type != "text_mention" || e.User == nil || e.Offset < 0 || e.Offset+e.Length > len(text) {
+			continue
+		}
+		if strings.Contains(query, text.substring(e.Offset, e.Offset+e.Length)) {
+			return e.User
+		}
+	}
+	return nil
+}
+
+// sendTargetChoice method replies to command with buttons for choice of target user
+func (s *Server) sendTargetChoice(msg *tgbotapi.Message, query string, users []*tgbotapi.User) {
+	if len(users) > maxTargetChoices {
+		s.SendError(fmt.Sprintf("Найдено %d пользователей %s, уточните запрос или укажите ID", len(users), query), msg)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, user := range users {
+		label := fmt.Sprintf("%s (%d)", user.String(), user.ID)
+		data := fmt.Sprintf("%s:%d", targetCallbackPrefix, user.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, data)))
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Найдено несколько пользователей %s, выберите:", query))
+	reply.ReplyToMessageID = msg.MessageID
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := s.Bot.Send(reply); err != nil {
+		log.Printf("Error: %s", err.Error())
+	}
+}
+
+// TargetCallback method runs command again with target user chosen by button.
+// Command is taken from message with buttons, because it is a reply to command.
+func (s *Server) TargetCallback(query *tgbotapi.CallbackQuery) {
+	command := query.Message.ReplyToMessage
+	parts := strings.SplitN(query.Data, ":", 2)
+	if len(parts) != 2 || command == nil || command.From == nil {
+		s.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	if query.From.ID != command.From.ID {
+		s.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Выбрать может только автор команды"))
+		return
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		s.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	s.Bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	user := s.userByID(userID)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, fmt.Sprintf("Выбран пользователь %s (%d)", user.String(), user.ID))
+	if _, err = s.Bot.Send(edit); err != nil {
+		log.Printf("Error: %s", err.Error())
+	}
+
+	key := targetKey{chatID: command.Chat.ID, messageID: command.MessageID}
+	s.targets.Lock()
+	if s.targets.chosen == nil {
+		s.targets.chosen = make(map[targetKey]int)
+	}
+	s.targets.chosen[key] = userID
+	s.targets.Unlock()
+	s.CommandHandler(command)
+
+	// command may stop before target resolving, e.g. without role
+	s.takeChosenTarget(command)
+}
+
+// takeChosenTarget method returns and forgets target user chosen for command
+func (s *Server) takeChosenTarget(msg *tgbotapi.Message) (userID int, ok bool) {
+	key := targetKey{chatID: msg.Chat.ID, messageID: msg.MessageID}
+	s.targets.Lock()
+	defer s.targets.Unlock()
+	if userID, ok = s.targets.chosen[key]; ok {
+		delete(s.targets.chosen, key)
+	}
+	return
+}
@@ -0,0 +1,171 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// targetUsers are known users for target resolving, user 20 has name which looks like ID of user 11
+var targetUsers = []*tgbotapi.User{
+	{ID: 10, FirstName: "Ivan"},
+	{ID: 11, FirstName: "Ivan", LastName: "Petrov"},
+	{ID: 12, FirstName: "Петя", UserName: "petya"},
+	{ID: 20, FirstName: "11"},
+}
+
+// newTargetServer returns Server with fake Bot API and memory store with targetUsers
+func newTargetServer(t *testing.T) (*fakeBotAPI, *Server) {
+	api := newFakeBotAPI(t)
+	s := api.server()
+	s.DB = db.NewMemoryStore()
+	for _, user := range targetUsers {
+		if err := s.DB.SaveUser(user); err != nil {
+			t.Fatalf("SaveUser returns error: %s", err)
+		}
+	}
+	return api, s
+}
+
+// withMention adds text_mention entity of user to first occurrence of text in message
+func withMention(msg *tgbotapi.Message, text string, user *tgbotapi.User) *tgbotapi.Message {
+	offset := len(toUTF16(msg.Text[:strings.Index(msg.Text, text)]))
+	*msg.Entities = append(*msg.Entities, tgbotapi.MessageEntity{Type: "text_mention", Offset: offset, Length: len(toUTF16(text)), User: user})
+	return msg
+}
+
+func TestResolveTarget(t *testing.T) {
+	vasya := &tgbotapi.User{ID: 13, FirstName: "Вася"}
+	reply := roleCommand(1, "/warn")
+	reply.ReplyToMessage = &tgbotapi.Message{MessageID: 99, From: &tgbotapi.User{ID: 14}}
+
+	tests := []struct {
+		name   string
+		msg    *tgbotapi.Message
+		chosen int
+		target int
+		error  string
+	}{
+		{"chosen button before mention", withMention(roleCommand(1, "/warn 10 Вася"), "Вася", vasya), 12, 12, ""},
+		{"chosen button before name", roleCommand(1, "/warn Ivan"), 11, 11, ""},
+		{"text_mention before ID", withMention(roleCommand(1, "/warn 10"), "10", vasya), 0, 13, ""},
+		{"text_mention before name", withMention(roleCommand(1, "/warn Ivan"), "Ivan", vasya), 0, 13, ""},
+		{"text_mention after emoji", withMention(roleCommand(1, "/warn 😀Вася"), "Вася", vasya), 0, 13, ""},
+		{"ID before name", roleCommand(1, "/warn 11"), 0, 11, ""},
+		{"unknown ID", roleCommand(1, "/warn 999"), 0, 999, ""},
+		{"username", roleCommand(1, "/warn @petya"), 0, 12, ""},
+		{"first and last name", roleCommand(1, "/warn Ivan Petrov"), 0, 11, ""},
+		{"author of replied message", reply, 0, 14, ""},
+		{"no target", roleCommand(1, "/warn"), 0, 0, "Укажите пользователя"},
+		{"unknown name", roleCommand(1, "/warn nobody"), 0, 0, "Пользователь nobody не найден"},
+	}
+	for _, test := range tests {
+		api, s := newTargetServer(t)
+		if test.chosen != 0 {
+			s.targets.chosen = map[targetKey]int{{chatID: test.msg.Chat.ID, messageID: test.msg.MessageID}: test.chosen}
+		}
+
+		user := s.resolveTarget(test.msg, test.msg.CommandArguments())
+		if test.target == 0 {
+			if user != nil {
+				t.Errorf("%s: target is user %d, expected none", test.name, user.ID)
+			}
+			if text := api.lastText("sendMessage"); !strings.Contains(text, test.error) {
+				t.Errorf("%s: error %q, expected %q", test.name, text, test.error)
+			}
+		} else {
+			if user == nil || user.ID != test.target {
+				t.Errorf("%s: target is %+v, expected user %d", test.name, user, test.target)
+			}
+			if text := api.lastText("sendMessage"); text != "" {
+				t.Errorf("%s: unexpected message %q", test.name, text)
+			}
+		}
+		if len(s.targets.chosen) != 0 {
+			t.Errorf("%s: chosen target is not forgotten", test.name)
+		}
+		api.Close()
+	}
+}
+
+func TestTargetChoice(t *testing.T) {
+	api, s := newTargetServer(t)
+	defer api.Close()
+
+	if user := s.resolveTarget(roleCommand(1, "/warn Ivan"), "Ivan"); user != nil {
+		t.Fatalf("Target is user %d, expected choice", user.ID)
+	}
+	calls := api.calls("sendMessage")
+	if len(calls) != 1 {
+		t.Fatalf("%d messages are sent, expected choice", len(calls))
+	}
+	form := calls[0]
+	if form.Get("reply_to_message_id") != "100" || !strings.Contains(form.Get("text"), "выберите") {
+		t.Errorf("Choice is not a reply to command: %v", form)
+	}
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(form.Get("reply_markup")), &markup); err != nil {
+		t.Fatalf("Bad keyboard of choice: %s", err)
+	}
+	data := keyboardData(&markup)
+	if strings.Join(data, " ") != "target:10 target:11" {
+		t.Errorf("Buttons %v, expected users 10 and 11", data)
+	}
+
+	// too many users are not shown as buttons
+	for i := 0; i <= maxTargetChoices; i++ {
+		s.DB.SaveUser(&tgbotapi.User{ID: 100 + i, FirstName: "Many"})
+	}
+	s.resolveTarget(roleCommand(1, "/warn Many"), "Many")
+	form = api.calls("sendMessage")[1]
+	if form.Get("reply_markup") != "" || form.Get("text") != fmt.Sprintf("Найдено %d пользователей Many, уточните запрос или укажите ID", maxTargetChoices+1) {
+		t.Errorf("Unexpected reply for many users: %v", form)
+	}
+}
+
+func TestTargetCallback(t *testing.T) {
+	api, s := newTargetServer(t)
+	defer api.Close()
+	chatID := memberChats[0].ID
+	s.DB.SaveChatRole(&db.ChatRole{ChatID: chatID, UserID: 1, Role: RoleModerator.String()})
+
+	command := roleCommand(1, "/warn Ivan")
+	s.CommandHandler(command)
+	if len(api.calls("sendMessage")) != 1 {
+		t.Fatalf("Choice is not sent: %v", api.texts("sendMessage"))
+	}
+	choice := &tgbotapi.Message{MessageID: 101, Chat: memberChats[0], ReplyToMessage: command}
+
+	warnLevel := func(userID int) int {
+		level, err := s.DB.GetWarnLevel(&tgbotapi.User{ID: userID})
+		if err != nil && err != db.ErrNotFound {
+			t.Fatalf("GetWarnLevel returns error: %s", err)
+		}
+		return level
+	}
+
+	// only author of command can choose
+	s.CallbackHandler(&tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: 2}, Message: choice, Data: "target:11"})
+	if answer := api.calls("answerCallbackQuery"); len(answer) != 1 || answer[0].Get("text") != "Выбрать может только автор команды" {
+		t.Errorf("Unexpected answer to other user: %v", answer)
+	}
+	if len(api.calls("editMessageText")) != 0 || warnLevel(11) != 0 || len(s.targets.chosen) != 0 {
+		t.Errorf("Target is chosen by other user")
+	}
+
+	s.CallbackHandler(&tgbotapi.CallbackQuery{ID: "2", From: &tgbotapi.User{ID: 1}, Message: choice, Data: "target:11"})
+	if text := api.lastText("editMessageText"); text != "Выбран пользователь Ivan Petrov (11)" {
+		t.Errorf("Choice is edited to %q", text)
+	}
+	if warnLevel(11) != 1 || warnLevel(10) != 0 {
+		t.Errorf("Warn levels are %d and %d, expected chosen user 11 to be warned", warnLevel(10), warnLevel(11))
+	}
+	if len(s.targets.chosen) != 0 {
+		t.Errorf("Chosen target is not forgotten after command")
+	}
+}
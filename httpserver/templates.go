@@ -0,0 +1,255 @@
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// layoutTemplate is a name of base layout, pages define "title" and "content" blocks for it
+const layoutTemplate = "layout.html"
+
+// defaultTemplates are built-in templates, every one of them may be overridden
+// by file with the same name in Server.TemplatesDir
+var defaultTemplates = map[string]string{
+	layoutTemplate: `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8" />
+	<title>{{block "title" .}}Telegram logs{{end}}</title>
+	<style type="text/css">
+		TH {
+			background: #FFFFFF;
+			color: white;
+		}
+		TD {
+			vertical-align: top;
+		}
+		TR.even {
+			background: #F0F4F7;
+		}
+		P.reply {
+			color: grey;
+		}
+		P.edited {
+			color: grey;
+			font-size: small;
+		}
+		SPAN.meta {
+			color: grey;
+			font-size: small;
+		}
+	</style>
+</head>
+<body>
+	<h2><a href="/">Telegram logs</a></h2>
+	{{template "content" .}}
+</body>
+</html>`,
+
+	"main.html": `{{define "content"}}
+	<p>{{if .UserID}}<a href="/logout">Logout</a>{{else}}<a href="/login">Login</a> for see your chats{{end}}</p>
+	<table border="0"><caption>Chats</caption>
+	{{range $i, $chat := .Chats}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la"><a href="/chat/{{$chat.ID}}/">{{$chat.Name}}</a></td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}`,
+
+	"chat.html": `{{define "content"}}
+	{{template "searchform" .}}
+	<table border="0"><caption>Years</caption>
+	{{range $i, $year := .Years}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la"><a href="/chat/{{$.ChatID}}/{{$year}}">{{$year}}</a></td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}`,
+
+	"year.html": `{{define "content"}}
+	<table border="0"><caption>Months</caption>
+	{{range $i, $month := .Months}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la"><a href="/chat/{{$.ChatID}}/{{$.Year}}/{{printf "%d" $month}}">{{$month}}</a></td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}`,
+
+	"month.html": `{{define "content"}}
+	<table border="0"><caption>Dates</caption>
+	{{range $i, $day := .Days}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la"><a href="/chat/{{$.ChatID}}/{{$.Year}}/{{$.Month}}/{{$day}}">{{printf "%02d" $day}}</a></td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}`,
+
+	"day.html": `{{define "content"}}
+	<table border="0"><caption>Messages</caption>
+	{{range $i, $msg := .Messages}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la" align="center" width="3%"><img src="/{{$msg.Photo}}" height="30px" width="30px" /></td>
+			<td class="la" align="center" width="5%"><a id="{{$msg.Time}}" name="{{$msg.Time}}" href="#{{$msg.Time}}" class="time">{{$msg.Time}}</a></td>
+			<td class="la" width="17%"><strong>{{$msg.Author}}</strong></td>
+			<td class="la">
+				{{if $msg.Reply}}<p class="reply"> <a href="{{$msg.Reply.Link}}">&gt;</a> {{$msg.Reply.Text}}</p><p>{{$msg.Text}}</p>{{else}}{{$msg.Text}}{{end}}
+				{{range $msg.Attachments}}{{template "attachment" .}}{{end}}
+				{{if $msg.Caption}}<p class="caption">{{$msg.Caption}}</p>{{end}}
+				{{if $msg.EditDate}}<p class="edited"><a href="{{$msg.HistoryLink}}">edited {{$msg.EditDate}}</a></p>{{end}}
+			</td>
+			<td style="display:none;">{{$msg.ID}}</td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}
+{{define "attachment"}}
+	{{if eq .Kind "photo"}}<p><a href="/{{.URL}}"><img src="/{{or .Thumb .URL}}" loading="lazy" /></a>{{template "meta" .}}</p>
+	{{else if eq .Kind "sticker"}}<p><img src="/{{or .Thumb .URL}}" alt="{{.Name}}" loading="lazy" /></p>
+	{{else if eq .Kind "audio"}}<p><a href="/{{.URL}}">{{or .Name "Audio in message"}}</a>{{template "meta" .}}</p>
+	{{else if eq .Kind "document"}}<p>{{if .Thumb}}<a href="/{{.URL}}"><img src="/{{.Thumb}}" loading="lazy" /></a><br />{{end}}<a href="/{{.URL}}">{{or .Name "Document in message"}}</a>{{template "meta" .}}</p>
+	{{else if eq .Kind "video"}}<p>{{if .Thumb}}<a href="/{{.URL}}"><img src="/{{.Thumb}}" loading="lazy" /></a><br />{{end}}<a href="/{{.URL}}">Video in message</a>{{template "meta" .}}</p>
+	{{else if eq .Kind "voice"}}<p><a href="/{{.URL}}">Voice in message</a>{{template "meta" .}}</p>
+	{{end}}
+{{end}}
+{{define "meta"}}{{if or .Duration .Size}} <span class="meta">{{.Duration}}{{if and .Duration .Size}}, {{end}}{{.Size}}</span>{{end}}{{end}}`,
+
+	"history.html": `{{define "content"}}
+	<table border="0"><caption>Message history</caption>
+	{{range $i, $rev := .Revisions}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la" width="15%"><a href="{{$rev.DayLink}}">{{$rev.Date}}</a></td>
+			<td class="la">{{$rev.Text}}{{if $rev.Caption}}<p>{{$rev.Caption}}</p>{{end}}</td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}`,
+
+	"search.html": `{{define "content"}}
+	{{template "searchform" .}}
+	{{if not .Enabled}}<p>Search is disabled</p>
+	{{else if .Failed}}<p>Search failed</p>
+	{{else if .Query}}
+	<table border="0"><caption>Found {{.Total}} messages</caption>
+	{{range $i, $hit := .Hits}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la" width="15%"><a href="{{$hit.DayLink}}">{{$hit.Date}}</a></td>
+			<td class="la" width="15%">{{$hit.Sender}}</td>
+			<td class="la">{{$hit.Snippet}}</td>
+		</tr>
+	{{end}}
+	</table>
+	<p>
+		{{if .PrevPage}}<a href="/chat/{{.ChatID}}/search?q={{.Query}}&amp;page={{.PrevPage}}">&larr; Newer</a>{{end}}
+		{{if .NextPage}}<a href="/chat/{{.ChatID}}/search?q={{.Query}}&amp;page={{.NextPage}}">Older &rarr;</a>{{end}}
+	</p>
+	{{end}}
+{{end}}`,
+
+	"user.html": `{{define "content"}}
+	<p><strong>{{.Name}}</strong>{{if .UserName}} @{{.UserName}}{{end}}</p>
+	<table border="0"><caption>Chats</caption>
+	{{range $i, $chat := .Chats}}
+		<tr{{if even $i}} class="even"{{end}}>
+			<td class="la"><a href="/chat/{{$chat.ID}}/">{{$chat.Name}}</a></td>
+			<td class="la" width="15%">{{$chat.Messages}} messages</td>
+			<td class="la" width="15%"><a href="{{$chat.LastLink}}">{{$chat.LastDate}}</a></td>
+		</tr>
+	{{end}}
+	</table>
+{{end}}`,
+
+	"login.html": `{{define "content"}}
+	{{if .UserID}}<p>You are logged in. <a href="/logout">Logout</a></p>
+	{{else}}<script async src="https://telegram.org/js/telegram-widget.js?22" data-telegram-login="{{.BotName}}" data-size="large" data-auth-url="{{.AuthURL}}" data-request-access="read"></script>
+	{{end}}
+{{end}}`,
+
+	"searchform.html": `{{define "searchform"}}
+	<form action="/chat/{{.ChatID}}/search" method="get">
+		<input type="text" name="q" value="{{.Query}}" />
+		<input type="submit" value="Search" />
+	</form>
+{{end}}`,
+}
+
+// pageTemplates are page templates with list of partial templates which they use
+var pageTemplates = map[string][]string{
+	"main.html":    nil,
+	"chat.html":    {"searchform.html"},
+	"year.html":    nil,
+	"month.html":   nil,
+	"day.html":     nil,
+	"history.html": nil,
+	"search.html":  {"searchform.html"},
+	"user.html":    nil,
+	"login.html":   nil,
+}
+
+var templateFuncs = template.FuncMap{
+	"even": func(i int) bool { return i%2 == 0 },
+}
+
+// LoadTemplates method parses page templates, templates from TemplatesDir replace built-in ones
+func (s *Server) LoadTemplates() (err error) {
+	templates := make(map[string]*template.Template)
+	for page, partials := range pageTemplates {
+		t := template.New(layoutTemplate).Funcs(templateFuncs)
+		for _, name := range append([]string{layoutTemplate, page}, partials...) {
+			var text string
+			if text, err = s.templateText(name); err != nil {
+				return
+			}
+			if _, err = t.Parse(text); err != nil {
+				return fmt.Errorf("Cannot parse template %s: %s", name, err)
+			}
+		}
+		templates[page] = t
+	}
+	s.templates = templates
+	return
+}
+
+// templateText returns text of template from TemplatesDir or built-in one
+func (s *Server) templateText(name string) (string, error) {
+	if s.TemplatesDir != "" {
+		data, err := ioutil.ReadFile(filepath.Join(s.TemplatesDir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("Cannot read template %s: %s", name, err)
+		}
+	}
+	return defaultTemplates[name], nil
+}
+
+// render executes page template with data and writes it to response
+func (s *Server) render(c *gin.Context, page string, data interface{}) {
+	t, ok := s.templates[page]
+	if !ok {
+		log.Printf("Template %s not found", page)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		log.Printf("Error in execute template %s: %s", page, err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	c.Header("X-XSS-Protection", "1; mode=block")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,132 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestPagesEscaping(t *testing.T) {
+	date := int(time.Date(2017, 7, 14, 10, 0, 0, 0, time.Local).Unix())
+	s := &Server{
+		DB:          db.NewMemoryStore(),
+		Search:      &stubIndex{total: 1, date: date},
+		PublicChats: []int64{-9},
+		PhotoCache:  make(PhotosCache),
+	}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	chat := &tgbotapi.Chat{ID: -9, Type: "supergroup", Title: "<script>chat</script>"}
+	user := &tgbotapi.User{ID: 3, UserName: "eve", FirstName: "<script>eve</script>"}
+	reply := &tgbotapi.Message{MessageID: 1, Date: date, Chat: chat, From: user, Text: "<script>reply</script>"}
+	s.DB.SaveChat(chat, false)
+	s.DB.SaveMessage(reply)
+	s.DB.SaveMessage(&tgbotapi.Message{MessageID: 2, Date: date + 1, Chat: chat, From: user, ReplyToMessage: reply,
+		Text: `<script>text</script> https://example.com/?a=1&b="2"`})
+	s.DB.SaveEditedMessage(&tgbotapi.Message{MessageID: 3, Date: date + 2, EditDate: date + 3, Chat: chat, From: user,
+		Caption: "<script>caption</script>"})
+
+	r := s.router()
+	paths := []string{
+		"/",
+		"/chat/-9/",
+		"/chat/-9/2017",
+		"/chat/-9/2017/7",
+		"/chat/-9/2017/7/14",
+		"/chat/-9/message/3",
+		`/chat/-9/search?q=%22%3E%3Cscript%3E`,
+		"/user/eve",
+	}
+	for _, path := range paths {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.HasPrefix(body, "<!DOCTYPE html>") {
+			t.Errorf("%s: status %d, %s", path, w.Code, body)
+		}
+		if strings.Contains(body, "<script") {
+			t.Errorf("%s: unescaped text in %s", path, body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/chat/-9/2017/7/14", nil))
+	for _, expected := range []string{
+		`&lt;script&gt;reply&lt;/script&gt;`,
+		`<a href="https://example.com/?a=1&amp;b=">https://example.com/?a=1&amp;b=</a>`,
+		`&lt;script&gt;caption&lt;/script&gt;`,
+		`href="/chat/-9/message/3"`,
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Day page has no %s: %s", expected, w.Body.String())
+		}
+	}
+}
+
+func TestTemplatesDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// page template replaces built-in one, other pages use built-in templates with the same layout
+	main := `{{define "title"}}Branded logs{{end}}{{define "content"}}{{range .Chats}}<p class="brand">{{.Name}}</p>{{end}}{{end}}`
+	if err = ioutil.WriteFile(filepath.Join(dir, "main.html"), []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DB: db.NewMemoryStore(), PublicChats: []int64{-9}, TemplatesDir: dir}
+	s.DB.SaveChat(&tgbotapi.Chat{ID: -9, Type: "group", Title: "<i>Group</i>"}, false)
+	if err = s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.router()
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+	if body := get("/"); !strings.Contains(body, "<title>Branded logs</title>") ||
+		!strings.Contains(body, `<p class="brand">&lt;i&gt;Group&lt;/i&gt;</p>`) {
+		t.Errorf("Main page is not replaced: %s", body)
+	}
+	if body := get("/chat/-9/"); !strings.Contains(body, "<title>Telegram logs</title>") || !strings.Contains(body, "Years") {
+		t.Errorf("Chat page is not built-in: %s", body)
+	}
+
+	// layout is replaced for all pages
+	layout := `<html><title>{{block "title" .}}Brand{{end}}</title>{{template "content" .}}</html>`
+	if err = ioutil.WriteFile(filepath.Join(dir, layoutTemplate), []byte(layout), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	r = s.router()
+	if body := get("/chat/-9/"); !strings.HasPrefix(body, "<html><title>Brand</title>") {
+		t.Errorf("Layout is not replaced: %s", body)
+	}
+
+	// broken template is an error, loaded templates are kept
+	if err = ioutil.WriteFile(filepath.Join(dir, "day.html"), []byte(`{{define "content"}}{{.Messages`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.LoadTemplates(); err == nil {
+		t.Errorf("Broken template is loaded")
+	}
+	if body := get("/"); !strings.Contains(body, "<title>Branded logs</title>") {
+		t.Errorf("Loaded templates are lost: %s", body)
+	}
+}
@@ -0,0 +1,74 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// webhookSecretHeader is a header with secret token in webhook requests from Telegram
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// EnableWebhook method adds webhook route to http server and returns channel of received updates.
+// It must be called before Start.
+func (s *Server) EnableWebhook(path, secret string) <-chan db.Update {
+	s.webhookPath = path
+	s.webhookSecret = secret
+	s.webhookUpdates = make(chan db.Update, s.Bot.Buffer)
+	return s.webhookUpdates
+}
+
+// webhookHandler receives update from Telegram and sends it to updates channel
+func (s *Server) webhookHandler(c *gin.Context) {
+	secret := c.GetHeader(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(s.webhookSecret)) != 1 {
+		log.Printf("Webhook request from %s with bad secret token", c.ClientIP())
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	data, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.Printf("Error in read webhook update: %s", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	update, err := db.DecodeUpdate(data)
+	if err != nil {
+		log.Printf("Error in decode webhook update: %s", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	s.webhookUpdates <- update
+	c.Status(http.StatusOK)
+}
+
+// RegisterWebhook method sets webhook url with secret token in Telegram.
+// certFile is uploaded for self-signed certificates, empty for certificates of trusted CA.
+func (s *Server) RegisterWebhook(webhookURL, secret, certFile string) (err error) {
+	var resp tgbotapi.APIResponse
+	if certFile != "" {
+		params := map[string]string{"url": webhookURL, "secret_token": secret}
+		resp, err = s.Bot.UploadFile("setWebhook", params, "certificate", certFile)
+	} else {
+		params := url.Values{}
+		params.Set("url", webhookURL)
+		params.Set("secret_token", secret)
+		resp, err = s.Bot.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return
+	}
+	if !resp.Ok {
+		return fmt.Errorf("setWebhook: %s", resp.Description)
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{Bot: &tgbotapi.BotAPI{Buffer: 10}}
+	updates := s.EnableWebhook("/telegram/hook", "secret")
+	r := s.router()
+
+	update := `{"update_id":5,"message":{"message_id":1,"date":1,"chat":{"id":2,"type":"private"},"text":"hi"}}`
+	tests := []struct {
+		name   string
+		path   string
+		secret string
+		body   string
+		code   int
+	}{
+		{"no secret", "/telegram/hook", "", update, http.StatusUnauthorized},
+		{"bad secret", "/telegram/hook", "bad", update, http.StatusUnauthorized},
+		{"prefix of secret", "/telegram/hook", "secre", update, http.StatusUnauthorized},
+		{"bad json", "/telegram/hook", "secret", "{", http.StatusBadRequest},
+		{"other path", "/telegram/other", "secret", update, http.StatusNotFound},
+		{"valid", "/telegram/hook", "secret", update, http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.path, strings.NewReader(test.body))
+		if test.secret != "" {
+			req.Header.Set(webhookSecretHeader, test.secret)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: status %d, expected %d", test.name, w.Code, test.code)
+		}
+	}
+
+	if len(updates) != 1 {
+		t.Fatalf("%d updates received, expected 1", len(updates))
+	}
+	u := <-updates
+	if u.UpdateID != 5 || u.Message == nil || u.Message.Text != "hi" {
+		t.Errorf("Bad update %+v", u)
+	}
+}
+
+func TestWebhookDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{Bot: &tgbotapi.BotAPI{Buffer: 10}}
+	r := s.router()
+
+	req := httptest.NewRequest("POST", "/telegram/hook", strings.NewReader(`{"update_id":1}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status %d without webhook, expected %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,133 @@
+package httpserver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const webLinkCookie = "weblink"
+
+// webLinkAccess returns true if request has active web link token for chat in token parameter or cookie.
+// Token from parameter is saved to cookie for next pages of chat.
+func (s *Server) webLinkAccess(c *gin.Context, chatID int64) bool {
+	token := c.Query("token")
+	fromQuery := token != ""
+	if !fromQuery {
+		token, _ = c.Cookie(webLinkCookie)
+	}
+	if token == "" {
+		return false
+	}
+
+	link, err := s.DB.GetWebLink(db.WebLinkHash(token))
+	if err != nil {
+		if err != db.ErrNotFound {
+			log.Printf("Error in GetWebLink: %s", err)
+		}
+		return false
+	}
+	now := time.Now()
+	if link.ChatID != chatID || !link.Active(now) {
+		return false
+	}
+
+	if fromQuery {
+		maxAge := int(sessionTTL.Seconds())
+		if link.ExpiresAt != 0 {
+			maxAge = int(link.ExpiresAt - now.Unix())
+		}
+		c.SetCookie(webLinkCookie, token, maxAge, fmt.Sprintf("/chat/%d/", chatID), "", c.Request.TLS != nil, true)
+	}
+	return true
+}
+
+// WebLinkCreate method creates read-only link to web log of chat, argument is an optional lifetime e.g. 7d
+func (s *Server) WebLinkCreate(msg *tgbotapi.Message) {
+	var ttl time.Duration
+	if args := strings.TrimSpace(msg.CommandArguments()); args != "" {
+		var err error
+		if ttl, err = parseDuration(args); err != nil {
+			s.SendError("Укажите срок действия ссылки, например: /weblink 7d", msg)
+			return
+		}
+	}
+
+	link, token, err := db.NewWebLink(msg.Chat.ID, msg.From.ID, ttl)
+	if err != nil {
+		log.Printf("Error in NewWebLink: %s", err)
+		return
+	}
+	if err = s.DB.SaveWebLink(link); err != nil {
+		log.Printf("Error in SaveWebLink: %s", err)
+		s.SendError("Не удалось сохранить ссылку", msg)
+		return
+	}
+
+	text := fmt.Sprintf("Ссылка %s на логи чата:\n%s/chat/%d/?token=%s", link.ID(), s.WebURL, msg.Chat.ID, token)
+	if link.ExpiresAt != 0 {
+		text += fmt.Sprintf("\nДействует до %s", time.Unix(link.ExpiresAt, 0).Format("2006-01-02 15:04"))
+	}
+	s.SendMessage(text, msg.Chat.ID, msg.MessageID)
+}
+
+// WebLinkList method sends list of active links of chat
+func (s *Server) WebLinkList(msg *tgbotapi.Message) {
+	links, err := s.DB.GetWebLinks(msg.Chat.ID)
+	if err != nil {
+		log.Printf("Error in GetWebLinks: %s", err)
+		return
+	}
+
+	now := time.Now()
+	var lines []string
+	for _, link := range links {
+		if !link.Active(now) {
+			continue
+		}
+		line := fmt.Sprintf("%s создана %s", link.ID(), time.Unix(link.CreatedAt, 0).Format("2006-01-02 15:04"))
+		if link.ExpiresAt != 0 {
+			line += fmt.Sprintf(", действует до %s", time.Unix(link.ExpiresAt, 0).Format("2006-01-02 15:04"))
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		s.SendMessage("Активных ссылок нет", msg.Chat.ID, msg.MessageID)
+		return
+	}
+	s.SendMessage(fmt.Sprintf("Активные ссылки:\n%s\nОтозвать: /revokelink ID", strings.Join(lines, "\n")), msg.Chat.ID, msg.MessageID)
+}
+
+// WebLinkRevoke method revokes link of chat by ID
+func (s *Server) WebLinkRevoke(msg *tgbotapi.Message) {
+	id := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+	if id == "" {
+		s.SendError("Укажите ID ссылки из /weblinks", msg)
+		return
+	}
+
+	links, err := s.DB.GetWebLinks(msg.Chat.ID)
+	if err != nil {
+		log.Printf("Error in GetWebLinks: %s", err)
+		return
+	}
+	for _, link := range links {
+		if link.ID() != id || link.Revoked {
+			continue
+		}
+		link.Revoked = true
+		if err = s.DB.SaveWebLink(link); err != nil {
+			log.Printf("Error in SaveWebLink: %s", err)
+			return
+		}
+		s.SendMessage(fmt.Sprintf("Ссылка %s отозвана", id), msg.Chat.ID, msg.MessageID)
+		return
+	}
+	s.SendError(fmt.Sprintf("Ссылка %s не найдена", id), msg)
+}
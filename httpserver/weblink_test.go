@@ -0,0 +1,149 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestWebLinkAccess(t *testing.T) {
+	store := db.NewMemoryStore()
+	s := &Server{DB: store, APIKey: "123:ABC"}
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	newLink := func(chatID int64, ttl time.Duration, revoked bool) string {
+		link, token, err := db.NewWebLink(chatID, 1, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		link.Revoked = revoked
+		if ttl < 0 {
+			link.ExpiresAt = time.Now().Add(ttl).Unix()
+		}
+		if err = store.SaveWebLink(link); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	active := newLink(-5, 0, false)
+	expiring := newLink(-5, time.Hour, false)
+	expired := newLink(-5, -time.Minute, false)
+	revoked := newLink(-5, 0, true)
+
+	r := s.router()
+	get := func(path, cookie string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: webLinkCookie, Value: cookie})
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie string
+		code   int
+	}{
+		{"token", "/chat/-5/?token=" + active, "", http.StatusOK},
+		{"expiring token", "/chat/-5/2017?token=" + expiring, "", http.StatusOK},
+		{"cookie", "/chat/-5/2017/5", active, http.StatusOK},
+		{"other chat", "/chat/-6/?token=" + active, "", http.StatusFound},
+		{"cookie of other chat", "/chat/-6/", active, http.StatusFound},
+		{"expired", "/chat/-5/?token=" + expired, "", http.StatusFound},
+		{"revoked", "/chat/-5/?token=" + revoked, "", http.StatusFound},
+		{"revoked cookie", "/chat/-5/", revoked, http.StatusFound},
+		{"unknown", "/chat/-5/?token=" + strings.Repeat("0", len(active)), "", http.StatusFound},
+		{"hash instead of token", "/chat/-5/?token=" + db.WebLinkHash(active), "", http.StatusFound},
+	}
+	for _, test := range tests {
+		if w := get(test.path, test.cookie); w.Code != test.code {
+			t.Errorf("%s: status %d, expected %d", test.name, w.Code, test.code)
+		}
+	}
+
+	// token is saved to cookie of chat pages, cookie lives until link expires
+	w := get("/chat/-5/?token="+expiring, "")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != expiring || cookies[0].Path != "/chat/-5/" || !cookies[0].HttpOnly {
+		t.Fatalf("Bad cookies %v", cookies)
+	}
+	if cookies[0].MaxAge <= 0 || cookies[0].MaxAge > 3600 {
+		t.Errorf("Cookie lives %d seconds", cookies[0].MaxAge)
+	}
+	if w = get("/chat/-5/", expiring); len(w.Result().Cookies()) != 0 {
+		t.Errorf("Cookie is set again: %v", w.Result().Cookies())
+	}
+}
+
+func TestWebLinkCommands(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	store := db.NewMemoryStore()
+	s := api.server()
+	s.DB = store
+	s.WebURL = "http://logs.example.com"
+
+	s.WebLinkCreate(roleCommand(1, "/weblink 7d"))
+	text := api.lastText("sendMessage")
+	match := regexp.MustCompile(`^Ссылка ([0-9a-f]{8}) на логи чата:\nhttp://logs\.example\.com/chat/-5/\?token=([0-9a-f]+)\nДействует до `).FindStringSubmatch(text)
+	if match == nil {
+		t.Fatalf("Bad link message %q", text)
+	}
+	link, err := store.GetWebLink(db.WebLinkHash(match[2]))
+	if err != nil || link.ID() != match[1] || link.ChatID != -5 || link.CreatedBy != 1 {
+		t.Fatalf("Saved link is %+v, %v", link, err)
+	}
+	if ttl := time.Unix(link.ExpiresAt, 0).Sub(time.Now()); ttl < 7*24*time.Hour-time.Minute || ttl > 7*24*time.Hour {
+		t.Errorf("Link expires in %s", ttl)
+	}
+
+	s.WebLinkCreate(roleCommand(1, "/weblink"))
+	if text = api.lastText("sendMessage"); !strings.Contains(text, "?token=") || strings.Contains(text, "Действует до") {
+		t.Errorf("Bad link without expiration %q", text)
+	}
+	s.WebLinkCreate(roleCommand(1, "/weblink week"))
+	if text = api.lastText("sendMessage"); !strings.Contains(text, "/weblink 7d") {
+		t.Errorf("Bad lifetime is not reported: %q", text)
+	}
+	if links, _ := store.GetWebLinks(-5); len(links) != 2 {
+		t.Fatalf("%d links are saved", len(links))
+	}
+
+	s.WebLinkList(roleCommand(1, "/weblinks"))
+	// links created in the same second may be listed in any order
+	text = api.lastText("sendMessage")
+	if !strings.HasPrefix(text, "Активные ссылки:\n") || !strings.Contains(text, "\n"+match[1]+" создана ") || strings.Count(text, " создана ") != 2 {
+		t.Errorf("Bad list %q", text)
+	}
+
+	s.WebLinkRevoke(roleCommand(1, "/revokelink "+strings.ToUpper(match[1])))
+	if text = api.lastText("sendMessage"); text != "Ссылка "+match[1]+" отозвана" {
+		t.Errorf("Bad revoke message %q", text)
+	}
+	if link, _ = store.GetWebLink(db.WebLinkHash(match[2])); !link.Revoked {
+		t.Errorf("Link is not revoked")
+	}
+	s.WebLinkRevoke(roleCommand(1, "/revokelink "+match[1]))
+	if text = api.lastText("sendMessage"); !strings.Contains(text, "не найдена") {
+		t.Errorf("Revoked link is revoked again: %q", text)
+	}
+
+	// links of other chats are not listed
+	other := roleCommand(1, "/weblinks")
+	other.Chat = &tgbotapi.Chat{ID: -6, Type: "group"}
+	s.WebLinkList(other)
+	if text = api.lastText("sendMessage"); text != "Активных ссылок нет" {
+		t.Errorf("Bad list of other chat %q", text)
+	}
+}
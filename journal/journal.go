@@ -0,0 +1,95 @@
+// Package journal keeps Telegram updates with caption entities in append-only file, one JSON object per line,
+// for replay them to storage after crash or data loss
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/elemc/gotelegrambot/db"
+)
+
+// maxLineSize is a max size of journal line, updates with big messages are still less than it
+const maxLineSize = 16 * 1024 * 1024
+
+// Journal is an append-only file of updates
+type Journal struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// Open function opens journal file for append, file is created if not exists
+func Open(path string) (j *Journal, err error) {
+	j = new(Journal)
+	if j.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return nil, fmt.Errorf("Cannot open journal: %s", err)
+	}
+	return
+}
+
+// Write method appends update to journal and flushes it to disk
+func (j *Journal) Write(update db.Update) (err error) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if _, err = j.file.Write(data); err != nil {
+		return
+	}
+	return j.file.Sync()
+}
+
+// Close method closes journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Replay function reads updates from journal file and calls fn for every update with ID greater than afterID.
+// Broken last line is skipped, it is an update which was not completely written before crash.
+func Replay(path string, afterID int, fn func(update db.Update) error) (count int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return replay(f, afterID, fn)
+}
+
+func replay(r io.Reader, afterID int, fn func(update db.Update) error) (count int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	line := 0
+	var broken error
+	for scanner.Scan() {
+		line++
+		if broken != nil {
+			return count, broken
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var update db.Update
+		if err = json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			broken = fmt.Errorf("line %d: %s", line, err)
+			continue
+		}
+		if update.UpdateID <= afterID {
+			continue
+		}
+		if err = fn(update); err != nil {
+			return count, fmt.Errorf("update %d: %s", update.UpdateID, err)
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
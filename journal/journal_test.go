@@ -0,0 +1,121 @@
+package journal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestReplay(t *testing.T) {
+	const (
+		first  = `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":-5},"text":"a"}}`
+		second = `{"update_id":2,"message":{"message_id":2,"date":2,"chat":{"id":-5},"caption":"b"},"captions":[{"chat_id":-5,"message_id":2,"entities":[{"type":"bold","offset":0,"length":1}]}]}`
+		third  = `{"update_id":3,"message":{"message_id":3,"date":3,"chat":{"id":-5},"text":"c"}}`
+	)
+	tests := []struct {
+		name    string
+		journal string
+		afterID int
+		ids     []int
+		failed  bool
+	}{
+		{"all", first + "\n" + second + "\n" + third + "\n", 0, []int{1, 2, 3}, false},
+		{"without last newline", first + "\n" + second + "\n" + third, 0, []int{1, 2, 3}, false},
+		{"empty lines", "\n" + first + "\n\n" + second + "\n", 0, []int{1, 2}, false},
+		{"after", first + "\n" + second + "\n" + third + "\n", 1, []int{2, 3}, false},
+		{"after last", first + "\n" + second + "\n", 2, nil, false},
+		{"broken last line", first + "\n" + second + "\n" + third[:20], 0, []int{1, 2}, false},
+		{"broken last line with newline", first + "\n" + third[:20] + "\n", 0, []int{1}, false},
+		{"broken middle line", first + "\n" + second[:20] + "\n" + third + "\n", 0, []int{1}, true},
+		{"broken skipped line", first[:20] + "\n" + second + "\n", 1, nil, true},
+		{"empty", "", 0, nil, false},
+	}
+	for _, test := range tests {
+		var ids []int
+		count, err := replay(strings.NewReader(test.journal), test.afterID, func(update db.Update) error {
+			ids = append(ids, update.UpdateID)
+			return nil
+		})
+		if (err != nil) != test.failed || count != len(test.ids) || !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: replayed %v, count %d, error %v", test.name, ids, count, err)
+		}
+	}
+
+	var captions []*db.Caption
+	replay(strings.NewReader(second), 0, func(update db.Update) error {
+		captions = update.Captions
+		return nil
+	})
+	if len(captions) != 1 || captions[0].MessageID != 2 || captions[0].Entities[0].Type != "bold" {
+		t.Errorf("Captions are lost: %v", captions)
+	}
+
+	// error of fn stops replay
+	count, err := replay(strings.NewReader(first+"\n"+second+"\n"), 0, func(update db.Update) error {
+		if update.UpdateID == 2 {
+			return errors.New("disk full")
+		}
+		return nil
+	})
+	if count != 1 || err == nil || !strings.Contains(err.Error(), "update 2") {
+		t.Errorf("Failed replay returns %d, %v", count, err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "updates.journal")
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	caption := &db.Caption{ChatID: -5, MessageID: 2, Entities: []tgbotapi.MessageEntity{{Type: "italic", Offset: 0, Length: 1}}}
+	updates := []db.Update{
+		{Update: tgbotapi.Update{UpdateID: 1, Message: &tgbotapi.Message{MessageID: 1, Date: 1, Chat: chat, Text: "a\nb"}}},
+		{Update: tgbotapi.Update{UpdateID: 2, Message: &tgbotapi.Message{MessageID: 2, Date: 2, Chat: chat, Caption: "c"}}, Captions: []*db.Caption{caption}},
+		{Update: tgbotapi.Update{UpdateID: 3, EditedMessage: &tgbotapi.Message{MessageID: 1, Date: 1, EditDate: 3, Chat: chat, Text: "d"}}},
+	}
+
+	// journal is appended after restart
+	for _, part := range [][]db.Update{updates[:2], updates[2:]} {
+		j, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, update := range part {
+			if err = j.Write(update); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = j.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var replayed []db.Update
+	count, err := Replay(path, 0, func(update db.Update) error {
+		replayed = append(replayed, update)
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Fatalf("Replay returns %d, %v", count, err)
+	}
+	if replayed[0].Message.Text != "a\nb" || replayed[1].Captions[0].Entities[0].Type != "italic" ||
+		replayed[2].EditedMessage.EditDate != 3 {
+		t.Errorf("Replayed updates differ: %+v", replayed)
+	}
+
+	if _, err = Replay(filepath.Join(dir, "unknown.journal"), 0, func(db.Update) error { return nil }); err == nil {
+		t.Errorf("Replay of missing journal does not fail")
+	}
+}
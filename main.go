@@ -2,10 +2,17 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/elemc/gotelegrambot/db"
 	"github.com/elemc/gotelegrambot/httpserver"
+	"github.com/elemc/gotelegrambot/journal"
+	"github.com/elemc/gotelegrambot/media"
+	"github.com/elemc/gotelegrambot/search"
 
 	"gopkg.in/telegram-bot-api.v4"
 )
@@ -15,25 +22,74 @@ var (
 	settings Settings
 )
 
+// subcommands is a list of command line subcommands, bot starts if no subcommand given
+var subcommands = map[string]func(args []string){
+	"migrate": migrateCommand,
+	"reindex": reindexCommand,
+	"replay":  replayCommand,
+	"gc":      gcCommand,
+	"usage":   usageCommand,
+	"sync":    syncCommand,
+}
+
 func init() {
 	LoadConfig()
+	addSettingsFlags(flag.CommandLine)
+	flag.StringVar(&settings.Storage, "storage", settings.Storage, "storage backend: couchbase, sqlite or memory")
+}
 
-	flag.StringVar(&settings.APIKey, "api-key", settings.APIKey, "API key for Telegram bot")
-	flag.StringVar(&settings.Addr, "addr", settings.Addr, "address string host:port for listen http server")
-	flag.StringVar(&settings.Couchbase.Cluster, "couch-cluster", settings.Couchbase.Cluster, "url to couchbase cluster")
-	flag.StringVar(&settings.Couchbase.Bucket, "couch-bucket", settings.Couchbase.Bucket, "couchbase bucket name")
-	flag.StringVar(&settings.Couchbase.Secret, "couch-secret", settings.Couchbase.Secret, "couchbase bucket password")
-	flag.StringVar(&settings.StaticDirPath, "static-dir-path", "static", "set path to static dir")
+// addSettingsFlags adds flags for settings to flag set
+func addSettingsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&settings.APIKey, "api-key", settings.APIKey, "API key for Telegram bot")
+	fs.StringVar(&settings.Addr, "addr", settings.Addr, "address string host:port for listen http server")
+	fs.StringVar(&settings.WebURL, "web-url", settings.WebURL, "public url of web logs for links in bot messages, e.g. http://logs.elemc.name")
+	fs.StringVar(&settings.Couchbase.Cluster, "couch-cluster", settings.Couchbase.Cluster, "url to couchbase cluster")
+	fs.StringVar(&settings.Couchbase.Bucket, "couch-bucket", settings.Couchbase.Bucket, "couchbase bucket name")
+	fs.StringVar(&settings.Couchbase.Secret, "couch-secret", settings.Couchbase.Secret, "couchbase bucket password")
+	fs.StringVar(&settings.SQLite.Path, "sqlite-path", settings.SQLite.Path, "path to sqlite database file")
+	fs.StringVar(&settings.Search.IndexPath, "search-index", settings.Search.IndexPath, "path to full-text search index file, empty for disable search")
+	fs.StringVar(&settings.JournalPath, "journal", settings.JournalPath, "path to journal of received updates, empty for disable journal")
+	fs.IntVar(&settings.Downloads.Workers, "download-workers", settings.Downloads.Workers, "number of parallel file downloads")
+	fs.IntVar(&settings.Downloads.Retries, "download-retries", settings.Downloads.Retries, "number of download attempts before file goes to failed downloads")
+	fs.IntVar(&settings.Downloads.Timeout, "download-timeout", settings.Downloads.Timeout, "timeout of file download in seconds")
+	fs.IntVar(&settings.Downloads.MaxAttempts, "download-max-attempts", settings.Downloads.MaxAttempts, "number of attempts after which failed download is retried only manually")
+	fs.StringVar(&settings.Media.Backend, "media-backend", settings.Media.Backend, "storage of downloaded files: local or s3")
+	fs.StringVar(&settings.Media.Serve, "media-serve", settings.Media.Serve, "serve files of s3 storage with proxy or redirect to presigned url")
+	fs.StringVar(&settings.APIURL, "api-url", settings.APIURL, "url of Telegram Bot API server, e.g. local fake server for tests")
+	fs.StringVar(&settings.Webhook.URL, "webhook-url", settings.Webhook.URL, "public url of webhook, long polling is used if empty")
+	fs.StringVar(&settings.Webhook.Secret, "webhook-secret", settings.Webhook.Secret, "secret token of webhook, random if empty")
+	fs.BoolVar(&settings.Webhook.SelfSigned, "webhook-self-signed", settings.Webhook.SelfSigned, "upload tls certificate to Telegram for self-signed certificate")
+	fs.StringVar(&settings.TLSCertFile, "tls-cert", settings.TLSCertFile, "tls certificate file for https server")
+	fs.StringVar(&settings.TLSKeyFile, "tls-key", settings.TLSKeyFile, "tls key file for https server")
+	fs.StringVar(&settings.StaticDirPath, "static-dir-path", "static", "set path to static dir")
+	fs.StringVar(&settings.TemplatesDir, "templates-dir", settings.TemplatesDir, "directory with html templates which replace built-in ones")
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 	//SaveConfig()
-	db.InitCouchbase(settings.Couchbase.Cluster, settings.Couchbase.Bucket, settings.Couchbase.Secret)
+	store, err := openStore(settings.Storage)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", settings.Storage, err)
+	}
+	var index search.Index
+	if settings.Search.IndexPath != "" {
+		if index, err = search.NewSQLiteIndex(settings.Search.IndexPath); err != nil {
+			log.Fatalf("Cannot initialize search index: %s", err)
+		}
+		store = search.NewIndexingStore(store, index)
+	}
 
-	bot, err := tgbotapi.NewBotAPI(settings.APIKey)
+	bot, err := newBotAPI(settings.APIKey, settings.APIURL)
 	if err != nil {
-		log.Fatalf("Cannot create bot api")
+		log.Fatalf("Cannot create bot api: %s", err)
 	}
 
 	bot.Debug = false // true
@@ -41,65 +97,152 @@ func main() {
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
 	// start http server
-	s := httpserver.Server{Addr: settings.Addr, Bot: bot}
+	s := httpserver.Server{Addr: settings.Addr, Bot: bot, DB: store, Search: index}
 	s.PhotoCache = make(httpserver.PhotosCache)
 	s.FileCache = make(httpserver.FilesCache)
 	s.APIKey = settings.APIKey
 	s.StaticDirPath = settings.StaticDirPath
-	go s.FillCens()
-	go s.Start()
-	//s.Start()
+	s.WebURL = strings.TrimRight(settings.WebURL, "/")
+	s.TemplatesDir = settings.TemplatesDir
+	s.PublicChats = settings.PublicChats
+	s.TLSCertFile = settings.TLSCertFile
+	s.TLSKeyFile = settings.TLSKeyFile
+	if s.Media, err = openMediaBackend(settings.Media.Backend); err != nil {
+		log.Fatalf("Cannot initialize %s media backend: %s", settings.Media.Backend, err)
+	}
+	s.MediaServe = settings.Media.Serve
+	s.MediaURLTTL = time.Duration(settings.Media.URLTTL) * time.Minute
+	s.Downloads = httpserver.DownloadSettings{
+		Workers:       settings.Downloads.Workers,
+		Retries:       settings.Downloads.Retries,
+		Timeout:       time.Duration(settings.Downloads.Timeout) * time.Second,
+		RetryInterval: time.Duration(settings.Downloads.RetryInterval) * time.Minute,
+		MaxAttempts:   settings.Downloads.MaxAttempts,
+	}
+	if err = s.LoadTemplates(); err != nil {
+		log.Fatalf("Cannot load templates: %s", err)
+	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	var updatesJournal *journal.Journal
+	if settings.JournalPath != "" {
+		if updatesJournal, err = journal.Open(settings.JournalPath); err != nil {
+			log.Fatalf("Cannot initialize updates journal: %s", err)
+		}
+		defer updatesJournal.Close()
+	}
 
-	updates, err := bot.GetUpdatesChan(u)
+	lastUpdateID, err := store.GetUpdateOffset()
 	if err != nil {
-		log.Panic(err.Error())
+		log.Fatalf("Cannot get last update ID: %s", err)
+	}
+	updates, err := startUpdates(bot, &s, lastUpdateID)
+	if err != nil {
+		log.Fatalf("Cannot start receive updates: %s", err)
 	}
 
+	if err = s.SetBotCommands(); err != nil {
+		log.Printf("Error in set bot commands: %s", err)
+	}
+	s.StartDownloads()
+	s.StartSanctions()
+	go s.FillCens()
+	go s.Start()
+	//s.Start()
+
 	for update := range updates {
-		if update.Message == nil {
+		// Telegram may send update again, e.g. after webhook timeout. Update IDs may start
+		// from random value after week without updates, so only near IDs are duplicates.
+		if update.UpdateID <= lastUpdateID && lastUpdateID-update.UpdateID < duplicateUpdateWindow {
 			continue
 		}
-
-		go db.GoSaveMessage(update.Message)
-
-		// Photo
-		id := int64(update.Message.From.ID)
-		if _, ok := s.PhotoCache[id]; !ok {
-			go s.GetPhoto(id)
-		}
-
-		// Files
-		if update.Message.Audio != nil {
-			go s.GetFile(update.Message.Audio.FileID, update.Message.Chat.ID)
-		}
-		if update.Message.Document != nil {
-			go s.GetFile(update.Message.Document.FileID, update.Message.Chat.ID)
-		}
-		if update.Message.Photo != nil {
-			for _, f := range *update.Message.Photo {
-				go s.GetFile(f.FileID, update.Message.Chat.ID)
+		lastUpdateID = update.UpdateID
+		if updatesJournal != nil {
+			if err = updatesJournal.Write(update); err != nil {
+				log.Printf("Error in write update %d to journal: %s", update.UpdateID, err)
 			}
 		}
-		if update.Message.Sticker != nil {
-			go s.GetFile(update.Message.Sticker.FileID, update.Message.Chat.ID)
-		}
-		if update.Message.Video != nil {
-			go s.GetFile(update.Message.Video.FileID, update.Message.Chat.ID)
+		if err = handleUpdate(&s, store, update); err != nil {
+			// offset is saved only after message, journal keeps update if it is enabled
+			log.Printf("Error in handle update %d: %s", update.UpdateID, err)
+			continue
 		}
-		if update.Message.Voice != nil {
-			go s.GetFile(update.Message.Voice.FileID, update.Message.Chat.ID)
+		if err = store.SaveUpdateOffset(update.UpdateID); err != nil {
+			log.Printf("Error in save update offset %d: %s", update.UpdateID, err)
 		}
+	}
+}
 
-		// Commands
-		if update.Message.IsCommand() {
-			go s.CommandHandler(update.Message)
-		} else {
-			// Cens
-			// Disable cens
-			//go s.Cens(update.Message)
-		}
+// handleUpdate saves update to storage and runs commands.
+// Message is saved before return, so update offset may be saved after it.
+func handleUpdate(s *httpserver.Server, store db.Store, update db.Update) (err error) {
+	if update.CallbackQuery != nil {
+		go s.CallbackHandler(update.CallbackQuery)
+		return
+	}
+	if err = archiveUpdate(store, update); err != nil {
+		err = fmt.Errorf("Cannot save message: %s", err)
+	}
+
+	if update.EditedMessage != nil {
+		s.GetMessageFiles(update.EditedMessage)
+		return
+	}
+	// Channels
+	if update.ChannelPost != nil {
+		s.GetMessageFiles(update.ChannelPost)
+		return
+	}
+	if update.EditedChannelPost != nil {
+		s.GetMessageFiles(update.EditedChannelPost)
+		return
+	}
+	if update.Message == nil {
+		return
+	}
+
+	// Photo
+	id := int64(update.Message.From.ID)
+	if _, ok := s.PhotoCache[id]; !ok {
+		go s.GetPhoto(id)
+	}
+
+	// Files
+	s.GetMessageFiles(update.Message)
+
+	// Commands
+	if update.Message.IsCommand() {
+		go s.CommandHandler(update.Message)
+	} else {
+		// Cens
+		// Disable cens
+		//go s.Cens(update.Message)
+	}
+	return
+}
+
+// openStore opens storage backend by name with settings
+func openStore(storage string) (db.Store, error) {
+	switch storage {
+	case "couchbase":
+		return db.NewCouchbaseStore(settings.Couchbase.Cluster, settings.Couchbase.Bucket, settings.Couchbase.Secret)
+	case "sqlite":
+		return db.NewSQLiteStore(settings.SQLite.Path)
+	case "memory":
+		return db.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend")
+	}
+}
+
+// openMediaBackend opens storage of downloaded files by name with settings
+func openMediaBackend(backend string) (media.Backend, error) {
+	switch backend {
+	case "local":
+		return media.NewLocal(settings.StaticDirPath), nil
+	case "s3":
+		s3 := settings.Media.S3
+		return media.NewS3(s3.Endpoint, s3.Region, s3.Bucket, s3.AccessKey, s3.SecretKey)
+	default:
+		return nil, fmt.Errorf("unknown media backend")
 	}
 }
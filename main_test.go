@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/httpserver"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestOpenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved string) { settings.SQLite.Path = saved }(settings.SQLite.Path)
+	settings.SQLite.Path = filepath.Join(dir, "bot.db")
+
+	store, err := openStore("memory")
+	if _, ok := store.(*db.MemoryStore); !ok || err != nil {
+		t.Errorf("openStore(memory) returns %T, %v", store, err)
+	}
+	store, err = openStore("sqlite")
+	if _, ok := store.(*db.SQLiteStore); !ok || err != nil {
+		t.Fatalf("openStore(sqlite) returns %T, %v", store, err)
+	}
+	store.(*db.SQLiteStore).Close()
+	if _, err = os.Stat(settings.SQLite.Path); err != nil {
+		t.Errorf("SQLite database is not created: %s", err)
+	}
+	if _, err = openStore("mongodb"); err == nil {
+		t.Errorf("Unknown storage backend is opened")
+	}
+}
+
+// failStore is a store which cannot save messages
+type failStore struct {
+	db.Store
+}
+
+func (failStore) SaveMessage(*tgbotapi.Message) error {
+	return errors.New("disk full")
+}
+
+func TestHandleUpdateChannelPost(t *testing.T) {
+	store := db.NewMemoryStore()
+	s := &httpserver.Server{DB: store}
+	channel := &tgbotapi.Chat{ID: -100, Type: "channel", Title: "News"}
+
+	// message is saved before handleUpdate returns, so update offset may be saved
+	post := &tgbotapi.Message{MessageID: 7, Date: 1500000000, Chat: channel, Text: "post"}
+	if err := handleUpdate(s, store, db.Update{Update: tgbotapi.Update{UpdateID: 1, ChannelPost: post}}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := store.GetMessages(-100); err != nil || len(msgs) != 1 || msgs[0].Text != "post" {
+		t.Errorf("Channel post is not saved: %v, %v", msgs, err)
+	}
+
+	edited := &tgbotapi.Message{MessageID: 7, Date: 1500000000, EditDate: 1500000060, Chat: channel, Text: "edited post"}
+	if err := handleUpdate(s, store, db.Update{Update: tgbotapi.Update{UpdateID: 2, EditedChannelPost: edited}}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := store.GetMessages(-100); err != nil || len(msgs) != 1 || msgs[0].Text != "edited post" {
+		t.Errorf("Edited channel post is not saved: %v, %v", msgs, err)
+	}
+	if revisions, err := store.GetMessageRevisions(-100, 7); err != nil || len(revisions) != 2 {
+		t.Errorf("Revisions of channel post are %v, %v", revisions, err)
+	}
+
+	post = &tgbotapi.Message{MessageID: 8, Date: 1500000000, Chat: channel, Text: "lost"}
+	if err := handleUpdate(s, failStore{store}, db.Update{Update: tgbotapi.Update{UpdateID: 3, ChannelPost: post}}); err == nil {
+		t.Errorf("Error of store is ignored")
+	}
+}
@@ -0,0 +1,142 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned by Backend methods if blob does not exist
+var ErrNotExist = errors.New("blob does not exist")
+
+// BlobInfo is an info about stored blob
+type BlobInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend is a storage of blobs, paths are slash separated, e.g. media/3f/3f5c...e1.jpg
+type Backend interface {
+	// Put stores content of file with given size
+	Put(name string, r io.Reader, size int64) error
+	// Open returns content of blob, it is io.ReadSeeker for seekable storages
+	Open(name string) (io.ReadCloser, error)
+	// Stat returns info about blob
+	Stat(name string) (BlobInfo, error)
+	// Touch updates modification time of blob, so garbage collection does not remove it
+	Touch(name string) error
+	// Delete removes blob
+	Delete(name string) error
+	// Walk calls fn for every blob with path prefix
+	Walk(prefix string, fn func(info BlobInfo) error) error
+}
+
+// Presigner is implemented by backends which can give temporary public URL of blob
+type Presigner interface {
+	PresignGet(name string, ttl time.Duration) (string, error)
+}
+
+// Local is a Backend in local directory
+type Local struct {
+	Dir string
+}
+
+// NewLocal function creates local backend in directory, e.g. in static dir of web server
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+// filename returns path of blob in local file system
+func (l *Local) filename(name string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// Put method writes file to temporary file and renames it, so readers never see partial file
+func (l *Local) Put(name string, r io.Reader, size int64) (err error) {
+	filename := l.filename(name)
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+	tmp := filename + ".part"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	return os.Rename(tmp, filename)
+}
+
+// Open method opens blob file
+func (l *Local) Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(l.filename(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+// Stat method returns info of blob file
+func (l *Local) Stat(name string) (info BlobInfo, err error) {
+	fi, err := os.Stat(l.filename(name))
+	if os.IsNotExist(err) {
+		return info, ErrNotExist
+	}
+	if err != nil {
+		return
+	}
+	return BlobInfo{Path: name, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Touch method sets modification time of blob file to now
+func (l *Local) Touch(name string) error {
+	now := time.Now()
+	return os.Chtimes(l.filename(name), now, now)
+}
+
+// Delete method removes blob file
+func (l *Local) Delete(name string) error {
+	err := os.Remove(l.filename(name))
+	if os.IsNotExist(err) {
+		return ErrNotExist
+	}
+	return err
+}
+
+// Walk method calls fn for every file in directory of prefix with path started with prefix
+func (l *Local) Walk(prefix string, fn func(info BlobInfo) error) error {
+	root := l.filename(path.Dir(prefix + "x"))
+	err := filepath.Walk(root, func(filename string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filename == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Dir, filename)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		return fn(BlobInfo{Path: name, Size: fi.Size(), ModTime: fi.ModTime()})
+	})
+	return err
+}
@@ -0,0 +1,172 @@
+// Package media stores files by SHA-256 hash of content, so the same content is stored once
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+)
+
+// Dir is a directory of stored content relative to static dir
+const Dir = "media"
+
+// gcGracePeriod protects new files from garbage collection, ref of them may be not saved yet
+const gcGracePeriod = time.Hour
+
+// BlobPath returns path of content relative to static dir, ext is an extension with dot
+func BlobPath(hash, ext string) string {
+	return path.Join(Dir, hash[:2], hash+ext)
+}
+
+// Save function stores content of r to backend and returns ref without chat and file ID.
+// Extension of name is kept for content type of web server.
+func Save(backend Backend, r io.Reader, name string) (ref *db.MediaRef, err error) {
+	// content is hashed before upload, so it is buffered in temporary file
+	tmp, err := ioutil.TempFile("", "gotelegrambot-media-")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return
+	}
+
+	ref = &db.MediaRef{Hash: hex.EncodeToString(hash.Sum(nil)), Size: size}
+	ref.Path = BlobPath(ref.Hash, strings.ToLower(path.Ext(name)))
+	if _, err = backend.Stat(ref.Path); err == nil {
+		// already stored, only update time for garbage collection
+		return ref, backend.Touch(ref.Path)
+	}
+	if err != ErrNotExist {
+		return
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	err = backend.Put(ref.Path, tmp, size)
+	return
+}
+
+// GC function removes stored content without refs and returns count and size of removed blobs.
+// Nothing is removed in dry run. Blobs younger than one hour are kept, because they may be in progress.
+func GC(store db.Store, backend Backend, dryRun bool) (count int, size int64, err error) {
+	refs, err := store.GetMediaRefs()
+	if err != nil {
+		return
+	}
+	used := make(map[string]bool)
+	for _, ref := range refs {
+		used[ref.Path] = true
+		if ref.Thumb != "" {
+			used[ref.Thumb] = true
+		}
+	}
+
+	deadline := time.Now().Add(-gcGracePeriod)
+	var orphans []BlobInfo
+	err = backend.Walk(Dir+"/", func(info BlobInfo) error {
+		if !used[info.Path] && info.ModTime.Before(deadline) {
+			orphans = append(orphans, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for _, info := range orphans {
+		if !dryRun {
+			if err = backend.Delete(info.Path); err != nil && err != ErrNotExist {
+				return
+			}
+		}
+		count++
+		size += info.Size
+	}
+	return count, size, nil
+}
+
+// ChatUsage is a disk usage of chat
+type ChatUsage struct {
+	ChatID int64
+	Files  int
+	// Size is a size of all content of chat
+	Size int64
+	// OwnSize is a size of content which is used by this chat only
+	OwnSize int64
+}
+
+// Usage function returns disk usage of chats sorted from big to small ones and total size of stored content
+func Usage(store db.Store) (usage []ChatUsage, total int64, err error) {
+	refs, err := store.GetMediaRefs()
+	if err != nil {
+		return
+	}
+
+	sizes := make(map[string]int64)
+	blobChats := make(map[string]map[int64]bool)
+	for _, ref := range refs {
+		sizes[ref.Path] = ref.Size
+		if blobChats[ref.Path] == nil {
+			blobChats[ref.Path] = make(map[int64]bool)
+		}
+		blobChats[ref.Path][ref.ChatID] = true
+	}
+
+	chats := make(map[int64]*ChatUsage)
+	for blob, chatIDs := range blobChats {
+		total += sizes[blob]
+		for chatID := range chatIDs {
+			u, ok := chats[chatID]
+			if !ok {
+				u = &ChatUsage{ChatID: chatID}
+				chats[chatID] = u
+			}
+			u.Size += sizes[blob]
+			if len(chatIDs) == 1 {
+				u.OwnSize += sizes[blob]
+			}
+		}
+	}
+	for _, ref := range refs {
+		chats[ref.ChatID].Files++
+	}
+
+	for _, u := range chats {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Size != usage[j].Size {
+			return usage[i].Size > usage[j].Size
+		}
+		return usage[i].ChatID < usage[j].ChatID
+	})
+	return
+}
+
+// FormatSize returns human readable size, e.g. 1.5 MiB
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
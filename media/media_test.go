@@ -0,0 +1,189 @@
+package media
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+)
+
+// newTestLocal returns local backend in temporary directory and cleanup function which removes it
+func newTestLocal(t *testing.T) (local *Local, cleanup func()) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLocal(dir), func() { os.RemoveAll(dir) }
+}
+
+// saveRef stores content and saves ref of it for file of chat
+func saveRef(t *testing.T, store db.Store, backend Backend, chatID int64, fileID, content, name string) *db.MediaRef {
+	ref, err := Save(backend, strings.NewReader(content), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.ChatID = chatID
+	ref.FileID = fileID
+	if err = store.SaveMediaRef(ref); err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+// setModTime sets modification time of all stored files
+func setModTime(t *testing.T, local *Local, modTime time.Time) {
+	err := filepath.Walk(local.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, modTime, modTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSave(t *testing.T) {
+	local, cleanup := newTestLocal(t)
+	defer cleanup()
+
+	// the same content of other files is stored once, extension is kept in lower case
+	first, err := Save(local, strings.NewReader("meme"), "photos/file_1.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Size != 4 || len(first.Hash) != 64 || first.Path != BlobPath(first.Hash, ".jpg") ||
+		!strings.HasPrefix(first.Path, "media/"+first.Hash[:2]+"/") {
+		t.Errorf("Bad ref %+v", first)
+	}
+	second, err := Save(local, strings.NewReader("meme"), "photos/file_2.jpg")
+	if err != nil || !reflect.DeepEqual(first, second) {
+		t.Errorf("Second ref of the same content is %+v, %v", second, err)
+	}
+	other, err := Save(local, strings.NewReader("other"), "voice/file_3.ogg")
+	if err != nil || other.Hash == first.Hash || filepath.Ext(other.Path) != ".ogg" {
+		t.Errorf("Ref of other content is %+v, %v", other, err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(local.Dir, filepath.FromSlash(first.Path)))
+	if err != nil || string(data) != "meme" {
+		t.Errorf("Stored content is %q, %v", data, err)
+	}
+	var blobs []string
+	local.Walk(Dir+"/", func(info BlobInfo) error {
+		blobs = append(blobs, info.Path)
+		return nil
+	})
+	if len(blobs) != 2 {
+		t.Errorf("Stored blobs are %v", blobs)
+	}
+
+	// saving of stored content protects it from garbage collection
+	old := time.Now().Add(-2 * gcGracePeriod)
+	setModTime(t, local, old)
+	if _, err = Save(local, strings.NewReader("meme"), "file.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := local.Stat(first.Path); err != nil || !info.ModTime.After(old.Add(time.Minute)) {
+		t.Errorf("Stored content is not touched: %+v, %v", info, err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	local, cleanup := newTestLocal(t)
+	defer cleanup()
+	store := db.NewMemoryStore()
+
+	used := saveRef(t, store, local, -5, "a", "used", "a.jpg")
+	thumb, err := Save(local, strings.NewReader("thumb"), "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used.Thumb = thumb.Path
+	store.SaveMediaRef(used)
+	orphan, err := Save(local, strings.NewReader("orphan"), "b.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new files may be not referenced yet
+	if count, size, err := GC(store, local, false); count != 0 || size != 0 || err != nil {
+		t.Errorf("GC of new files returns %d, %d, %v", count, size, err)
+	}
+
+	setModTime(t, local, time.Now().Add(-2*gcGracePeriod))
+	if count, size, err := GC(store, local, true); count != 1 || size != 6 || err != nil {
+		t.Errorf("Dry run of GC returns %d, %d, %v", count, size, err)
+	}
+	if _, err = local.Stat(orphan.Path); err != nil {
+		t.Errorf("Orphan is removed in dry run: %s", err)
+	}
+	if count, size, err := GC(store, local, false); count != 1 || size != 6 || err != nil {
+		t.Errorf("GC returns %d, %d, %v", count, size, err)
+	}
+	if _, err = local.Stat(orphan.Path); err != ErrNotExist {
+		t.Errorf("Orphan is not removed: %v", err)
+	}
+	for _, path := range []string{used.Path, thumb.Path} {
+		if _, err = local.Stat(path); err != nil {
+			t.Errorf("Used blob %s is removed: %s", path, err)
+		}
+	}
+
+	// nothing is stored yet
+	empty := NewLocal(filepath.Join(local.Dir, "empty"))
+	if count, _, err := GC(db.NewMemoryStore(), empty, false); count != 0 || err != nil {
+		t.Errorf("GC of empty storage returns %d, %v", count, err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	local, cleanup := newTestLocal(t)
+	defer cleanup()
+	store := db.NewMemoryStore()
+
+	// meme is shared by chats, other files are own ones
+	saveRef(t, store, local, -5, "meme", "meme", "a.jpg")
+	saveRef(t, store, local, -5, "meme again", "meme", "b.jpg")
+	saveRef(t, store, local, -5, "voice", "voice!", "c.ogg")
+	saveRef(t, store, local, -6, "meme", "meme", "a.jpg")
+	saveRef(t, store, local, -7, "video", "long video", "d.mp4")
+
+	usage, total, err := Usage(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ChatUsage{
+		{ChatID: -7, Files: 1, Size: 10, OwnSize: 10},
+		{ChatID: -5, Files: 3, Size: 10, OwnSize: 6},
+		{ChatID: -6, Files: 1, Size: 4, OwnSize: 0},
+	}
+	if total != 20 || !reflect.DeepEqual(usage, expected) {
+		t.Errorf("Usage returns %+v, total %d", usage, total)
+	}
+
+	if usage, total, err = Usage(db.NewMemoryStore()); len(usage) != 0 || total != 0 || err != nil {
+		t.Errorf("Usage without files returns %+v, %d, %v", usage, total, err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:                      "0 B",
+		1023:                   "1023 B",
+		1024:                   "1.0 KiB",
+		1536:                   "1.5 KiB",
+		5 * 1024 * 1024:        "5.0 MiB",
+		3 * 1024 * 1024 * 1024: "3.0 GiB",
+	}
+	for size, expected := range tests {
+		if s := FormatSize(size); s != expected {
+			t.Errorf("FormatSize(%d) = %q, expected %q", size, s, expected)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+// S3 is a Backend in bucket of S3 compatible storage, e.g. Amazon S3 or MinIO.
+// Bucket is addressed in path style: <endpoint>/<bucket>/<key>.
+type S3 struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// NewS3 function creates S3 backend
+func NewS3(endpoint, region, bucket, accessKey, secretKey string) (s *S3, err error) {
+	if _, err = url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("bad s3 endpoint: %s", err)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is not set")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	s = &S3{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    &http.Client{Timeout: time.Minute * 10},
+	}
+	return
+}
+
+// objectURL returns url of object or bucket for empty name
+func (s *S3) objectURL(name string, query url.Values) *url.URL {
+	u, _ := url.Parse(s.Endpoint)
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.Bucket
+	if name != "" {
+		u.Path += "/" + strings.TrimLeft(name, "/")
+	}
+	u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+	return u
+}
+
+// do signs and sends request, response with error status is converted to error
+func (s *S3) do(method, name string, query url.Values, body io.Reader, size int64, header http.Header) (resp *http.Response, err error) {
+	req, err := http.NewRequest(method, s.objectURL(name, query).String(), body)
+	if err != nil {
+		return
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	s.sign(req, time.Now().UTC())
+
+	if resp, err = s.Client.Do(req); err != nil {
+		return
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e struct {
+			Code    string
+			Message string
+		}
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("s3 %s %s: %s: %s", method, name, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s", method, name, resp.Status)
+	}
+	return
+}
+
+// Put method uploads object
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, name, nil, r, size, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Open method downloads object
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, name, nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat method returns size and modification time of object
+func (s *S3) Stat(name string) (info BlobInfo, err error) {
+	resp, err := s.do(http.MethodHead, name, nil, nil, 0, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	info = BlobInfo{Path: name, Size: resp.ContentLength}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return
+}
+
+// Touch method copies object to itself, it updates modification time
+func (s *S3) Touch(name string) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s.Bucket+"/"+strings.TrimLeft(name, "/"))
+	header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	resp, err := s.do(http.MethodPut, name, nil, nil, 0, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete method removes object
+func (s *S3) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, name, nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Walk method lists objects with prefix
+func (s *S3) Walk(prefix string, fn func(info BlobInfo) error) (err error) {
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var resp *http.Response
+		if resp, err = s.do(http.MethodGet, "", query, nil, 0, nil); err != nil {
+			return
+		}
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+		for _, object := range result.Contents {
+			if err = fn(BlobInfo{Path: object.Key, Size: object.Size, ModTime: object.LastModified}); err != nil {
+				return
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// PresignGet method returns temporary url of object
+func (s *S3) PresignGet(name string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	u := s.objectURL(name, query)
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		s3EscapePath(u.Path),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonical)
+	return u.String(), nil
+}
+
+// scope returns credential scope of request
+func (s *S3) scope(t time.Time) string {
+	return t.Format(s3DateFormat) + "/" + s.Region + "/s3/aws4_request"
+}
+
+// sign adds AWS signature version 4 to request headers
+func (s *S3) sign(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(key))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonical)))
+}
+
+// signature returns signature of canonical request
+func (s *S3) signature(t time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.SecretKey), t.Format(s3DateFormat))
+	key = s3HMAC(key, s.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	return hex.EncodeToString(s3HMAC(key, stringToSign))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes path as URI encoding of AWS, slashes are kept
+func s3EscapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = strings.Replace(url.QueryEscape(part), "+", "%20", -1)
+	}
+	return strings.Join(parts, "/")
+}
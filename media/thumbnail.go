@@ -0,0 +1,122 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	// gif decoder for thumbnails of gif images
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"golang.org/x/image/draw"
+	// webp decoder for thumbnails of stickers
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// ThumbnailSize is a max width and height of thumbnails
+	ThumbnailSize = 320
+	// thumbsDir is a directory of thumbnails in Dir
+	thumbsDir = "thumbs"
+	// maxImagePixels protects from huge images, they are not decoded
+	maxImagePixels = 50 * 1000 * 1000
+)
+
+// thumbnailExts are extensions of files which have thumbnails
+var thumbnailExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// HasThumbnail returns true if thumbnail is generated for blob
+func HasThumbnail(name string) bool {
+	return thumbnailExts[strings.ToLower(path.Ext(name))]
+}
+
+// thumbPath returns path of thumbnail for content hash, ext is .jpg or .png
+func thumbPath(hash, ext string) string {
+	return path.Join(Dir, thumbsDir, hash[:2], hash+ext)
+}
+
+// SaveThumbnail function generates thumbnail of image blob of ref and sets ref.Thumb.
+// Thumbnail of the same content is generated once.
+func SaveThumbnail(backend Backend, ref *db.MediaRef) (err error) {
+	if !HasThumbnail(ref.Path) {
+		return fmt.Errorf("%s is not an image", ref.Path)
+	}
+	// thumbnail may be jpeg or png, so check both
+	for _, ext := range []string{".jpg", ".png"} {
+		name := thumbPath(ref.Hash, ext)
+		if _, err = backend.Stat(name); err == nil {
+			ref.Thumb = name
+			return backend.Touch(name)
+		}
+	}
+
+	content, err := backend.Open(ref.Path)
+	if err != nil {
+		return
+	}
+	defer content.Close()
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(content); err != nil {
+		return
+	}
+
+	data, ext, err := Thumbnail(buf.Bytes(), ThumbnailSize)
+	if err != nil {
+		return
+	}
+	name := thumbPath(ref.Hash, ext)
+	if err = backend.Put(name, bytes.NewReader(data), int64(len(data))); err != nil {
+		return
+	}
+	ref.Thumb = name
+	return
+}
+
+// Thumbnail function resizes image to fit size x size, small images keep their size.
+// Opaque images are encoded to jpeg and images with transparency, e.g. stickers, to png.
+func Thumbnail(data []byte, size int) (thumb []byte, ext string, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, "", fmt.Errorf("image %dx%d is too big", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width > height {
+			width, height = size, height*size/width
+		} else {
+			width, height = width*size/height, size
+		}
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if dst.Opaque() {
+		ext = ".jpg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	} else {
+		ext = ".png"
+		err = png.Encode(&buf, dst)
+	}
+	return buf.Bytes(), ext, err
+}
@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+)
+
+// testImage returns image with gradient, alpha is an alpha of all pixels
+func testImage(width, height int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 0, alpha})
+		}
+	}
+	return img
+}
+
+// encodeImage returns image in format: jpeg, png or gif
+func encodeImage(t *testing.T, img image.Image, format string) []byte {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// hugePNG returns png with header of huge image, its pixels are not encoded
+func hugePNG(t *testing.T) []byte {
+	data := encodeImage(t, testImage(1, 1, 255), "png")
+	// IHDR chunk goes after 8 bytes of signature: length, type, width, height, ..., crc
+	ihdr := data[8+4 : 8+4+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:], 100000)
+	binary.BigEndian.PutUint32(ihdr[8:], 100000)
+	binary.BigEndian.PutUint32(data[8+4+4+13:], crc32.ChecksumIEEE(ihdr))
+	return data
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		width  int
+		height int
+		ext    string
+	}{
+		{"wide photo", encodeImage(t, testImage(1280, 640, 255), "jpeg"), 320, 160, ".jpg"},
+		{"tall photo", encodeImage(t, testImage(600, 1200, 255), "jpeg"), 160, 320, ".jpg"},
+		{"small photo", encodeImage(t, testImage(100, 50, 255), "jpeg"), 100, 50, ".jpg"},
+		{"line", encodeImage(t, testImage(2000, 1, 255), "png"), 320, 1, ".jpg"},
+		{"opaque png", encodeImage(t, testImage(640, 640, 255), "png"), 320, 320, ".jpg"},
+		{"sticker", encodeImage(t, testImage(512, 512, 128), "png"), 320, 320, ".png"},
+		{"gif", encodeImage(t, testImage(400, 200, 255), "gif"), 320, 160, ".jpg"},
+		{"garbage", []byte("not an image"), 0, 0, ""},
+		{"huge image", hugePNG(t), 0, 0, ""},
+	}
+	for _, test := range tests {
+		thumb, ext, err := Thumbnail(test.data, ThumbnailSize)
+		if test.ext == "" {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+		if err != nil || ext != test.ext {
+			t.Errorf("%s: Thumbnail returns %q, %v", test.name, ext, err)
+			continue
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil || config.Width != test.width || config.Height != test.height {
+			t.Errorf("%s: thumbnail is %dx%d, %v", test.name, config.Width, config.Height, err)
+		}
+	}
+}
+
+func TestSaveThumbnail(t *testing.T) {
+	local, cleanup := newTestLocal(t)
+	defer cleanup()
+
+	ref, err := Save(local, bytes.NewReader(encodeImage(t, testImage(1280, 640, 255), "jpeg")), "photos/file_1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SaveThumbnail(local, ref); err != nil {
+		t.Fatal(err)
+	}
+	if ref.Thumb != thumbPath(ref.Hash, ".jpg") || !strings.HasPrefix(ref.Thumb, "media/thumbs/") {
+		t.Errorf("Bad thumbnail path %s", ref.Thumb)
+	}
+	content, err := local.Open(ref.Thumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := image.DecodeConfig(content)
+	content.Close()
+	if err != nil || config.Width != 320 || config.Height != 160 {
+		t.Errorf("Saved thumbnail is %dx%d, %v", config.Width, config.Height, err)
+	}
+
+	// thumbnail of the same content is not generated again
+	local.Delete(ref.Path)
+	same := &db.MediaRef{Hash: ref.Hash, Path: ref.Path}
+	if err = SaveThumbnail(local, same); err != nil || same.Thumb != ref.Thumb {
+		t.Errorf("Thumbnail of the same content is %q, %v", same.Thumb, err)
+	}
+
+	sticker, err := Save(local, bytes.NewReader(encodeImage(t, testImage(512, 512, 0), "png")), "stickers/file_2.PNG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SaveThumbnail(local, sticker); err != nil || sticker.Thumb != thumbPath(sticker.Hash, ".png") {
+		t.Errorf("Thumbnail of sticker is %q, %v", sticker.Thumb, err)
+	}
+	// second thumbnail of transparent image is found by png extension
+	same = &db.MediaRef{Hash: sticker.Hash, Path: sticker.Path}
+	if err = SaveThumbnail(local, same); err != nil || same.Thumb != sticker.Thumb {
+		t.Errorf("Second thumbnail of sticker is %q, %v", same.Thumb, err)
+	}
+
+	for _, name := range []string{"media/ab/ab.tgs", "media/ab/ab.mp4", "media/ab/ab"} {
+		ref := &db.MediaRef{Hash: "ab", Path: name}
+		if err = SaveThumbnail(local, ref); err == nil || ref.Thumb != "" {
+			t.Errorf("%s: thumbnail of not image is %q, %v", name, ref.Thumb, err)
+		}
+	}
+	broken, err := Save(local, strings.NewReader("broken"), "photos/file_3.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SaveThumbnail(local, broken); err == nil || broken.Thumb != "" {
+		t.Errorf("Thumbnail of broken image is %q, %v", broken.Thumb, err)
+	}
+}
+
+func TestHasThumbnail(t *testing.T) {
+	tests := map[string]bool{
+		"media/ab/ab.jpg":  true,
+		"media/ab/ab.JPEG": true,
+		"media/ab/ab.png":  true,
+		"media/ab/ab.gif":  true,
+		"media/ab/ab.webp": true,
+		"media/ab/ab.tgs":  false,
+		"media/ab/ab.mp4":  false,
+		"media/ab/ab":      false,
+	}
+	for name, expected := range tests {
+		if HasThumbnail(name) != expected {
+			t.Errorf("HasThumbnail(%q) is not %t", name, expected)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/httpserver"
+	"github.com/elemc/gotelegrambot/media"
+)
+
+// gcCommand removes stored media files without refs
+// usage: gotelegrambot gc -storage sqlite [-dry-run]
+func gcCommand(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	addSettingsFlags(fs)
+	fs.StringVar(&settings.Storage, "storage", settings.Storage, "storage backend: couchbase, sqlite or memory")
+	dryRun := fs.Bool("dry-run", false, "only show count and size of files for removing")
+	fs.Parse(args)
+
+	store, err := openStore(settings.Storage)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", settings.Storage, err)
+	}
+	backend, err := openMediaBackend(settings.Media.Backend)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s media backend: %s", settings.Media.Backend, err)
+	}
+	count, size, err := media.GC(store, backend, *dryRun)
+	if err != nil {
+		log.Fatalf("Cannot collect garbage: %s", err)
+	}
+	if *dryRun {
+		log.Printf("%d orphaned files, %s may be freed", count, media.FormatSize(size))
+	} else {
+		log.Printf("%d orphaned files removed, %s freed", count, media.FormatSize(size))
+	}
+}
+
+// syncCommand copies files from static dir to media backend: content addressed files are copied as is
+// and files downloaded before content addressed storage are stored by hash with refs
+// usage: gotelegrambot sync -storage sqlite -media-backend s3
+func syncCommand(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	addSettingsFlags(fs)
+	fs.StringVar(&settings.Storage, "storage", settings.Storage, "storage backend: couchbase, sqlite or memory")
+	fs.Parse(args)
+
+	store, err := openStore(settings.Storage)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", settings.Storage, err)
+	}
+	backend, err := openMediaBackend(settings.Media.Backend)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s media backend: %s", settings.Media.Backend, err)
+	}
+	local := media.NewLocal(settings.StaticDirPath)
+
+	if settings.Media.Backend != "local" {
+		copied, err := copyBlobs(local, backend)
+		if err != nil {
+			log.Fatalf("Cannot copy files after %d copied: %s", copied, err)
+		}
+		log.Printf("%d files copied", copied)
+	}
+
+	chats, err := store.GetChats()
+	if err != nil {
+		log.Fatalf("Cannot get chats: %s", err)
+	}
+	imported, missing := 0, 0
+	for _, chat := range chats {
+		messages, err := store.GetMessages(chat.ID)
+		if err != nil {
+			log.Fatalf("Cannot get messages of chat %d: %s", chat.ID, err)
+		}
+		for _, msg := range messages {
+			for _, fileID := range httpserver.MessageFileIDs(msg) {
+				ok, err := importFile(store, local, backend, chat.ID, fileID)
+				if err != nil {
+					log.Fatalf("Cannot import file %s of chat %d: %s", fileID, chat.ID, err)
+				}
+				if ok {
+					imported++
+				} else {
+					missing++
+				}
+			}
+		}
+	}
+	log.Printf("%d old files imported, %d files are missing or already imported", imported, missing)
+}
+
+// copyBlobs copies content addressed files which are missing in target
+func copyBlobs(source, target media.Backend) (copied int, err error) {
+	err = source.Walk(media.Dir+"/", func(info media.BlobInfo) (err error) {
+		if strings.HasSuffix(info.Path, ".part") {
+			return
+		}
+		if existing, err := target.Stat(info.Path); err == nil && existing.Size == info.Size {
+			return nil
+		}
+		content, err := source.Open(info.Path)
+		if err != nil {
+			return
+		}
+		defer content.Close()
+		if err = target.Put(info.Path, content, info.Size); err != nil {
+			return
+		}
+		copied++
+		return
+	})
+	return
+}
+
+// importFile stores file from old place in static dir by hash and updates its record,
+// false is returned for missing files and files which are already content addressed
+func importFile(store db.Store, local, backend media.Backend, chatID int64, fileID string) (ok bool, err error) {
+	f, err := store.GetFile(fileID, chatID)
+	if err == db.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(f.FilePath, media.Dir+"/") {
+		return false, nil
+	}
+
+	content, err := local.Open(f.FilePath)
+	if err == media.ErrNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	defer content.Close()
+
+	ref, err := media.Save(backend, content, f.FilePath)
+	if err != nil {
+		return
+	}
+	ref.ChatID = chatID
+	ref.FileID = fileID
+	if media.HasThumbnail(ref.Path) {
+		if err := media.SaveThumbnail(backend, ref); err != nil {
+			log.Printf("Cannot create thumbnail of file %s: %s", fileID, err)
+		}
+	}
+	if err = store.SaveMediaRef(ref); err != nil {
+		return
+	}
+	f.FilePath = ref.Path
+	f.FileSize = int(ref.Size)
+	return true, store.SaveFile(f, chatID)
+}
+
+// usageCommand prints disk usage of media files per chat
+// usage: gotelegrambot usage -storage sqlite
+func usageCommand(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	addSettingsFlags(fs)
+	fs.StringVar(&settings.Storage, "storage", settings.Storage, "storage backend: couchbase, sqlite or memory")
+	fs.Parse(args)
+
+	store, err := openStore(settings.Storage)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", settings.Storage, err)
+	}
+	usage, total, err := media.Usage(store)
+	if err != nil {
+		log.Fatalf("Cannot get disk usage: %s", err)
+	}
+	names := make(map[int64]string)
+	if chats, err := store.GetChats(); err == nil {
+		for _, chat := range chats {
+			names[chat.ID] = chat.Title
+			if chat.Title == "" {
+				names[chat.ID] = "@" + chat.UserName
+			}
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Chat ID\tFiles\tSize\tOwn size\t Name")
+	for _, u := range usage {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t %s\n", u.ChatID, u.Files, media.FormatSize(u.Size), media.FormatSize(u.OwnSize), names[u.ChatID])
+	}
+	w.Flush()
+	fmt.Printf("Total: %s\n", media.FormatSize(total))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/media"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestSyncMedia(t *testing.T) {
+	staticDir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(staticDir)
+	targetDir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDir)
+
+	local := media.NewLocal(staticDir)
+	target := media.NewLocal(targetDir)
+	ref, err := media.Save(local, strings.NewReader("new"), "voice/file_1.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unfinished upload is not copied
+	ioutil.WriteFile(filepath.Join(staticDir, filepath.FromSlash(ref.Path)+".part"), []byte("ne"), 0644)
+
+	copied, err := copyBlobs(local, target)
+	if err != nil || copied != 1 {
+		t.Fatalf("copyBlobs returns %d, %v", copied, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(targetDir, filepath.FromSlash(ref.Path))); err != nil || string(data) != "new" {
+		t.Errorf("Copied file has %q, %v", data, err)
+	}
+	if copied, err = copyBlobs(local, target); err != nil || copied != 0 {
+		t.Errorf("Copied files are copied again: %d, %v", copied, err)
+	}
+
+	// file downloaded before content addressed storage
+	store := db.NewMemoryStore()
+	os.MkdirAll(filepath.Join(staticDir, "photos"), 0755)
+	ioutil.WriteFile(filepath.Join(staticDir, "photos", "file_2.jpg"), []byte("old"), 0644)
+	store.SaveFile(&tgbotapi.File{FileID: "old", FilePath: "photos/file_2.jpg"}, -5)
+	store.SaveFile(&tgbotapi.File{FileID: "lost", FilePath: "photos/file_3.jpg"}, -5)
+	store.SaveFile(&tgbotapi.File{FileID: "new", FilePath: ref.Path}, -5)
+
+	tests := []struct {
+		fileID   string
+		imported bool
+	}{
+		{"old", true},
+		{"old", false},
+		{"lost", false},
+		{"new", false},
+		{"unknown", false},
+	}
+	for _, test := range tests {
+		if imported, err := importFile(store, local, target, -5, test.fileID); imported != test.imported || err != nil {
+			t.Errorf("%s: importFile returns %t, %v", test.fileID, imported, err)
+		}
+	}
+
+	f, err := store.GetFile("old", -5)
+	if err != nil || !strings.HasPrefix(f.FilePath, media.Dir+"/") || f.FileSize != 3 {
+		t.Fatalf("Imported file is %+v, %v", f, err)
+	}
+	if saved, err := store.GetMediaRef(-5, "old"); err != nil || saved.Path != f.FilePath {
+		t.Errorf("Ref of imported file is %+v, %v", saved, err)
+	}
+	if info, err := target.Stat(f.FilePath); err != nil || info.Size != 3 {
+		t.Errorf("Imported file is not in target: %+v, %v", info, err)
+	}
+}
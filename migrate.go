@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/elemc/gotelegrambot/db"
+)
+
+// migrateCommand copies all documents from one storage backend to another
+// usage: gotelegrambot migrate --from couchbase --to sqlite
+func migrateCommand(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	addSettingsFlags(fs)
+	from := fs.String("from", "couchbase", "source storage backend")
+	to := fs.String("to", "sqlite", "target storage backend")
+	statePath := fs.String("state", "migrate-state.json", "file for migration progress, remove it for start from beginning")
+	batchSize := fs.Int("batch", 1000, "documents count per batch")
+	fs.Parse(args)
+
+	if *from == *to {
+		log.Fatalf("Source and target storage backends are the same")
+	}
+
+	source, err := openStore(*from)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", *from, err)
+	}
+	exporter, ok := source.(db.Exporter)
+	if !ok {
+		log.Fatalf("Storage backend %s cannot be a migration source", *from)
+	}
+
+	target, err := openStore(*to)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", *to, err)
+	}
+	importer, ok := target.(db.Importer)
+	if !ok {
+		log.Fatalf("Storage backend %s cannot be a migration target", *to)
+	}
+
+	report, err := db.Migrate(exporter, importer, *statePath, *batchSize)
+	if err != nil {
+		log.Fatalf("Migration failed, run it again to resume: %s", err)
+	}
+
+	ok = true
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PREFIX\tMIGRATED\tFAILED\tSOURCE\tTARGET\tSTATUS")
+	for _, count := range report {
+		status := "OK"
+		if !count.Ok() {
+			status = "MISMATCH"
+			ok = false
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", count.Prefix, count.Migrated, count.Failed, count.Source, count.Target, status)
+	}
+	w.Flush()
+
+	if !ok {
+		os.Exit(1)
+	}
+}
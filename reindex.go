@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/elemc/gotelegrambot/search"
+)
+
+// reindexCommand rebuilds full-text search index from all stored messages
+// usage: gotelegrambot reindex --storage sqlite
+func reindexCommand(args []string) {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	addSettingsFlags(fs)
+	fs.StringVar(&settings.Storage, "storage", settings.Storage, "storage backend: couchbase, sqlite or memory")
+	fs.Parse(args)
+
+	if settings.Search.IndexPath == "" {
+		log.Fatalf("Search index path is not set")
+	}
+
+	store, err := openStore(settings.Storage)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", settings.Storage, err)
+	}
+	index, err := search.NewSQLiteIndex(settings.Search.IndexPath)
+	if err != nil {
+		log.Fatalf("Cannot initialize search index: %s", err)
+	}
+	defer index.Close()
+
+	count, err := search.Rebuild(store, index)
+	if err != nil {
+		log.Fatalf("Cannot rebuild search index: %s", err)
+	}
+	log.Printf("Search index rebuilt, %d messages indexed", count)
+}
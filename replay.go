@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/journal"
+	"github.com/elemc/gotelegrambot/search"
+)
+
+// replayCommand saves messages from updates journal to storage, e.g. for rebuild archive
+// usage: gotelegrambot replay -storage sqlite -journal updates.journal
+func replayCommand(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	addSettingsFlags(fs)
+	fs.StringVar(&settings.Storage, "storage", settings.Storage, "storage backend: couchbase, sqlite or memory")
+	afterID := fs.Int("after", 0, "replay only updates with update_id greater than it")
+	fs.Parse(args)
+
+	if settings.JournalPath == "" {
+		log.Fatalf("Journal path is not set")
+	}
+
+	store, err := openStore(settings.Storage)
+	if err != nil {
+		log.Fatalf("Cannot initialize %s store: %s", settings.Storage, err)
+	}
+	if settings.Search.IndexPath != "" {
+		index, err := search.NewSQLiteIndex(settings.Search.IndexPath)
+		if err != nil {
+			log.Fatalf("Cannot initialize search index: %s", err)
+		}
+		defer index.Close()
+		store = search.NewIndexingStore(store, index)
+	}
+
+	count, err := journal.Replay(settings.JournalPath, *afterID, func(update db.Update) error {
+		return archiveUpdate(store, update)
+	})
+	if err != nil {
+		log.Fatalf("Cannot replay journal after %d updates: %s", count, err)
+	}
+	log.Printf("Journal replayed, %d updates saved", count)
+}
+
+// archiveUpdate saves messages of update and their caption entities to storage
+func archiveUpdate(store db.Store, update db.Update) (err error) {
+	switch {
+	case update.Message != nil:
+		err = store.SaveMessage(update.Message)
+	case update.EditedMessage != nil:
+		err = store.SaveEditedMessage(update.EditedMessage)
+	case update.ChannelPost != nil:
+		err = store.SaveMessage(update.ChannelPost)
+	case update.EditedChannelPost != nil:
+		err = store.SaveEditedMessage(update.EditedChannelPost)
+	}
+	if err != nil {
+		return
+	}
+	for _, caption := range update.Captions {
+		if err = store.SaveCaption(caption); err != nil {
+			return
+		}
+	}
+	return
+}
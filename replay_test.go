@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/journal"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestReplayCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved Settings) { settings = saved }(settings)
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	channel := &tgbotapi.Chat{ID: -100, Type: "channel"}
+	caption := &db.Caption{ChatID: -5, MessageID: 2, Entities: []tgbotapi.MessageEntity{{Type: "bold", Offset: 0, Length: 1}}}
+	updates := []db.Update{
+		{Update: tgbotapi.Update{UpdateID: 1, Message: &tgbotapi.Message{MessageID: 1, Date: 1, Chat: chat, Text: "saved before"}}},
+		{Update: tgbotapi.Update{UpdateID: 2, Message: &tgbotapi.Message{MessageID: 2, Date: 2, Chat: chat, Caption: "photo"}}, Captions: []*db.Caption{caption}},
+		{Update: tgbotapi.Update{UpdateID: 3, EditedMessage: &tgbotapi.Message{MessageID: 2, Date: 2, EditDate: 3, Chat: chat, Caption: "edited photo"}}},
+		{Update: tgbotapi.Update{UpdateID: 4, ChannelPost: &tgbotapi.Message{MessageID: 1, Date: 4, Chat: channel, Text: "post"}}},
+		{Update: tgbotapi.Update{UpdateID: 5, CallbackQuery: &tgbotapi.CallbackQuery{ID: "1", Data: "search:1"}}},
+	}
+	journalPath := filepath.Join(dir, "updates.journal")
+	j, err := journal.Open(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, update := range updates {
+		if err = j.Write(update); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	sqlitePath := filepath.Join(dir, "bot.db")
+	replayCommand([]string{"-storage", "sqlite", "-sqlite-path", sqlitePath, "-journal", journalPath, "-search-index", "", "-after", "1"})
+
+	store, err := db.NewSQLiteStore(sqlitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if msgs, err := store.GetMessages(-5); err != nil || len(msgs) != 1 || msgs[0].Caption != "edited photo" {
+		t.Errorf("Replayed messages are %v, %v", msgs, err)
+	}
+	if revisions, err := store.GetMessageRevisions(-5, 2); err != nil || len(revisions) != 2 {
+		t.Errorf("Replayed revisions are %v, %v", revisions, err)
+	}
+	if saved, err := store.GetCaption(-5, 2); err != nil || len(saved.Entities) != 1 || saved.Entities[0].Type != "bold" {
+		t.Errorf("Replayed caption is %+v, %v", saved, err)
+	}
+	if msgs, err := store.GetMessages(-100); err != nil || len(msgs) != 1 {
+		t.Errorf("Replayed channel posts are %v, %v", msgs, err)
+	}
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// MarkStart begins highlighted part of snippet
+	MarkStart = "\x01"
+	// MarkEnd ends highlighted part of snippet
+	MarkEnd = "\x02"
+)
+
+// Index is an interface for full-text index of chat messages
+type Index interface {
+	// Add adds or replaces message in index
+	Add(msg *tgbotapi.Message) error
+	// Search returns messages of chat matched all words of query, newest first
+	Search(chatID int64, query string, offset, limit int) (*Result, error)
+	// Reset removes all messages from index
+	Reset() error
+	Close() error
+}
+
+// Hit is a found message
+type Hit struct {
+	ChatID    int64
+	MessageID int
+	Date      int
+	Sender    string
+	// Snippet is a part of message text with matched words between MarkStart and MarkEnd
+	Snippet string
+}
+
+// Result is a page of search results
+type Result struct {
+	Total int
+	Hits  []Hit
+}
+
+// HTMLSnippet returns escaped snippet with matched words in <mark> tag
+func (h Hit) HTMLSnippet() string {
+	return h.HighlightedSnippet("<mark>", "</mark>")
+}
+
+// HighlightedSnippet returns escaped snippet with matched words between open and close tags
+func (h Hit) HighlightedSnippet(open, close string) string {
+	s := html.EscapeString(h.Snippet)
+	s = strings.Replace(s, MarkStart, open, -1)
+	return strings.Replace(s, MarkEnd, close, -1)
+}
+
+// PlainSnippet returns snippet without highlight marks
+func (h Hit) PlainSnippet() string {
+	s := strings.Replace(h.Snippet, MarkStart, "", -1)
+	return strings.Replace(s, MarkEnd, "", -1)
+}
+
+// MessageText returns indexed text of message: text and caption
+func MessageText(msg *tgbotapi.Message) string {
+	return strings.TrimSpace(msg.Text + "\n" + msg.Caption)
+}
+
+// SenderName returns indexed sender name of message, channel posts are signed by channel title
+func SenderName(msg *tgbotapi.Message) string {
+	if msg.From == nil {
+		if msg.Chat != nil {
+			return msg.Chat.Title
+		}
+		return ""
+	}
+	name := strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)
+	if msg.From.UserName != "" {
+		name = strings.TrimSpace(fmt.Sprintf("@%s %s", msg.From.UserName, name))
+	}
+	return name
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	// sqlite3 driver for database/sql
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS search_messages (
+	id         INTEGER PRIMARY KEY,
+	chat_id    INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	date       INTEGER NOT NULL,
+	sender     TEXT NOT NULL,
+	UNIQUE (chat_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS search_messages_chat_date ON search_messages (chat_id, date);
+CREATE VIRTUAL TABLE IF NOT EXISTS search_fts USING fts4(text, sender, tokenize=unicode61);
+`
+
+// SQLiteIndex is an Index implementation on top of sqlite FTS4 in separate database file,
+// so it works with every storage backend
+type SQLiteIndex struct {
+	db *sql.DB
+}
+
+// NewSQLiteIndex function opens or creates index database
+func NewSQLiteIndex(path string) (index *SQLiteIndex, err error) {
+	index = new(SQLiteIndex)
+	if index.db, err = sql.Open("sqlite3", path+"?_busy_timeout=5000"); err != nil {
+		return nil, fmt.Errorf("Cannot open search index: %s", err)
+	}
+	index.db.SetMaxOpenConns(1)
+
+	if _, err = index.db.Exec(sqliteSchema); err != nil {
+		index.db.Close()
+		return nil, fmt.Errorf("Cannot create search index: %s", err)
+	}
+	return
+}
+
+// Add adds or replaces message in index
+func (index *SQLiteIndex) Add(msg *tgbotapi.Message) (err error) {
+	text := MessageText(msg)
+	sender := SenderName(msg)
+
+	tx, err := index.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec(`INSERT INTO search_messages (chat_id, message_id, date, sender) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET date = excluded.date, sender = excluded.sender`,
+		msg.Chat.ID, msg.MessageID, msg.Date, sender)
+	if err != nil {
+		return
+	}
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM search_messages WHERE chat_id = ? AND message_id = ?`,
+		msg.Chat.ID, msg.MessageID).Scan(&id)
+	if err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(`DELETE FROM search_fts WHERE docid = ?`, id); err != nil {
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO search_fts (docid, text, sender) VALUES (?, ?, ?)`, id, text, sender)
+	return
+}
+
+// Search returns messages of chat matched all words of query, newest first
+func (index *SQLiteIndex) Search(chatID int64, query string, offset, limit int) (result *Result, err error) {
+	result = new(Result)
+	match := matchQuery(query)
+	if match == "" {
+		return
+	}
+
+	err = index.db.QueryRow(`SELECT COUNT(*) FROM search_fts JOIN search_messages m ON m.id = search_fts.docid
+		WHERE search_fts MATCH ? AND m.chat_id = ?`, match, chatID).Scan(&result.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := index.db.Query(`SELECT m.chat_id, m.message_id, m.date, m.sender,
+			snippet(search_fts, ?, ?, '...', 0, 30)
+		FROM search_fts JOIN search_messages m ON m.id = search_fts.docid
+		WHERE search_fts MATCH ? AND m.chat_id = ?
+		ORDER BY m.date DESC, m.message_id DESC LIMIT ? OFFSET ?`,
+		MarkStart, MarkEnd, match, chatID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hit := Hit{}
+		if err = rows.Scan(&hit.ChatID, &hit.MessageID, &hit.Date, &hit.Sender, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	err = rows.Err()
+	return
+}
+
+// Reset removes all messages from index
+func (index *SQLiteIndex) Reset() (err error) {
+	_, err = index.db.Exec(`DELETE FROM search_fts; DELETE FROM search_messages;`)
+	return
+}
+
+// Close closes index database
+func (index *SQLiteIndex) Close() error {
+	return index.db.Close()
+}
+
+// matchQuery converts user query to FTS query, every word is a quoted term and all terms must match
+func matchQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+	return strings.Join(words, " ")
+}
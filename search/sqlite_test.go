@@ -0,0 +1,167 @@
+package search
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// newTestIndex returns index in temporary directory and cleanup function which removes it
+func newTestIndex(t *testing.T) (index *SQLiteIndex, cleanup func()) {
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index, err = NewSQLiteIndex(filepath.Join(dir, "search.db")); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return index, func() {
+		index.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// hitIDs returns message IDs of hits
+func hitIDs(result *Result) (ids []int) {
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.MessageID)
+	}
+	return
+}
+
+func TestSQLiteIndexSearch(t *testing.T) {
+	index, cleanup := newTestIndex(t)
+	defer cleanup()
+
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	alex := &tgbotapi.User{ID: 1, UserName: "alex", FirstName: "Алексей"}
+	bob := &tgbotapi.User{ID: 2, UserName: "bob", FirstName: "Bob"}
+	msgs := []*tgbotapi.Message{
+		{MessageID: 1, Date: 100, Chat: chat, From: alex, Text: "Привет МИР"},
+		{MessageID: 2, Date: 200, Chat: chat, From: alex, Caption: "мир фото"},
+		// edited message replaces indexed text
+		{MessageID: 2, Date: 200, Chat: chat, From: alex, Caption: "кот фото"},
+		{MessageID: 3, Date: 300, Chat: &tgbotapi.Chat{ID: 7}, From: bob, Text: "мир"},
+		{MessageID: 4, Date: 400, Chat: chat, From: bob, Text: "hello_world 2017"},
+		{MessageID: 5, Date: 500, Chat: &tgbotapi.Chat{ID: -5, Type: "channel", Title: "Новости"}, Text: "пост"},
+	}
+	for _, msg := range msgs {
+		if err := index.Add(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"мир", []int{1}},
+		{"МИР!", []int{1}},
+		{"фото", []int{2}},
+		{"кот фото", []int{2}},
+		{"привет кот", nil},
+		{"алексей", []int{2, 1}},
+		{"@bob", []int{4}},
+		{"новости", []int{5}},
+		{"hello_world", []int{4}},
+		{"2017", []int{4}},
+		// FTS syntax is not available for users
+		{`мир" OR "фото`, nil},
+		{`мир*`, []int{1}},
+		{"NEAR", nil},
+		{"", nil},
+		{"!!!", nil},
+	}
+	for _, test := range tests {
+		result, err := index.Search(-5, test.query, 0, 10)
+		if err != nil {
+			t.Errorf("%q: %s", test.query, err)
+			continue
+		}
+		if ids := hitIDs(result); !reflect.DeepEqual(ids, test.expected) || result.Total != len(test.expected) {
+			t.Errorf("%q: found %v of %d, expected %v", test.query, ids, result.Total, test.expected)
+		}
+	}
+
+	result, err := index.Search(-5, "мир", 0, 10)
+	if err != nil || len(result.Hits) != 1 {
+		t.Fatalf("Search returns %v, %v", result, err)
+	}
+	if hit := result.Hits[0]; hit.ChatID != -5 || hit.Date != 100 || hit.Sender != "@alex Алексей" ||
+		hit.Snippet != "Привет "+MarkStart+"МИР"+MarkEnd {
+		t.Errorf("Bad hit %+v", hit)
+	}
+
+	if err = index.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = index.Search(-5, "мир", 0, 10); err != nil || result.Total != 0 {
+		t.Errorf("Reset index returns %v, %v", result, err)
+	}
+}
+
+func TestSQLiteIndexPages(t *testing.T) {
+	index, cleanup := newTestIndex(t)
+	defer cleanup()
+
+	// messages with the same date are ordered by ID
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	for id := 1; id <= 25; id++ {
+		msg := &tgbotapi.Message{MessageID: id, Date: 1000 + id/2, Chat: chat, Text: fmt.Sprintf("page %d", id)}
+		if err := index.Add(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []int
+	for _, page := range []struct{ offset, count int }{{0, 10}, {10, 10}, {20, 5}, {30, 0}} {
+		result, err := index.Search(-5, "page", page.offset, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 25 || len(result.Hits) != page.count {
+			t.Errorf("Page at %d has %d hits of %d", page.offset, len(result.Hits), result.Total)
+		}
+		ids = append(ids, hitIDs(result)...)
+	}
+	for i, id := range ids {
+		if id != 25-i {
+			t.Fatalf("Hits are not ordered by date and ID: %v", ids)
+		}
+	}
+}
+
+func TestHighlightedSnippet(t *testing.T) {
+	tests := []struct {
+		snippet   string
+		open      string
+		close     string
+		highlight string
+		plain     string
+	}{
+		{"мир", "<mark>", "</mark>", "мир", "мир"},
+		{"a " + MarkStart + "мир" + MarkEnd + " b", "<mark>", "</mark>", "a <mark>мир</mark> b", "a мир b"},
+		{"<script>" + MarkStart + "x&y" + MarkEnd + `"'`, "<mark>", "</mark>",
+			"&lt;script&gt;<mark>x&amp;y</mark>&#34;&#39;", `<script>x&y"'`},
+		{MarkStart + "a" + MarkEnd + " " + MarkStart + "b" + MarkEnd, "<b>", "</b>", "<b>a</b> <b>b</b>", "a b"},
+	}
+	for _, test := range tests {
+		hit := Hit{Snippet: test.snippet}
+		if s := hit.HighlightedSnippet(test.open, test.close); s != test.highlight {
+			t.Errorf("HighlightedSnippet(%q) = %q, expected %q", test.snippet, s, test.highlight)
+		}
+		if s := hit.PlainSnippet(); s != test.plain {
+			t.Errorf("PlainSnippet(%q) = %q, expected %q", test.snippet, s, test.plain)
+		}
+	}
+	if s := (Hit{Snippet: MarkStart + "<a>" + MarkEnd}).HTMLSnippet(); !strings.HasPrefix(s, "<mark>&lt;a&gt;") {
+		t.Errorf("HTMLSnippet = %q", s)
+	}
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"log"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// IndexingStore is a db.Store wrapper which adds every saved message to search index
+type IndexingStore struct {
+	db.Store
+	Index Index
+}
+
+// NewIndexingStore function wraps store with index
+func NewIndexingStore(store db.Store, index Index) *IndexingStore {
+	return &IndexingStore{Store: store, Index: index}
+}
+
+// SaveMessage method save message to store and index
+func (s *IndexingStore) SaveMessage(msg *tgbotapi.Message) (err error) {
+	if err = s.Store.SaveMessage(msg); err != nil {
+		return
+	}
+	s.add(msg)
+	return
+}
+
+// SaveEditedMessage method save edited message to store and replace it in index
+func (s *IndexingStore) SaveEditedMessage(msg *tgbotapi.Message) (err error) {
+	if err = s.Store.SaveEditedMessage(msg); err != nil {
+		return
+	}
+	s.add(msg)
+	return
+}
+
+// add method adds message to index with replied message, store saves replied message with reply
+func (s *IndexingStore) add(msg *tgbotapi.Message) {
+	for ; msg != nil; msg = msg.ReplyToMessage {
+		if err := s.Index.Add(msg); err != nil {
+			log.Printf("Error in index message %d:%d: %s", msg.Chat.ID, msg.MessageID, err)
+		}
+	}
+}
+
+// Rebuild function clears index and adds all messages of all chats from store
+func Rebuild(store db.Store, index Index) (count int, err error) {
+	if err = index.Reset(); err != nil {
+		return
+	}
+
+	chats, err := store.GetChats()
+	if err != nil {
+		return
+	}
+	for _, chat := range chats {
+		var msgs []*tgbotapi.Message
+		if msgs, err = store.GetMessages(chat.ID); err != nil {
+			return
+		}
+		for _, msg := range msgs {
+			if err = index.Add(msg); err != nil {
+				return
+			}
+			count++
+		}
+		log.Printf("Indexed %d messages of chat %d", len(msgs), chat.ID)
+	}
+	return
+}
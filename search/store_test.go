@@ -0,0 +1,46 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/db"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+func TestIndexingStore(t *testing.T) {
+	index, cleanup := newTestIndex(t)
+	defer cleanup()
+	store := NewIndexingStore(db.NewMemoryStore(), index)
+
+	// replied message is saved with reply, so it is indexed too
+	chat := &tgbotapi.Chat{ID: -5, Type: "group"}
+	question := &tgbotapi.Message{MessageID: 1, Date: 100, Chat: chat, Text: "где кот"}
+	answer := &tgbotapi.Message{MessageID: 2, Date: 200, Chat: chat, Text: "кот дома", ReplyToMessage: question}
+	if err := store.SaveMessage(answer); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := index.Search(-5, "кот", 0, 10); err != nil || !reflect.DeepEqual(hitIDs(result), []int{2, 1}) {
+		t.Errorf("Saved messages are not indexed: %v, %v", result, err)
+	}
+
+	edited := &tgbotapi.Message{MessageID: 2, Date: 200, EditDate: 300, Chat: chat, Text: "пёс дома", ReplyToMessage: question}
+	if err := store.SaveEditedMessage(edited); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := index.Search(-5, "дома", 0, 10); err != nil || !reflect.DeepEqual(hitIDs(result), []int{2}) {
+		t.Errorf("Edited message is not indexed: %v, %v", result, err)
+	}
+	if result, err := index.Search(-5, "кот", 0, 10); err != nil || !reflect.DeepEqual(hitIDs(result), []int{1}) {
+		t.Errorf("Old text of edited message is found: %v, %v", result, err)
+	}
+
+	count, err := Rebuild(store, index)
+	if err != nil || count != 2 {
+		t.Errorf("Rebuild returns %d, %v", count, err)
+	}
+	if result, err := index.Search(-5, "пёс", 0, 10); err != nil || !reflect.DeepEqual(hitIDs(result), []int{2}) {
+		t.Errorf("Rebuilt index returns %v, %v", result, err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/elemc/gotelegrambot/db"
+	"github.com/elemc/gotelegrambot/httpserver"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// telegramHost is a host of Telegram Bot API
+	telegramHost = "api.telegram.org"
+	// duplicateUpdateWindow is a max distance of already processed update ID from last one
+	duplicateUpdateWindow = 1000
+)
+
+// apiRedirectTransport sends requests to Telegram Bot API to other server, e.g. local fake Bot API for tests
+type apiRedirectTransport struct {
+	base      *url.URL
+	transport http.RoundTripper
+}
+
+// RoundTrip method replaces scheme and host of Telegram Bot API requests
+func (t *apiRedirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == telegramHost {
+		r := new(http.Request)
+		*r = *req
+		u := *req.URL
+		u.Scheme = t.base.Scheme
+		u.Host = t.base.Host
+		u.Path = t.base.Path + u.Path
+		r.URL = &u
+		r.Host = t.base.Host
+		req = r
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// newBotAPI creates bot, apiURL replaces https://api.telegram.org for bot requests and file downloads if set
+func newBotAPI(token, apiURL string) (*tgbotapi.BotAPI, error) {
+	if apiURL == "" {
+		return tgbotapi.NewBotAPI(token)
+	}
+
+	base, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("bad api url: %s", err)
+	}
+	client := &http.Client{Transport: &apiRedirectTransport{base: base, transport: http.DefaultTransport}}
+	return tgbotapi.NewBotAPIWithClient(token, client)
+}
+
+// startUpdates returns channel of updates from webhook if it is configured or from long polling after lastUpdateID.
+// Webhook is registered with http server of s, so s.Start must be called after it.
+func startUpdates(bot *tgbotapi.BotAPI, s *httpserver.Server, lastUpdateID int) (updates <-chan db.Update, err error) {
+	if settings.Webhook.URL == "" {
+		// getUpdates does not work while webhook is set
+		if _, err = bot.RemoveWebhook(); err != nil {
+			return
+		}
+		// Telegram confirms updates before offset, so processed ones are not received again
+		u := tgbotapi.NewUpdate(lastUpdateID + 1)
+		u.Timeout = 60
+		return pollUpdates(bot, u), nil
+	}
+
+	webhookURL, err := url.Parse(settings.Webhook.URL)
+	if err != nil {
+		return nil, fmt.Errorf("bad webhook url: %s", err)
+	}
+	path := webhookURL.Path
+	if path == "" || path == "/" {
+		return nil, fmt.Errorf("webhook url must have path, e.g. https://example.com/telegram/webhook")
+	}
+
+	secret := settings.Webhook.Secret
+	if secret == "" {
+		// webhook is registered on every start, so random secret is fine
+		data := make([]byte, 32)
+		if _, err = rand.Read(data); err != nil {
+			return
+		}
+		secret = hex.EncodeToString(data)
+	}
+
+	updates = s.EnableWebhook(path, secret)
+
+	certFile := ""
+	if settings.Webhook.SelfSigned {
+		certFile = settings.TLSCertFile
+	}
+	if err = s.RegisterWebhook(settings.Webhook.URL, secret, certFile); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// pollUpdates works like GetUpdatesChan of bot, but decodes updates with db.DecodeUpdates,
+// so captions of messages have entities
+func pollUpdates(bot *tgbotapi.BotAPI, config tgbotapi.UpdateConfig) <-chan db.Update {
+	updates := make(chan db.Update, bot.Buffer)
+	go func() {
+		for {
+			params := url.Values{}
+			params.Set("offset", strconv.Itoa(config.Offset))
+			params.Set("limit", strconv.Itoa(config.Limit))
+			params.Set("timeout", strconv.Itoa(config.Timeout))
+			resp, err := bot.MakeRequest("getUpdates", params)
+			var received []db.Update
+			if err == nil {
+				received, err = db.DecodeUpdates(resp.Result)
+			}
+			if err != nil {
+				log.Printf("Failed to get updates, retrying in 3 seconds: %s", err)
+				time.Sleep(time.Second * 3)
+				continue
+			}
+			for _, update := range received {
+				if update.UpdateID >= config.Offset {
+					config.Offset = update.UpdateID + 1
+					updates <- update
+				}
+			}
+		}
+	}()
+	return updates
+}
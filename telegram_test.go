@@ -0,0 +1,229 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elemc/gotelegrambot/httpserver"
+)
+
+// fakeBotAPI is a fake Telegram Bot API server, it records requests by method
+type fakeBotAPI struct {
+	*httptest.Server
+	sync.Mutex
+	requests   map[string][]*http.Request
+	getUpdates chan string
+	// updates is a result of next getUpdates request
+	updates string
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	f := &fakeBotAPI{requests: make(map[string][]*http.Request), getUpdates: make(chan string, 100)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/bot123:ABC/") {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			r.ParseMultipartForm(1 << 20)
+		} else {
+			r.ParseForm()
+		}
+		f.Lock()
+		f.requests[method] = append(f.requests[method], r)
+		f.Unlock()
+
+		switch method {
+		case "getMe":
+			w.Write([]byte(`{"ok":true,"result":{"id":123,"first_name":"Bot","username":"testbot"}}`))
+		case "getUpdates":
+			select {
+			case f.getUpdates <- r.Form.Get("offset"):
+			default:
+			}
+			f.Lock()
+			result := f.updates
+			f.updates = ""
+			f.Unlock()
+			if result == "" {
+				result = "[]"
+			}
+			w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+		default:
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	return f
+}
+
+// calls returns requests of method
+func (f *fakeBotAPI) calls(method string) []*http.Request {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests[method]
+}
+
+func TestStartUpdatesWebhook(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	bot, err := newBotAPI("123:ABC", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.Self.UserName != "testbot" {
+		t.Fatalf("Bot API requests are not redirected, bot is %s", bot.Self.UserName)
+	}
+
+	defer func(saved WebhookSettings) { settings.Webhook = saved }(settings.Webhook)
+	settings.Webhook = WebhookSettings{URL: "https://example.com/telegram/hook", Secret: "secret"}
+	if _, err = startUpdates(bot, &httpserver.Server{Bot: bot}, 10); err != nil {
+		t.Fatal(err)
+	}
+	calls := api.calls("setWebhook")
+	if len(calls) != 1 {
+		t.Fatalf("setWebhook is called %d times", len(calls))
+	}
+	if url := calls[0].Form.Get("url"); url != settings.Webhook.URL {
+		t.Errorf("Webhook url %s, expected %s", url, settings.Webhook.URL)
+	}
+	if secret := calls[0].Form.Get("secret_token"); secret != "secret" {
+		t.Errorf("Webhook secret %s, expected secret", secret)
+	}
+	if len(api.calls("getUpdates")) != 0 {
+		t.Errorf("Long polling is used with webhook")
+	}
+}
+
+func TestStartUpdatesWebhookRandomSecret(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	bot, err := newBotAPI("123:ABC", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved WebhookSettings) { settings.Webhook = saved }(settings.Webhook)
+	settings.Webhook = WebhookSettings{URL: "https://example.com/telegram/hook"}
+	for i := 0; i < 2; i++ {
+		if _, err = startUpdates(bot, &httpserver.Server{Bot: bot}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := api.calls("setWebhook")
+	if len(calls) != 2 {
+		t.Fatalf("setWebhook is called %d times", len(calls))
+	}
+	first, second := calls[0].Form.Get("secret_token"), calls[1].Form.Get("secret_token")
+	if !regexp.MustCompile("^[0-9a-f]{64}$").MatchString(first) {
+		t.Errorf("Bad random secret %q", first)
+	}
+	if first == second {
+		t.Errorf("Random secret is the same on every start")
+	}
+}
+
+func TestStartUpdatesWebhookSelfSigned(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	bot, err := newBotAPI("123:ABC", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "gotelegrambot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	if err = ioutil.WriteFile(certFile, []byte("CERTIFICATE"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved WebhookSettings) { settings.Webhook = saved }(settings.Webhook)
+	defer func(saved string) { settings.TLSCertFile = saved }(settings.TLSCertFile)
+	settings.Webhook = WebhookSettings{URL: "https://example.com:8443/hook", Secret: "secret", SelfSigned: true}
+	settings.TLSCertFile = certFile
+	if _, err = startUpdates(bot, &httpserver.Server{Bot: bot}, 0); err != nil {
+		t.Fatal(err)
+	}
+	calls := api.calls("setWebhook")
+	if len(calls) != 1 || calls[0].MultipartForm == nil {
+		t.Fatalf("setWebhook with certificate is not called")
+	}
+	form := calls[0].MultipartForm
+	if len(form.File["certificate"]) != 1 {
+		t.Fatalf("Certificate is not uploaded")
+	}
+	if form.Value["url"][0] != settings.Webhook.URL || form.Value["secret_token"][0] != "secret" {
+		t.Errorf("Bad webhook params %v", form.Value)
+	}
+}
+
+func TestStartUpdatesWebhookBadURL(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	bot, err := newBotAPI("123:ABC", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved WebhookSettings) { settings.Webhook = saved }(settings.Webhook)
+	for _, webhookURL := range []string{"https://example.com", "https://example.com/", "://bad"} {
+		settings.Webhook = WebhookSettings{URL: webhookURL}
+		if _, err = startUpdates(bot, &httpserver.Server{Bot: bot}, 0); err == nil {
+			t.Errorf("Webhook url %q is accepted", webhookURL)
+		}
+	}
+	if len(api.calls("setWebhook")) != 0 {
+		t.Errorf("Bad webhook url is registered")
+	}
+}
+
+func TestStartUpdatesPolling(t *testing.T) {
+	api := newFakeBotAPI(t)
+	defer api.Close()
+	bot, err := newBotAPI("123:ABC", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved WebhookSettings) { settings.Webhook = saved }(settings.Webhook)
+	settings.Webhook = WebhookSettings{}
+	api.updates = `[{"update_id":42,"message":{"message_id":1,"date":1,"chat":{"id":-5,"type":"group"},` +
+		`"caption":"photo of @user","caption_entities":[{"type":"mention","offset":9,"length":5}],` +
+		`"photo":[{"file_id":"p","width":1,"height":1}]}}]`
+	updates, err := startUpdates(bot, &httpserver.Server{Bot: bot}, 41)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := <-api.getUpdates; offset != "42" {
+		t.Errorf("getUpdates offset %s, expected 42", offset)
+	}
+	update := <-updates
+	if update.UpdateID != 42 || update.Message == nil || len(update.Captions) != 1 {
+		t.Fatalf("Caption entities are not decoded: %+v", update)
+	}
+	if update.Message.Entities != nil {
+		t.Errorf("Caption entities are decoded as text entities")
+	}
+	if e := update.Captions[0].Entities[0]; e.Type != "mention" || e.Offset != 9 || e.Length != 5 {
+		t.Errorf("Bad caption entity %+v", e)
+	}
+	if offset := <-api.getUpdates; offset != "43" {
+		t.Errorf("getUpdates offset %s after update 42, expected 43", offset)
+	}
+	// RemoveWebhook sets empty webhook url
+	calls := api.calls("setWebhook")
+	if len(calls) != 1 || calls[0].Form.Get("url") != "" {
+		t.Errorf("Webhook is not removed before long polling")
+	}
+}